@@ -8,20 +8,176 @@ import (
 	"fmt"
 	"io/ioutil"
 	"mergemock/types"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/prysmaticlabs/prysm/crypto/bls"
 	"github.com/sirupsen/logrus"
 )
 
-func BuilderGetHeader(ctx context.Context, log logrus.Ext1FieldLogger, builderAddr string, slot uint64, blockHash common.Hash, pubkey []byte) (*types.ExecutionPayloadHeader, error) {
+// RelayEntry is a builder relay endpoint. The relay pubkey can be given as user of the URL,
+// e.g. http://0xa1b2...@127.0.0.1:28545, to only accept bids signed by that key.
+type RelayEntry struct {
+	Address string
+	Pubkey  *types.PublicKey
+}
+
+func ParseRelayEntry(raw string) (*RelayEntry, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported relay URL scheme %q", u.Scheme)
+	}
+	entry := &RelayEntry{}
+	if u.User != nil && u.User.Username() != "" {
+		entry.Pubkey = new(types.PublicKey)
+		if err := entry.Pubkey.UnmarshalText([]byte(u.User.Username())); err != nil {
+			return nil, fmt.Errorf("invalid relay pubkey in %q: %v", raw, err)
+		}
+		u.User = nil
+	}
+	entry.Address = strings.TrimSuffix(u.String(), "/")
+	return entry, nil
+}
+
+func (r *RelayEntry) String() string {
+	return r.Address
+}
+
+const (
+	MediaTypeJSON = "application/json"
+	MediaTypeSSZ  = "application/octet-stream"
+
+	// HeaderConsensusVersion names the fork of request bodies and SSZ encoded responses, which have no version field
+	HeaderConsensusVersion = "Eth-Consensus-Version"
+)
+
+// ErrNoBid is returned when the builder has no bid for the slot.
+var ErrNoBid = errors.New("builder has no bid")
+
+// acceptSSZ prefers SSZ responses, but still accepts JSON from builders without SSZ support.
+var acceptSSZ = MediaTypeSSZ + ";q=1.0," + MediaTypeJSON + ";q=0.9"
+
+func doBuilderRequest(ctx context.Context, method string, url string, body []byte, contentType string, version string, useSSZ bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+		if version != "" {
+			req.Header.Set(HeaderConsensusVersion, version)
+		}
+	}
+	if useSSZ {
+		req.Header.Set("Accept", acceptSSZ)
+	} else {
+		req.Header.Set("Accept", MediaTypeJSON)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// postBuilder posts v to the builder, SSZ encoded if useSSZ is set, with the fork version of v if it has one.
+// Builders that do not support SSZ requests get the JSON encoding instead.
+func postBuilder(ctx context.Context, log logrus.Ext1FieldLogger, url string, v any, marshalSSZ func() ([]byte, error), version string, useSSZ bool) (*http.Response, error) {
+	if useSSZ {
+		body, err := marshalSSZ()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := doBuilderRequest(ctx, "POST", url, body, MediaTypeSSZ, version, true)
+		if err != nil || resp.StatusCode != http.StatusUnsupportedMediaType {
+			return resp, err
+		}
+		resp.Body.Close()
+		log.Debug("Builder does not support SSZ requests, retrying with JSON")
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return doBuilderRequest(ctx, "POST", url, body, MediaTypeJSON, version, useSSZ)
+}
+
+func isSSZResponse(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == MediaTypeSSZ
+}
+
+// MarshalRegistrationsSSZ encodes a list of registrations, which are fixed size, as their concatenation.
+func MarshalRegistrationsSSZ(registrations []*types.SignedValidatorRegistration) ([]byte, error) {
+	buf := make([]byte, 0, len(registrations)*new(types.SignedValidatorRegistration).SizeSSZ())
+	for _, registration := range registrations {
+		var err error
+		if buf, err = registration.MarshalSSZTo(buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalRegistrationsSSZ decodes a list of registrations encoded by MarshalRegistrationsSSZ.
+func UnmarshalRegistrationsSSZ(buf []byte) ([]*types.SignedValidatorRegistration, error) {
+	size := new(types.SignedValidatorRegistration).SizeSSZ()
+	if len(buf)%size != 0 {
+		return nil, fmt.Errorf("SSZ registrations length %d is not a multiple of %d", len(buf), size)
+	}
+	registrations := make([]*types.SignedValidatorRegistration, len(buf)/size)
+	for i := range registrations {
+		registrations[i] = new(types.SignedValidatorRegistration)
+		if err := registrations[i].UnmarshalSSZ(buf[i*size : (i+1)*size]); err != nil {
+			return nil, err
+		}
+	}
+	return registrations, nil
+}
+
+// BuilderStatus checks the builder is ready to give bids.
+func BuilderStatus(ctx context.Context, builderAddr string) error {
+	resp, err := doBuilderRequest(ctx, "GET", builderAddr+"/eth/v1/builder/status", nil, "", "", false)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("builder REST API returned non-200 status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func BuilderRegisterValidators(ctx context.Context, log logrus.Ext1FieldLogger, builderAddr string, registrations []*types.SignedValidatorRegistration, useSSZ bool) error {
+	url := builderAddr + "/eth/v1/builder/validators"
+	marshalSSZ := func() ([]byte, error) { return MarshalRegistrationsSSZ(registrations) }
+	resp, err := postBuilder(ctx, log, url, registrations, marshalSSZ, "", useSSZ)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("builder REST API returned non-200 status code: %d", resp.StatusCode)
+	}
+	log.WithField("count", len(registrations)).Debug("Registered validators")
+	return nil
+}
+
+// BuilderGetHeader requests a bid from the builder, for the fork of the slot, signed for the builder domain. If
+// relayPubkey is set, bids signed by any other key are rejected.
+func BuilderGetHeader(ctx context.Context, log logrus.Ext1FieldLogger, builderAddr string, forks *types.ForkSchedule, domain types.Domain, slot uint64, blockHash common.Hash, pubkey []byte, relayPubkey *types.PublicKey, useSSZ bool) (*types.VersionedSignedBuilderBid, error) {
 	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", slot, blockHash.Hex(), pubkey)
 	url := builderAddr + path
-	resp, err := http.Get(url)
+	resp, err := doBuilderRequest(ctx, "GET", url, nil, "", "", useSSZ)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, ErrNoBid
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("builder REST API returned non-200 status code: %d", resp.StatusCode)
 	}
@@ -31,40 +187,56 @@ func BuilderGetHeader(ctx context.Context, log logrus.Ext1FieldLogger, builderAd
 		return nil, err
 	}
 
-	bid := new(types.GetHeaderResponse)
-	err = json.Unmarshal(body, bid)
+	bid := new(types.VersionedSignedBuilderBid)
+	if isSSZResponse(resp) {
+		bid.Version = resp.Header.Get(HeaderConsensusVersion)
+		err = bid.UnmarshalSSZ(body)
+	} else {
+		err = json.Unmarshal(body, bid)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if version := forks.Version(slot); bid.Version != version {
+		return nil, fmt.Errorf("bid version %q is not the %s fork of the slot", bid.Version, version)
+	}
+	if !bid.Complete() {
+		return nil, errors.New("incomplete bid")
+	}
+	if relayPubkey != nil && bid.Pubkey() != *relayPubkey {
+		return nil, fmt.Errorf("bid signed by untrusted relay key %s", bid.Pubkey())
+	}
 
 	// Verify signature
-	ok, err := types.VerifySignature(bid.Data.Message, types.DomainBuilder, bid.Data.Message.Pubkey[:], bid.Data.Signature[:])
+	builderPubkey, signature := bid.Pubkey(), bid.Signature()
+	ok, err := types.VerifySignature(bid.Message(), domain, builderPubkey[:], signature[:])
 	if !ok || err != nil {
 		log.WithError(err).Warn("Failed to verify header signature")
 		return nil, errors.New("failed to verify header signature")
 	}
 
-	// TODO: we should eventually add a list of "trusted" builders to cross-reference the builder pubkey against
-	return bid.Data.Message.Header, nil
+	return bid, nil
 }
 
-func BuilderGetPayload(ctx context.Context, log logrus.Ext1FieldLogger, sk bls.SecretKey, builderAddr string, signedBlindedBeaconBlock *types.SignedBlindedBeaconBlock) (*types.ExecutionPayloadV1, error) {
-	payloadBytes, err := json.Marshal(signedBlindedBeaconBlock)
+// BuilderGetPayload reveals the signed blinded block to the builder, and returns the payload of the same fork,
+// converted for the engine API.
+func BuilderGetPayload(ctx context.Context, log logrus.Ext1FieldLogger, sk bls.SecretKey, builderAddr string, signedBlindedBeaconBlock *types.VersionedSignedBlindedBeaconBlock, useSSZ bool) (*types.ExecutionPayloadV1, error) {
+	getPayloadResponse, err := BuilderGetVersionedPayload(ctx, log, builderAddr, signedBlindedBeaconBlock, useSSZ)
 	if err != nil {
 		return nil, err
 	}
+	return getPayloadResponse.ELPayload()
+}
 
+// BuilderGetVersionedPayload reveals the signed blinded block to the builder, and returns the payload of the same
+// fork as the builder sent it.
+func BuilderGetVersionedPayload(ctx context.Context, log logrus.Ext1FieldLogger, builderAddr string, signedBlindedBeaconBlock *types.VersionedSignedBlindedBeaconBlock, useSSZ bool) (*types.VersionedExecutionPayload, error) {
 	url := builderAddr + "/eth/v1/builder/blinded_blocks"
-	req, err := http.NewRequest("POST", url, bytes.NewReader(payloadBytes))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := postBuilder(ctx, log, url, signedBlindedBeaconBlock, signedBlindedBeaconBlock.MarshalSSZ, signedBlindedBeaconBlock.Version, useSSZ)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("builder REST API returned non-200 status code: %d", resp.StatusCode)
 	}
@@ -74,16 +246,54 @@ func BuilderGetPayload(ctx context.Context, log logrus.Ext1FieldLogger, sk bls.S
 		return nil, err
 	}
 
-	getPayloadResponse := new(types.GetPayloadResponse)
-	err = json.Unmarshal(body, getPayloadResponse)
+	getPayloadResponse := new(types.VersionedExecutionPayload)
+	if isSSZResponse(resp) {
+		getPayloadResponse.Version = resp.Header.Get(HeaderConsensusVersion)
+		err = getPayloadResponse.UnmarshalSSZ(body)
+	} else {
+		err = json.Unmarshal(body, getPayloadResponse)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if getPayloadResponse.Version != signedBlindedBeaconBlock.Version {
+		return nil, fmt.Errorf("payload version %q does not match block version %q", getPayloadResponse.Version, signedBlindedBeaconBlock.Version)
+	}
+	return getPayloadResponse, nil
+}
 
-	elPayload, err := types.RESTPayloadToELPayload(getPayloadResponse.Data)
+// RelayGetValidators returns the registered proposers of the current and next epoch, for builders.
+func RelayGetValidators(ctx context.Context, relayAddr string) ([]types.BuilderGetValidatorsResponseEntry, error) {
+	resp, err := doBuilderRequest(ctx, "GET", relayAddr+"/relay/v1/builder/validators", nil, "", "", false)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("relay REST API returned non-200 status code: %d", resp.StatusCode)
+	}
+	var entries []types.BuilderGetValidatorsResponseEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
 
-	return elPayload, nil
+// RelaySubmitBlock submits a block of the builder to the relay.
+func RelaySubmitBlock(ctx context.Context, log logrus.Ext1FieldLogger, relayAddr string, submission *types.BuilderSubmitBlockRequest) error {
+	body, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	resp, err := doBuilderRequest(ctx, "POST", relayAddr+"/relay/v1/builder/blocks", body, MediaTypeJSON, "", false)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("relay REST API returned non-200 status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	log.WithField("blockHash", submission.Message.BlockHash).Debug("Submitted block")
+	return nil
 }
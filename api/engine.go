@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
 	"mergemock/rpc"
 	"mergemock/types"
 
@@ -41,6 +43,39 @@ func GetPayloadV1(ctx context.Context, cl *rpc.Client, log logrus.Ext1FieldLogge
 	return &result, nil
 }
 
+// GetPayloadV2 gets a payload without withdrawals, with its block value.
+func GetPayloadV2(ctx context.Context, cl *rpc.Client, log logrus.Ext1FieldLogger, payloadId types.PayloadID) (*types.ExecutionPayloadV1, *big.Int, error) {
+	e := log.WithField("payload_id", payloadId)
+	var result types.GetPayloadV2Response
+	err := cl.CallContext(ctx, &result, "engine_getPayloadV2", payloadId)
+	if err != nil {
+		e.WithError(err).Error("failed to get payload")
+		return nil, nil, err
+	}
+	if result.ExecutionPayload == nil || result.BlockValue == nil {
+		return nil, nil, errors.New("incomplete get-payload response")
+	}
+	e.WithField("value", result.BlockValue).Debug("Received payload")
+	return result.ExecutionPayload, result.BlockValue.ToInt(), nil
+}
+
+// GetPayloadV3 gets a payload with withdrawals with engine_getPayloadV2, or a Deneb payload with its blobs bundle
+// with engine_getPayloadV3, and the block value.
+func GetPayloadV3(ctx context.Context, cl *rpc.Client, log logrus.Ext1FieldLogger, method string, payloadId types.PayloadID) (*types.GetPayloadV3Response, error) {
+	e := log.WithField("payload_id", payloadId).WithField("method", method)
+	var result types.GetPayloadV3Response
+	err := cl.CallContext(ctx, &result, method, payloadId)
+	if err != nil {
+		e.WithError(err).Error("failed to get payload")
+		return nil, err
+	}
+	if result.ExecutionPayload == nil || result.BlockValue == nil {
+		return nil, errors.New("incomplete get-payload response")
+	}
+	e.WithField("value", result.BlockValue).Debug("Received payload")
+	return &result, nil
+}
+
 func NewPayloadV1(ctx context.Context, cl *rpc.Client, log logrus.Ext1FieldLogger, payload *types.ExecutionPayloadV1) (*types.PayloadStatusV1, error) {
 	e := log.WithField("block_hash", payload.BlockHash)
 	var result types.PayloadStatusV1
@@ -79,6 +114,23 @@ func ForkchoiceUpdatedV1(ctx context.Context, cl *rpc.Client, log logrus.Ext1Fie
 	}
 }
 
+// ForkchoiceUpdatedV3 shares a forkchoice update with engine_forkchoiceUpdatedV2, for Capella payload attributes,
+// or engine_forkchoiceUpdatedV3, for Deneb ones.
+func ForkchoiceUpdatedV3(ctx context.Context, cl *rpc.Client, log logrus.Ext1FieldLogger, method string, head, safe, finalized common.Hash, payload *types.PayloadAttributesV3) (types.ForkchoiceUpdatedResult, error) {
+	heads := &types.ForkchoiceStateV1{HeadBlockHash: head, SafeBlockHash: safe, FinalizedBlockHash: finalized}
+
+	e := log.WithField("head", head).WithField("safe", safe).WithField("finalized", finalized).WithField("method", method)
+	e.Debug("Sharing forkchoice-updated signal")
+
+	var result types.ForkchoiceUpdatedResult
+	if err := cl.CallContext(ctx, &result, method, &heads, &payload); err != nil {
+		e.WithError(err).Error("Failed to share forkchoice-updated signal")
+		return result, err
+	}
+	e.WithField("payloadId", result.PayloadID).WithField("status", result.PayloadStatus).Debug("Shared forkchoice-updated signal")
+	return result, nil
+}
+
 func BlockToPayload(b *ethTypes.Block) (*types.ExecutionPayloadV1, error) {
 	extra := b.Extra()
 	if len(extra) > 32 {
@@ -0,0 +1,995 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mergemock/api"
+	"mergemock/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Routes of the beacon API stand-in, the subset of the beacon node API that validator clients and mev-boost use.
+const (
+	pathNodeVersion           = "/eth/v1/node/version"
+	pathNodeSyncing           = "/eth/v1/node/syncing"
+	pathNodeHealth            = "/eth/v1/node/health"
+	pathConfigSpec            = "/eth/v1/config/spec"
+	pathGenesis               = "/eth/v1/beacon/genesis"
+	pathStateFork             = "/eth/v1/beacon/states/{state_id}/fork"
+	pathHeaders               = "/eth/v1/beacon/headers"
+	pathHeader                = "/eth/v1/beacon/headers/{block_id}"
+	pathPublishBlock          = "/eth/v1/beacon/blocks"
+	pathPublishBlindedBlock   = "/eth/v1/beacon/blinded_blocks"
+	pathProposerDuties        = "/eth/v1/validator/duties/proposer/{epoch:[0-9]+}"
+	pathProduceBlock          = "/eth/v2/validator/blocks/{slot:[0-9]+}"
+	pathProduceBlindedBlock   = "/eth/v1/validator/blinded_blocks/{slot:[0-9]+}"
+	pathEvents                = "/eth/v1/events"
+	topicHead                 = "head"
+	topicPayloadAttributes    = "payload_attributes"
+	beaconSlotsKept           = 8192
+	beaconEventsBuffered      = 16
+	beaconNodeVersion         = "mergemock/beacon-stand-in"
+	beaconProducedPayloadKept = 64
+)
+
+var (
+	errNotStarted      = errors.New("the consensus mock has no chain yet")
+	errUnknownBlock    = errors.New("unknown block")
+	errUnknownTopic    = errors.New("unknown event topic")
+	errUnknownPayload  = errors.New("no block with this payload was produced")
+	errWrongProposer   = errors.New("block is not from the proposer of the slot")
+	errNoStreaming     = errors.New("streaming unsupported")
+	errSlotNotAhead    = errors.New("slot is not after the head")
+	errSlotTaken       = errors.New("slot is proposed by the consensus mock")
+	errNotOnHead       = errors.New("block does not build on the head")
+	errInvalidRandao   = errors.New("invalid randao reveal")
+	errInvalidGraffiti = errors.New("invalid graffiti")
+)
+
+// beaconBlock is a block of the beacon chain view, with its execution block.
+type beaconBlock struct {
+	Root        types.Root
+	Header      *types.SignedBeaconBlockHeader
+	BlockHash   common.Hash
+	BlockNumber uint64
+}
+
+// slotClaim is who proposes a slot: the consensus mock itself, or a validator client through the beacon API.
+type slotClaim uint8
+
+const (
+	claimMock slotClaim = iota + 1
+	claimBeaconAPI
+)
+
+type beaconEvent struct {
+	topic string
+	data  interface{}
+}
+
+// beaconChain is the view of the beacon chain that the beacon API stand-in serves. The consensus mock has no beacon
+// blocks: the blocks it makes itself get a header made up from their execution block, only blocks published to the
+// beacon API have real headers.
+type beaconChain struct {
+	slotsPerEpoch uint64
+
+	mu      sync.RWMutex
+	blocks  map[types.Root]*beaconBlock
+	byHash  map[common.Hash]types.Root // beacon block of each execution block
+	bySlot  map[uint64]types.Root      // latest block added for each slot
+	claims  map[uint64]slotClaim       // who proposes each slot, so that only one block is made for it
+	genesis *beaconBlock
+	head    *beaconBlock
+	subs    map[chan beaconEvent]struct{}
+
+	// safe and finalized execution blocks, as last sent to the engine
+	safe, finalized common.Hash
+}
+
+func newBeaconChain(slotsPerEpoch uint64) *beaconChain {
+	return &beaconChain{
+		slotsPerEpoch: slotsPerEpoch,
+		blocks:        make(map[types.Root]*beaconBlock),
+		byHash:        make(map[common.Hash]types.Root),
+		bySlot:        make(map[uint64]types.Root),
+		claims:        make(map[uint64]slotClaim),
+		subs:          make(map[chan beaconEvent]struct{}),
+	}
+}
+
+// addMockBlock adds a block of the consensus mock, with a header made up from the execution block: its state root,
+// and its hash as body root.
+func (bc *beaconChain) addMockBlock(slot uint64, proposerIndex uint64, block *ethTypes.Header) *beaconBlock {
+	header := &types.BeaconBlockHeader{
+		Slot:          slot,
+		ProposerIndex: proposerIndex,
+		ParentRoot:    bc.rootOf(block.ParentHash),
+		StateRoot:     types.Root(block.Root),
+		BodyRoot:      types.Root(block.Hash()),
+	}
+	return bc.addBlock(&types.SignedBeaconBlockHeader{Header: header}, block)
+}
+
+// addBlock adds the block as the new head, and sends a head event.
+func (bc *beaconChain) addBlock(header *types.SignedBeaconBlockHeader, block *ethTypes.Header) *beaconBlock {
+	b := newBeaconBlock(header, block)
+	bc.mu.Lock()
+	event := bc.setHead(b)
+	bc.mu.Unlock()
+
+	bc.publish(topicHead, event)
+	return b
+}
+
+// addChild adds the block as the new head if it builds on the current head, and sends a head event.
+// Published blocks are added this way, so that they never compete with a block of the consensus mock.
+func (bc *beaconChain) addChild(header *types.SignedBeaconBlockHeader, block *ethTypes.Header) (*beaconBlock, error) {
+	b := newBeaconBlock(header, block)
+	bc.mu.Lock()
+	if bc.head == nil || bc.head.Root != header.Header.ParentRoot {
+		bc.mu.Unlock()
+		return nil, errNotOnHead
+	}
+	event := bc.setHead(b)
+	bc.mu.Unlock()
+
+	bc.publish(topicHead, event)
+	return b, nil
+}
+
+func newBeaconBlock(header *types.SignedBeaconBlockHeader, block *ethTypes.Header) *beaconBlock {
+	root, _ := header.Header.HashTreeRoot()
+	return &beaconBlock{Root: root, Header: header, BlockHash: block.Hash(), BlockNumber: block.Number.Uint64()}
+}
+
+// setHead adds the block as the new head, and returns the head event for it. The caller holds the lock.
+func (bc *beaconChain) setHead(b *beaconBlock) *headEvent {
+	root, header := b.Root, b.Header
+	slot := header.Header.Slot
+	epoch := slot / bc.slotsPerEpoch
+
+	bc.blocks[root] = b
+	bc.byHash[b.BlockHash] = root
+	bc.bySlot[slot] = root
+	if slot >= beaconSlotsKept {
+		if old, ok := bc.bySlot[slot-beaconSlotsKept]; ok {
+			delete(bc.byHash, bc.blocks[old].BlockHash)
+			delete(bc.blocks, old)
+			delete(bc.bySlot, slot-beaconSlotsKept)
+		}
+	}
+	if bc.genesis == nil {
+		bc.genesis = b
+	}
+	bc.head = b
+	event := &headEvent{
+		Slot:                     slot,
+		Block:                    root,
+		State:                    header.Header.StateRoot,
+		EpochTransition:          slot%bc.slotsPerEpoch == 0,
+		CurrentDutyDependentRoot: bc.dependentRoot(epoch),
+	}
+	if epoch > 0 {
+		event.PreviousDutyDependentRoot = bc.dependentRoot(epoch - 1)
+	} else {
+		event.PreviousDutyDependentRoot = bc.genesis.Root
+	}
+	return event
+}
+
+// claimSlot makes the claimant the proposer of the slot, unless another one claimed it first.
+func (bc *beaconChain) claimSlot(slot uint64, claimant slotClaim) bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if claim, ok := bc.claims[slot]; ok {
+		return claim == claimant
+	}
+	bc.claims[slot] = claimant
+	if slot >= beaconSlotsKept {
+		delete(bc.claims, slot-beaconSlotsKept)
+	}
+	return true
+}
+
+func (bc *beaconChain) setCheckpoints(safe, finalized common.Hash) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.safe, bc.finalized = safe, finalized
+}
+
+func (bc *beaconChain) checkpoints() (safe, finalized common.Hash) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.safe, bc.finalized
+}
+
+// dependentRoot is the root of the last block before the epoch, which the proposer duties of the epoch depend on.
+// The caller holds the lock.
+func (bc *beaconChain) dependentRoot(epoch uint64) types.Root {
+	for slot := epoch * bc.slotsPerEpoch; slot > 0; slot-- {
+		if root, ok := bc.bySlot[slot-1]; ok {
+			return root
+		}
+	}
+	if bc.genesis == nil {
+		return types.Root{}
+	}
+	return bc.genesis.Root
+}
+
+// rootOf returns the root of the beacon block of the execution block, or a zero root if it is unknown.
+func (bc *beaconChain) rootOf(hash common.Hash) types.Root {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.byHash[hash]
+}
+
+func (bc *beaconChain) known(root types.Root) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	_, ok := bc.blocks[root]
+	return ok
+}
+
+func (bc *beaconChain) headBlock() *beaconBlock {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.head
+}
+
+// block finds a block by id: head, genesis, a slot or a root.
+func (bc *beaconChain) block(id string) (*beaconBlock, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	var b *beaconBlock
+	switch {
+	case id == "head":
+		b = bc.head
+	case id == "genesis":
+		b = bc.genesis
+	case strings.HasPrefix(id, "0x"):
+		var root types.Root
+		if err := root.UnmarshalText([]byte(id)); err != nil {
+			return nil, err
+		}
+		b = bc.blocks[root]
+	default:
+		slot, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, errInvalidSlot
+		}
+		if root, ok := bc.bySlot[slot]; ok {
+			b = bc.blocks[root]
+		}
+	}
+	if b == nil {
+		return nil, errUnknownBlock
+	}
+	return b, nil
+}
+
+func (bc *beaconChain) subscribe() chan beaconEvent {
+	ch := make(chan beaconEvent, beaconEventsBuffered)
+	bc.mu.Lock()
+	bc.subs[ch] = struct{}{}
+	bc.mu.Unlock()
+	return ch
+}
+
+func (bc *beaconChain) unsubscribe(ch chan beaconEvent) {
+	bc.mu.Lock()
+	delete(bc.subs, ch)
+	bc.mu.Unlock()
+}
+
+// publish sends the event to all subscribers. Subscribers that fall behind miss events.
+func (bc *beaconChain) publish(topic string, data interface{}) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	for ch := range bc.subs {
+		select {
+		case ch <- beaconEvent{topic, data}:
+		default:
+		}
+	}
+}
+
+// headEvent https://github.com/ethereum/beacon-APIs/blob/master/apis/eventstream/index.yaml
+type headEvent struct {
+	Slot                      uint64     `json:"slot,string"`
+	Block                     types.Root `json:"block"`
+	State                     types.Root `json:"state"`
+	EpochTransition           bool       `json:"epoch_transition"`
+	PreviousDutyDependentRoot types.Root `json:"previous_duty_dependent_root"`
+	CurrentDutyDependentRoot  types.Root `json:"current_duty_dependent_root"`
+	ExecutionOptimistic       bool       `json:"execution_optimistic"`
+}
+
+// payloadAttributesEvent https://github.com/ethereum/beacon-APIs/blob/master/apis/eventstream/index.yaml
+type payloadAttributesEvent struct {
+	Version string                     `json:"version"`
+	Data    payloadAttributesEventData `json:"data"`
+}
+
+type payloadAttributesEventData struct {
+	ProposerIndex     uint64                 `json:"proposer_index,string"`
+	ProposalSlot      uint64                 `json:"proposal_slot,string"`
+	ParentBlockNumber uint64                 `json:"parent_block_number,string"`
+	ParentBlockRoot   types.Root             `json:"parent_block_root"`
+	ParentBlockHash   common.Hash            `json:"parent_block_hash"`
+	PayloadAttributes eventPayloadAttributes `json:"payload_attributes"`
+}
+
+// eventPayloadAttributes are the payload attributes of the fork: withdrawals are null before Capella, and there is
+// only a parent beacon block root from Deneb.
+type eventPayloadAttributes struct {
+	Timestamp             uint64              `json:"timestamp,string"`
+	PrevRandao            common.Hash         `json:"prev_randao"`
+	SuggestedFeeRecipient common.Address      `json:"suggested_fee_recipient"`
+	Withdrawals           []*types.Withdrawal `json:"withdrawals"`
+	ParentBeaconBlockRoot *types.Root         `json:"parent_beacon_block_root,omitempty"`
+}
+
+// beaconResponse is the envelope of beacon API responses.
+type beaconResponse struct {
+	Version             string      `json:"version,omitempty"`
+	DependentRoot       *types.Root `json:"dependent_root,omitempty"`
+	ExecutionOptimistic bool        `json:"execution_optimistic"`
+	Data                interface{} `json:"data"`
+}
+
+type beaconGenesis struct {
+	GenesisTime           uint64            `json:"genesis_time,string"`
+	GenesisValidatorsRoot types.Root        `json:"genesis_validators_root"`
+	GenesisForkVersion    types.ForkVersion `json:"genesis_fork_version"`
+}
+
+type beaconFork struct {
+	PreviousVersion types.ForkVersion `json:"previous_version"`
+	CurrentVersion  types.ForkVersion `json:"current_version"`
+	Epoch           uint64            `json:"epoch,string"`
+}
+
+type beaconHeader struct {
+	Root      types.Root                     `json:"root"`
+	Canonical bool                           `json:"canonical"`
+	Header    *types.SignedBeaconBlockHeader `json:"header"`
+}
+
+type proposerDuty struct {
+	Pubkey         types.PublicKey `json:"pubkey"`
+	ValidatorIndex uint64          `json:"validator_index,string"`
+	Slot           uint64          `json:"slot,string"`
+}
+
+type syncingStatus struct {
+	HeadSlot     uint64 `json:"head_slot,string"`
+	SyncDistance uint64 `json:"sync_distance,string"`
+	IsSyncing    bool   `json:"is_syncing"`
+	IsOptimistic bool   `json:"is_optimistic"`
+	ELOffline    bool   `json:"el_offline"`
+}
+
+// producedPayload is the payload of a produced blinded block, or the relay that has it.
+type producedPayload struct {
+	payload *types.ExecutionPayloadV1
+	relay   *api.RelayEntry
+}
+
+func (c *ConsensusCmd) startBeaconAPI(log *logrus.Logger) {
+	c.beaconSrv = &http.Server{
+		Addr:              c.BeaconAddr,
+		Handler:           LoggingMiddleware(c.beaconRouter(), log),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.WithField("listenAddr", c.BeaconAddr).Info("Beacon API started")
+	go func() {
+		if err := c.beaconSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("Beacon API failed")
+		}
+	}()
+}
+
+func (c *ConsensusCmd) beaconRouter() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc(pathNodeVersion, c.handleNodeVersion).Methods(http.MethodGet)
+	router.HandleFunc(pathNodeSyncing, c.handleNodeSyncing).Methods(http.MethodGet)
+	router.HandleFunc(pathNodeHealth, c.handleNodeHealth).Methods(http.MethodGet)
+	router.HandleFunc(pathConfigSpec, c.handleConfigSpec).Methods(http.MethodGet)
+	router.HandleFunc(pathGenesis, c.handleGenesis).Methods(http.MethodGet)
+	router.HandleFunc(pathStateFork, c.handleStateFork).Methods(http.MethodGet)
+	router.HandleFunc(pathHeaders, c.handleHeaders).Methods(http.MethodGet)
+	router.HandleFunc(pathHeader, c.handleHeader).Methods(http.MethodGet)
+	router.HandleFunc(pathPublishBlock, c.handlePublishBlock).Methods(http.MethodPost)
+	router.HandleFunc(pathPublishBlindedBlock, c.handlePublishBlindedBlock).Methods(http.MethodPost)
+	router.HandleFunc(pathProposerDuties, c.handleProposerDuties).Methods(http.MethodGet)
+	router.HandleFunc(pathProduceBlock, c.handleProduceBlock).Methods(http.MethodGet)
+	router.HandleFunc(pathProduceBlindedBlock, c.handleProduceBlindedBlock).Methods(http.MethodGet)
+	router.HandleFunc(pathEvents, c.handleEvents).Methods(http.MethodGet)
+	return router
+}
+
+// beaconError writes an error in the format of the beacon API.
+func beaconError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{code, err.Error()})
+}
+
+func (c *ConsensusCmd) handleNodeVersion(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, &beaconResponse{Data: map[string]string{"version": beaconNodeVersion}})
+}
+
+// handleNodeSyncing reports the node synced once the consensus mock has a chain.
+func (c *ConsensusCmd) handleNodeSyncing(w http.ResponseWriter, req *http.Request) {
+	status := &syncingStatus{IsSyncing: true}
+	if head := c.beacon.headBlock(); head != nil {
+		status.HeadSlot, status.IsSyncing = head.Header.Header.Slot, false
+	}
+	writeJSON(w, &beaconResponse{Data: status})
+}
+
+func (c *ConsensusCmd) handleNodeHealth(w http.ResponseWriter, req *http.Request) {
+	if c.beacon.headBlock() == nil {
+		w.WriteHeader(http.StatusPartialContent)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleConfigSpec returns the part of the spec config that the consensus mock knows about.
+func (c *ConsensusCmd) handleConfigSpec(w http.ResponseWriter, req *http.Request) {
+	spec := map[string]string{
+		"CONFIG_NAME":            c.network.Name,
+		"SECONDS_PER_SLOT":       strconv.FormatUint(uint64(c.SlotTime/time.Second), 10),
+		"SLOTS_PER_EPOCH":        strconv.FormatUint(c.SlotsPerEpoch, 10),
+		"GENESIS_FORK_VERSION":   c.network.GenesisForkVersion.String(),
+		"BELLATRIX_FORK_VERSION": c.network.BellatrixForkVersion.String(),
+		"BELLATRIX_FORK_EPOCH":   "0",
+		"CAPELLA_FORK_VERSION":   c.network.CapellaForkVersion.String(),
+		"CAPELLA_FORK_EPOCH":     strconv.FormatUint(c.CapellaForkEpoch, 10),
+		"DENEB_FORK_VERSION":     c.network.DenebForkVersion.String(),
+		"DENEB_FORK_EPOCH":       strconv.FormatUint(c.DenebForkEpoch, 10),
+	}
+	writeJSON(w, &beaconResponse{Data: spec})
+}
+
+func (c *ConsensusCmd) handleGenesis(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, &beaconResponse{Data: &beaconGenesis{
+		GenesisTime:           c.BeaconGenesisTime,
+		GenesisValidatorsRoot: c.genesisValidatorsRoot,
+		GenesisForkVersion:    c.network.GenesisForkVersion,
+	}})
+}
+
+// handleStateFork returns the fork of the state at a slot, or at the head for any other state id.
+func (c *ConsensusCmd) handleStateFork(w http.ResponseWriter, req *http.Request) {
+	slot, err := strconv.ParseUint(mux.Vars(req)["state_id"], 10, 64)
+	if err != nil {
+		head := c.beacon.headBlock()
+		if head == nil {
+			beaconError(w, http.StatusServiceUnavailable, errNotStarted)
+			return
+		}
+		slot = head.Header.Header.Slot
+	}
+	writeJSON(w, &beaconResponse{Data: c.fork(slot)})
+}
+
+// fork returns the fork of the slot. The consensus mock starts at Bellatrix.
+func (c *ConsensusCmd) fork(slot uint64) *beaconFork {
+	switch c.forks.Version(slot) {
+	case types.VersionDeneb:
+		return &beaconFork{c.network.CapellaForkVersion, c.network.DenebForkVersion, c.DenebForkEpoch}
+	case types.VersionCapella:
+		return &beaconFork{c.network.BellatrixForkVersion, c.network.CapellaForkVersion, c.CapellaForkEpoch}
+	default:
+		return &beaconFork{c.network.BellatrixForkVersion, c.network.BellatrixForkVersion, 0}
+	}
+}
+
+// handleHeaders returns the header of the block at the slot query parameter, or of the head.
+func (c *ConsensusCmd) handleHeaders(w http.ResponseWriter, req *http.Request) {
+	id := req.URL.Query().Get("slot")
+	if id == "" {
+		id = "head"
+	}
+	headers := []*beaconHeader{}
+	if b, err := c.beacon.block(id); err == nil {
+		headers = append(headers, &beaconHeader{Root: b.Root, Canonical: true, Header: b.Header})
+	} else if err != errUnknownBlock {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, &beaconResponse{Data: headers})
+}
+
+func (c *ConsensusCmd) handleHeader(w http.ResponseWriter, req *http.Request) {
+	b, err := c.beacon.block(mux.Vars(req)["block_id"])
+	if err == errUnknownBlock {
+		beaconError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, &beaconResponse{Data: &beaconHeader{Root: b.Root, Canonical: true, Header: b.Header}})
+}
+
+func (c *ConsensusCmd) handleProposerDuties(w http.ResponseWriter, req *http.Request) {
+	epoch, err := strconv.ParseUint(mux.Vars(req)["epoch"], 10, 64)
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	duties := make([]*proposerDuty, 0, c.SlotsPerEpoch)
+	for i, index := range c.validators.ProposerDuties(epoch) {
+		v := c.validators.ByIndex(index)
+		duties = append(duties, &proposerDuty{Pubkey: v.Pubkey, ValidatorIndex: v.Index, Slot: epoch*c.SlotsPerEpoch + uint64(i)})
+	}
+	c.beacon.mu.RLock()
+	dependentRoot := c.beacon.dependentRoot(epoch)
+	c.beacon.mu.RUnlock()
+	writeJSON(w, &beaconResponse{DependentRoot: &dependentRoot, Data: duties})
+}
+
+func (c *ConsensusCmd) handleProduceBlock(w http.ResponseWriter, req *http.Request) {
+	c.produceBlock(w, req, false)
+}
+
+func (c *ConsensusCmd) handleProduceBlindedBlock(w http.ResponseWriter, req *http.Request) {
+	c.produceBlock(w, req, true)
+}
+
+// produceBlock makes a block for the proposer of the slot on top of the head, with a payload built by the mock chain.
+// Blinded blocks take the best bid of the relays instead, if there is one.
+func (c *ConsensusCmd) produceBlock(w http.ResponseWriter, req *http.Request, blinded bool) {
+	slot, err := strconv.ParseUint(mux.Vars(req)["slot"], 10, 64)
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, errInvalidSlot)
+		return
+	}
+	head := c.beacon.headBlock()
+	if head == nil {
+		beaconError(w, http.StatusServiceUnavailable, errNotStarted)
+		return
+	}
+	if slot <= head.Header.Header.Slot {
+		beaconError(w, http.StatusBadRequest, errSlotNotAhead)
+		return
+	}
+	if !c.beacon.claimSlot(slot, claimBeaconAPI) {
+		beaconError(w, http.StatusBadRequest, errSlotTaken)
+		return
+	}
+	query := req.URL.Query()
+	var randaoReveal types.Signature
+	if err := randaoReveal.UnmarshalText([]byte(query.Get("randao_reveal"))); err != nil {
+		beaconError(w, http.StatusBadRequest, errInvalidRandao)
+		return
+	}
+	var graffiti types.Hash
+	if g := query.Get("graffiti"); g != "" {
+		if err := graffiti.UnmarshalText([]byte(g)); err != nil {
+			beaconError(w, http.StatusBadRequest, errInvalidGraffiti)
+			return
+		}
+	}
+	parent := c.mockChain.chain.GetHeaderByHash(head.BlockHash)
+	if parent == nil {
+		beaconError(w, http.StatusInternalServerError, errNoHead)
+		return
+	}
+	proposer := c.validators.Proposer(slot)
+	log := c.log.WithField("slot", slot).WithField("proposer", proposer.Index)
+	fields := &blockFields{slot: slot, proposerIndex: proposer.Index, parentRoot: head.Root, randaoReveal: randaoReveal, graffiti: graffiti}
+	version := c.forks.Version(slot)
+
+	var (
+		relay *api.RelayEntry
+		bid   *types.VersionedSignedBuilderBid
+	)
+	if blinded && len(c.relays) > 0 {
+		if relay, bid, err = c.getBestBid(req.Context(), log, slot, parent.Hash(), proposer); err != nil {
+			log.WithError(err).Warn("Builder bid unavailable, producing a local block")
+		}
+	}
+	var payload *types.ExecutionPayloadV1
+	if bid == nil {
+		block, err := c.buildBlock(slot, proposer, parent, false)
+		if err != nil {
+			beaconError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if payload, err = api.BlockToPayload(block); err != nil {
+			beaconError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	w.Header().Set(api.HeaderConsensusVersion, version)
+	if !blinded {
+		block, err := beaconBlockForPayload(fields, version, payload)
+		if err != nil {
+			beaconError(w, http.StatusInternalServerError, err)
+			return
+		}
+		log.WithField("blockhash", payload.BlockHash).Info("Produced block")
+		writeJSON(w, block)
+		return
+	}
+	if bid == nil {
+		if bid, err = newBuilderBid(types.PublicKey{}, version, payload, nil, types.U256Str{}); err != nil {
+			beaconError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	block, err := blindedBlockForBid(fields, bid)
+	if err != nil {
+		beaconError(w, http.StatusInternalServerError, err)
+		return
+	}
+	blockHash := common.Hash(bid.BlockHash())
+	c.produced.Add(blockHash, &producedPayload{payload: payload, relay: relay})
+	log.WithField("blockhash", blockHash).WithField("relay", relay).Info("Produced blinded block")
+	writeJSON(w, &beaconResponse{Version: version, Data: block.Message()})
+}
+
+// beaconBlockForPayload makes an unsigned full block of the fork, with the payload.
+func beaconBlockForPayload(f *blockFields, version string, payload *types.ExecutionPayloadV1) (*types.VersionedBeaconBlock, error) {
+	p, err := types.ELToVersionedPayload(version, payload, nil)
+	if err != nil {
+		return nil, err
+	}
+	block := &types.VersionedBeaconBlock{Version: version}
+	switch version {
+	case types.VersionBellatrix:
+		block.Bellatrix = &types.BeaconBlock{
+			Slot:          f.slot,
+			ProposerIndex: f.proposerIndex,
+			ParentRoot:    f.parentRoot,
+			StateRoot:     f.stateRoot,
+			Body: &types.BeaconBlockBody{
+				RandaoReveal:      f.randaoReveal,
+				Eth1Data:          &types.Eth1Data{},
+				Graffiti:          f.graffiti,
+				ProposerSlashings: []*types.ProposerSlashing{},
+				AttesterSlashings: []*types.AttesterSlashing{},
+				Attestations:      []*types.Attestation{},
+				Deposits:          []*types.Deposit{},
+				VoluntaryExits:    []*types.VoluntaryExit{},
+				SyncAggregate:     &types.SyncAggregate{},
+				ExecutionPayload:  p.Bellatrix,
+			},
+		}
+	case types.VersionCapella:
+		block.Capella = &types.BeaconBlockCapella{
+			Slot:          f.slot,
+			ProposerIndex: f.proposerIndex,
+			ParentRoot:    f.parentRoot,
+			StateRoot:     f.stateRoot,
+			Body: &types.BeaconBlockBodyCapella{
+				RandaoReveal:          f.randaoReveal,
+				Eth1Data:              &types.Eth1Data{},
+				Graffiti:              f.graffiti,
+				ProposerSlashings:     []*types.ProposerSlashing{},
+				AttesterSlashings:     []*types.AttesterSlashing{},
+				Attestations:          []*types.Attestation{},
+				Deposits:              []*types.Deposit{},
+				VoluntaryExits:        []*types.VoluntaryExit{},
+				SyncAggregate:         &types.SyncAggregate{},
+				ExecutionPayload:      p.Capella,
+				BLSToExecutionChanges: []*types.SignedBLSToExecutionChange{},
+			},
+		}
+	default:
+		block.Deneb = &types.BlockContentsDeneb{
+			Block: &types.BeaconBlockDeneb{
+				Slot:          f.slot,
+				ProposerIndex: f.proposerIndex,
+				ParentRoot:    f.parentRoot,
+				StateRoot:     f.stateRoot,
+				Body: &types.BeaconBlockBodyDeneb{
+					RandaoReveal:          f.randaoReveal,
+					Eth1Data:              &types.Eth1Data{},
+					Graffiti:              f.graffiti,
+					ProposerSlashings:     []*types.ProposerSlashing{},
+					AttesterSlashings:     []*types.AttesterSlashing{},
+					Attestations:          []*types.Attestation{},
+					Deposits:              []*types.Deposit{},
+					VoluntaryExits:        []*types.VoluntaryExit{},
+					SyncAggregate:         &types.SyncAggregate{},
+					ExecutionPayload:      p.Deneb.ExecutionPayload,
+					BLSToExecutionChanges: []*types.SignedBLSToExecutionChange{},
+					BlobKzgCommitments:    []types.KZGCommitment{},
+				},
+			},
+			KZGProofs: []types.KZGProof{},
+			Blobs:     []types.Blob{},
+		}
+	}
+	return block, nil
+}
+
+// handlePublishBlock imports a signed full block, which must fit the engine API V1.
+func (c *ConsensusCmd) handlePublishBlock(w http.ResponseWriter, req *http.Request) {
+	if c.beacon.headBlock() == nil {
+		beaconError(w, http.StatusServiceUnavailable, errNotStarted)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	version := req.Header.Get(api.HeaderConsensusVersion)
+	if version == "" {
+		slot, err := signedBlockSlot(body)
+		if err != nil {
+			beaconError(w, http.StatusBadRequest, err)
+			return
+		}
+		version = c.forks.Version(slot)
+	}
+	block := &types.VersionedSignedBeaconBlock{Version: version}
+	if err := json.Unmarshal(body, block); err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	blinded, err := block.Blinded()
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := c.verifyProposal(blinded); err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	p, err := block.Payload()
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, err := p.ELPayload()
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := c.importBlock(req.Context(), blinded, payload); err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// signedBlockSlot reads the slot of a signed full block, or of the signed block of Deneb block contents.
+func signedBlockSlot(body []byte) (uint64, error) {
+	type message struct {
+		Slot uint64 `json:"slot,string"`
+	}
+	var block struct {
+		Message     *message `json:"message"`
+		SignedBlock *struct {
+			Message *message `json:"message"`
+		} `json:"signed_block"`
+	}
+	if err := json.Unmarshal(body, &block); err != nil {
+		return 0, err
+	}
+	switch {
+	case block.Message != nil:
+		return block.Message.Slot, nil
+	case block.SignedBlock != nil && block.SignedBlock.Message != nil:
+		return block.SignedBlock.Message.Slot, nil
+	}
+	return 0, errors.New("missing block message")
+}
+
+// handlePublishBlindedBlock imports a signed blinded block that was produced by the beacon API, revealing it to the
+// relay of its bid if it has one.
+func (c *ConsensusCmd) handlePublishBlindedBlock(w http.ResponseWriter, req *http.Request) {
+	if c.beacon.headBlock() == nil {
+		beaconError(w, http.StatusServiceUnavailable, errNotStarted)
+		return
+	}
+	isSSZ, err := requestIsSSZ(req)
+	if err != nil {
+		beaconError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	block, err := decodeBlindedBlock(&c.forks, body, req.Header.Get(api.HeaderConsensusVersion), isSSZ)
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !block.Complete() {
+		beaconError(w, http.StatusBadRequest, errors.New("incomplete blinded block"))
+		return
+	}
+	proposer, err := c.verifyProposal(block)
+	if err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	blockHash := common.Hash(block.BlockHash())
+	cached, ok := c.produced.Get(blockHash)
+	if !ok {
+		beaconError(w, http.StatusBadRequest, errUnknownPayload)
+		return
+	}
+	produced := cached.(*producedPayload)
+	payload := produced.payload
+	if produced.relay != nil {
+		log := c.log.WithField("slot", block.Slot()).WithField("relay", produced.relay)
+		if payload, err = api.BuilderGetPayload(req.Context(), log, proposer.sk, produced.relay.Address, block, c.BuilderSSZ); err != nil {
+			beaconError(w, http.StatusBadGateway, err)
+			return
+		}
+		if payload.BlockHash != blockHash {
+			beaconError(w, http.StatusBadGateway, fmt.Errorf("builder payload %s does not match block %s", payload.BlockHash, blockHash))
+			return
+		}
+	}
+	if err := c.importBlock(req.Context(), block, payload); err != nil {
+		beaconError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// verifyProposal checks the block is of the fork of its slot, and signed by the proposer of the slot.
+func (c *ConsensusCmd) verifyProposal(block *types.VersionedSignedBlindedBeaconBlock) (*Validator, error) {
+	slot := block.Slot()
+	if version := c.forks.Version(slot); block.Version != version {
+		return nil, fmt.Errorf("block version %q is not the %s fork of the slot", block.Version, version)
+	}
+	proposer := c.validators.Proposer(slot)
+	if block.ProposerIndex() != proposer.Index {
+		return nil, errWrongProposer
+	}
+	domain, err := c.network.ProposerDomain(block.Version, &c.genesisValidatorsRoot)
+	if err != nil {
+		return nil, err
+	}
+	signature := block.Signature()
+	ok, err := types.VerifySignature(block.Message(), domain, proposer.Pubkey[:], signature[:])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidSignature
+	}
+	return proposer, nil
+}
+
+// importBlock adds the payload of a published block to the mock chain and sends it to the engine, and makes the
+// block the head of the beacon chain view and of the engine. The block must build on the head.
+func (c *ConsensusCmd) importBlock(ctx context.Context, block *types.VersionedSignedBlindedBeaconBlock, payload *types.ExecutionPayloadV1) error {
+	header, err := block.BeaconHeader()
+	if err != nil {
+		return err
+	}
+	root, err := header.Header.HashTreeRoot()
+	if err != nil {
+		return err
+	}
+	if c.beacon.known(root) {
+		// Already imported
+		return nil
+	}
+	if head := c.beacon.headBlock(); head.Root != header.Header.ParentRoot {
+		return errNotOnHead
+	}
+	log := c.log.WithField("slot", block.Slot()).WithField("blockhash", payload.BlockHash)
+	executionBlock, err := c.mockChain.ProcessPayload(payload)
+	if err != nil {
+		return err
+	}
+	res, err := api.NewPayloadV1(ctx, c.engine, log, payload)
+	if err != nil {
+		return err
+	}
+	if res.Status == types.ExecutionInvalid {
+		return fmt.Errorf("engine considers the payload invalid: %v", res.ValidationError)
+	}
+	if _, err := c.beacon.addChild(header, executionBlock.Header()); err != nil {
+		return err
+	}
+	safe, finalized := c.beacon.checkpoints()
+	if _, err := c.sendForkchoiceUpdated(payload.BlockHash, safe, finalized, nil); err != nil {
+		return err
+	}
+	log.Info("Imported published block")
+	return nil
+}
+
+// handleEvents streams the events of the requested topics as server-sent events.
+func (c *ConsensusCmd) handleEvents(w http.ResponseWriter, req *http.Request) {
+	topics := make(map[string]bool)
+	for _, value := range req.URL.Query()["topics"] {
+		for _, topic := range strings.Split(value, ",") {
+			if topic != topicHead && topic != topicPayloadAttributes {
+				beaconError(w, http.StatusBadRequest, fmt.Errorf("%w: %s", errUnknownTopic, topic))
+				return
+			}
+			topics[topic] = true
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		beaconError(w, http.StatusInternalServerError, errNoStreaming)
+		return
+	}
+	events := c.beacon.subscribe()
+	defer c.beacon.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case event := <-events:
+			if !topics[event.topic] {
+				continue
+			}
+			data, err := json.Marshal(event.data)
+			if err != nil {
+				c.log.WithError(err).Error("Failed to encode event")
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.topic, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// publishPayloadAttributes sends a payload attributes event for the attributes the engine is building a payload with.
+func (c *ConsensusCmd) publishPayloadAttributes(slot uint64, parent *ethTypes.Header, attributes *types.PayloadAttributesV1) {
+	parentRoot := c.beacon.rootOf(parent.Hash())
+	event := &payloadAttributesEvent{
+		Version: c.forks.Version(slot),
+		Data: payloadAttributesEventData{
+			ProposerIndex:     c.validators.Proposer(slot).Index,
+			ProposalSlot:      slot,
+			ParentBlockNumber: parent.Number.Uint64(),
+			ParentBlockRoot:   parentRoot,
+			ParentBlockHash:   parent.Hash(),
+			PayloadAttributes: eventPayloadAttributes{
+				Timestamp:             attributes.Timestamp,
+				PrevRandao:            attributes.PrevRandao,
+				SuggestedFeeRecipient: attributes.SuggestedFeeRecipient,
+			},
+		},
+	}
+	switch event.Version {
+	case types.VersionDeneb:
+		event.Data.PayloadAttributes.ParentBeaconBlockRoot = &parentRoot
+		fallthrough
+	case types.VersionCapella:
+		event.Data.PayloadAttributes.Withdrawals = []*types.Withdrawal{}
+	}
+	c.beacon.publish(topicPayloadAttributes, event)
+}
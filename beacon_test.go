@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mergemock/rpc"
+	"mergemock/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestConsensus returns a consensus mock with a beacon chain view at genesis, connected to an engine with the same
+// genesis.
+func newTestConsensus(t *testing.T) *ConsensusCmd {
+	c, _ := newTestConsensusEngine(t)
+	return c
+}
+
+// newTestConsensusEngine returns a consensus mock driving an embedded engine, and the engine. The genesis funds
+// the given accounts.
+func newTestConsensusEngine(t *testing.T, funded ...common.Address) (*ConsensusCmd, *EngineCmd) {
+	ctx := context.Background()
+	jwtPath, genesisPath := newJwt(t), newGenesis(t, common.Address{}, funded...)
+	engine := &EngineCmd{}
+	engine.Default()
+	engine.LogCmd.Default()
+	// Ports of its own, the embedded engines of other tests keep listening
+	engine.ListenAddr = "127.0.0.1:38571"
+	engine.WebsocketAddr = "127.0.0.1:38572"
+	engine.JwtSecretPath = jwtPath
+	engine.GenesisPath = genesisPath
+	require.NoError(t, engine.Run(ctx))
+	t.Cleanup(func() { engine.Close() })
+
+	jwt, err := loadJwtSecret(jwtPath)
+	require.NoError(t, err)
+	client, err := rpc.DialContext(ctx, "http://"+engine.ListenAddr, jwt)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		var head *ethTypes.Header
+		return client.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false) == nil
+	}, 5*time.Second, 50*time.Millisecond, "engine not reachable")
+
+	c := new(ConsensusCmd)
+	c.Default()
+	c.Validators.Default()
+	c.Validators.Count = 8
+	c.BeaconGenesisTime = uint64(time.Now().Unix())
+	c.log = logrus.New()
+	c.ctx = ctx
+	c.engine = client
+	c.network = &types.Mainnet
+	c.genesisValidatorsRoot = types.Root{0x12, 0x34}
+	c.forks = types.ForkSchedule{SlotsPerEpoch: c.SlotsPerEpoch, CapellaEpoch: c.CapellaForkEpoch, DenebEpoch: c.DenebForkEpoch}
+	c.validators, err = NewValidatorSet(&c.Validators, c.SlotsPerEpoch, c.genesisValidatorsRoot)
+	require.NoError(t, err)
+	db, err := NewDB("")
+	require.NoError(t, err)
+	c.mockChain, err = NewMockChain(c.log, &ExecutionConsensusMock{log: c.log}, genesisPath, db, &c.TraceLogConfig)
+	require.NoError(t, err)
+	c.produced, err = lru.New(beaconProducedPayloadKept)
+	require.NoError(t, err)
+	c.beacon = newBeaconChain(c.SlotsPerEpoch)
+	c.beacon.addMockBlock(0, 0, c.mockChain.CurrentHeader())
+	return c, engine
+}
+
+func (c *ConsensusCmd) testBeaconRequest(t *testing.T, method string, path string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	c.beaconRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBeaconAPI(t *testing.T) {
+	c := newTestConsensus(t)
+	genesis := c.beacon.headBlock()
+
+	rr := c.testBeaconRequest(t, "GET", pathGenesis, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var genesisResp struct {
+		Data beaconGenesis `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &genesisResp))
+	require.Equal(t, c.genesisValidatorsRoot, genesisResp.Data.GenesisValidatorsRoot)
+	require.Equal(t, c.BeaconGenesisTime, genesisResp.Data.GenesisTime)
+
+	rr = c.testBeaconRequest(t, "GET", "/eth/v1/validator/duties/proposer/0", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var dutiesResp struct {
+		DependentRoot types.Root      `json:"dependent_root"`
+		Data          []*proposerDuty `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &dutiesResp))
+	require.Equal(t, genesis.Root, dutiesResp.DependentRoot)
+	require.Len(t, dutiesResp.Data, int(c.SlotsPerEpoch))
+	proposer := c.validators.Proposer(1)
+	require.Equal(t, proposer.Index, dutiesResp.Data[1].ValidatorIndex)
+	require.Equal(t, proposer.Pubkey, dutiesResp.Data[1].Pubkey)
+
+	// Full blocks are produced on the head
+	path := fmt.Sprintf("/eth/v2/validator/blocks/1?randao_reveal=%s", types.Signature{})
+	rr = c.testBeaconRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, types.VersionBellatrix, rr.Header().Get("Eth-Consensus-Version"))
+	var blockResp struct {
+		Data *types.BeaconBlock `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &blockResp))
+	require.Equal(t, genesis.Root, blockResp.Data.ParentRoot)
+	require.Equal(t, types.Hash(genesis.BlockHash), blockResp.Data.Body.ExecutionPayload.ParentHash)
+
+	// The slot must be after the head, and the randao reveal is required
+	rr = c.testBeaconRequest(t, "GET", fmt.Sprintf("/eth/v1/validator/blinded_blocks/0?randao_reveal=%s", types.Signature{}), nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = c.testBeaconRequest(t, "GET", "/eth/v1/validator/blinded_blocks/1", nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = c.testBeaconRequest(t, "GET", fmt.Sprintf("/eth/v1/validator/blinded_blocks/1?randao_reveal=%s", types.Signature{}), nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var blindedResp struct {
+		Version string                    `json:"version"`
+		Data    *types.BlindedBeaconBlock `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &blindedResp))
+	require.Equal(t, types.VersionBellatrix, blindedResp.Version)
+	block := blindedResp.Data
+	require.Equal(t, proposer.Index, block.ProposerIndex)
+
+	// A bad signature is rejected
+	signed := &types.SignedBlindedBeaconBlock{Message: block}
+	body, err := json.Marshal(signed)
+	require.NoError(t, err)
+	rr = c.testBeaconRequest(t, "POST", pathPublishBlindedBlock, body)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, genesis, c.beacon.headBlock())
+
+	domain, err := c.network.ProposerDomain(types.VersionBellatrix, &c.genesisValidatorsRoot)
+	require.NoError(t, err)
+	signed.Signature, err = proposer.Sign(block, domain)
+	require.NoError(t, err)
+	body, err = json.Marshal(signed)
+	require.NoError(t, err)
+	rr = c.testBeaconRequest(t, "POST", pathPublishBlindedBlock, body)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	head := c.beacon.headBlock()
+	require.Equal(t, uint64(1), head.Header.Header.Slot)
+	require.Equal(t, common.Hash(block.Body.ExecutionPayloadHeader.BlockHash), head.BlockHash)
+	require.Equal(t, head.BlockHash, c.mockChain.CurrentHeader().Hash())
+	root, err := block.HashTreeRoot()
+	require.NoError(t, err)
+	require.Equal(t, types.Root(root), head.Root)
+
+	for _, id := range []string{"head", "1", head.Root.String()} {
+		rr = c.testBeaconRequest(t, "GET", "/eth/v1/beacon/headers/"+id, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var headerResp struct {
+			Data beaconHeader `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &headerResp))
+		require.Equal(t, head.Root, headerResp.Data.Root)
+		require.Equal(t, genesis.Root, headerResp.Data.Header.Header.ParentRoot)
+		require.Equal(t, signed.Signature, headerResp.Data.Header.Signature)
+	}
+	rr = c.testBeaconRequest(t, "GET", "/eth/v1/beacon/headers/2", nil)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Publishing the block again does not import it twice
+	rr = c.testBeaconRequest(t, "POST", pathPublishBlindedBlock, body)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, head, c.beacon.headBlock())
+}
+
+func TestBeaconProposals(t *testing.T) {
+	c := newTestConsensus(t)
+	domain, err := c.network.ProposerDomain(types.VersionBellatrix, &c.genesisValidatorsRoot)
+	require.NoError(t, err)
+	propose := func(slot uint64) (*types.SignedBlindedBeaconBlock, *httptest.ResponseRecorder) {
+		path := fmt.Sprintf("/eth/v1/validator/blinded_blocks/%d?randao_reveal=%s", slot, types.Signature{})
+		rr := c.testBeaconRequest(t, "GET", path, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var resp struct {
+			Data *types.BlindedBeaconBlock `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		signed := &types.SignedBlindedBeaconBlock{Message: resp.Data}
+		signed.Signature, err = c.validators.Proposer(slot).Sign(resp.Data, domain)
+		require.NoError(t, err)
+		body, err := json.Marshal(signed)
+		require.NoError(t, err)
+		return signed, c.testBeaconRequest(t, "POST", pathPublishBlindedBlock, body)
+	}
+
+	// Two slots in a row proposed through the beacon API make a linear chain
+	parent := c.beacon.headBlock()
+	for slot := uint64(1); slot <= 2; slot++ {
+		signed, rr := propose(slot)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		head := c.beacon.headBlock()
+		require.Equal(t, slot, head.Header.Header.Slot)
+		require.Equal(t, parent.Root, head.Header.Header.ParentRoot)
+		require.Equal(t, parent.BlockHash, common.Hash(signed.Message.Body.ExecutionPayloadHeader.ParentHash))
+		require.Equal(t, parent.BlockNumber+1, head.BlockNumber)
+		require.Equal(t, head.BlockHash, c.mockChain.CurrentHeader().Hash())
+
+		// The consensus mock does not propose the slot itself
+		require.False(t, c.beacon.claimSlot(slot, claimMock))
+		parent = head
+	}
+
+	// A slot the consensus mock proposes cannot be produced through the beacon API
+	require.True(t, c.beacon.claimSlot(3, claimMock))
+	rr := c.testBeaconRequest(t, "GET", fmt.Sprintf("/eth/v1/validator/blinded_blocks/3?randao_reveal=%s", types.Signature{}), nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), errSlotTaken.Error())
+
+	// A block that does not build on the head is not imported
+	signed, rr := propose(4)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	sibling := *signed.Message
+	sibling.Slot = 5
+	sibling.ProposerIndex = c.validators.Proposer(5).Index
+	sibling.ParentRoot = parent.Root
+	signedSibling := &types.SignedBlindedBeaconBlock{Message: &sibling}
+	signedSibling.Signature, err = c.validators.Proposer(5).Sign(&sibling, domain)
+	require.NoError(t, err)
+	body, err := json.Marshal(signedSibling)
+	require.NoError(t, err)
+	rr = c.testBeaconRequest(t, "POST", pathPublishBlindedBlock, body)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), errNotOnHead.Error())
+	require.Equal(t, uint64(4), c.beacon.headBlock().Header.Header.Slot)
+}
+
+func TestBeaconEvents(t *testing.T) {
+	c := new(ConsensusCmd)
+	c.beacon = newBeaconChain(4)
+	srv := httptest.NewServer(LoggingMiddleware(c.beaconRouter(), logrus.New()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/eth/v1/events?topics=unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/eth/v1/events?topics=head")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.Eventually(t, func() bool {
+		c.beacon.mu.RLock()
+		defer c.beacon.mu.RUnlock()
+		return len(c.beacon.subs) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	header := &ethTypes.Header{Number: common.Big1, Root: common.Hash{0x01}}
+	c.beacon.publish(topicPayloadAttributes, struct{}{})
+	b := c.beacon.addMockBlock(5, 3, header)
+	buf := make([]byte, 4096)
+	n, err := resp.Body.Read(buf)
+	require.NoError(t, err)
+	event := string(buf[:n])
+	require.Contains(t, event, "event: head\ndata: ")
+	require.Contains(t, event, fmt.Sprintf(`"slot":"5","block":"%s"`, b.Root))
+}
@@ -75,6 +75,7 @@ type ConsensusBehavior struct {
 		GapSlot            float64 `ask:"--gap" help:"How often an execution block is missing"`
 		ProposalFreq       float64 `ask:"--proposal" help:"How often the engine gets to propose a block"`
 		FailedProposalFreq float64 `ask:"--ignore" help:"How often the payload produced by the engine does not become canonical"`
+		IgnoredAnnounce    float64 `ask:"--ignore-announce" help:"How often a non-canonical payload is still sent back to the engine"`
 		Finality           float64 `ask:"--finality" help:"How often an epoch succeeds to finalize"`
 		ReorgFreq          float64 `ask:"--reorg" help:"Frequency of chain reorgs"`
 		InvalidHashFreq    float64 `ask:"--invalid-hash" help:"Frequency of invalid payload hashes"`
@@ -88,6 +89,7 @@ func (b *ConsensusBehavior) Default() {
 	b.Freq.GapSlot = 0.05
 	b.Freq.ProposalFreq = 0.5
 	b.Freq.FailedProposalFreq = 0.1
+	b.Freq.IgnoredAnnounce = 0.5
 	b.Freq.Finality = 0.1
 	b.ReorgMaxDepth = 64
 	b.Freq.ReorgFreq = 0.05
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	BidStrategyTrue     = "true"
+	BidStrategyMarkup   = "markup"
+	BidStrategyRandom   = "random"
+	BidStrategyUnderbid = "underbid"
+)
+
+type BidConfig struct {
+	Strategy  string  `ask:"--strategy" help:"How the relay values its bids: true, markup, random or underbid"`
+	Markup    float64 `ask:"--markup" help:"Amount, in ETH, added to the true value with the markup strategy"`
+	Underbid  float64 `ask:"--underbid" help:"Amount, in ETH, subtracted from the true value with the underbid strategy"`
+	RandomMin float64 `ask:"--random-min" help:"Lowest bid, in ETH, with the random strategy"`
+	RandomMax float64 `ask:"--random-max" help:"Highest bid, in ETH, with the random strategy"`
+	RNG       RNG     `ask:"--rng" help:"seed the RNG with an integer number"`
+
+	Payment PaymentAccount `ask:"--payment-key" help:"Hex encoded private key of a funded account. If set, the relay is the coinbase of its blocks and pays the bid to the fee recipient with a final transaction"`
+
+	mu sync.Mutex
+}
+
+func (b *BidConfig) Default() {
+	b.Strategy = BidStrategyTrue
+	b.Markup = 0.01
+	b.Underbid = 0.01
+	b.RandomMin = 0
+	b.RandomMax = 0.1
+	b.RNG = RNG{rand.New(rand.NewSource(DefaultRNGSeed))}
+}
+
+func (b *BidConfig) Validate() error {
+	switch b.Strategy {
+	case BidStrategyTrue, BidStrategyMarkup, BidStrategyUnderbid:
+	case BidStrategyRandom:
+		if b.RandomMin > b.RandomMax {
+			return fmt.Errorf("random bid range is empty: %v > %v", b.RandomMin, b.RandomMax)
+		}
+	default:
+		return fmt.Errorf("unknown bid strategy %q", b.Strategy)
+	}
+	return nil
+}
+
+// Value returns the bid value for a payload that pays trueValue to the proposer.
+func (b *BidConfig) Value(trueValue *big.Int) *big.Int {
+	switch b.Strategy {
+	case BidStrategyMarkup:
+		return new(big.Int).Add(trueValue, etherToWei(b.Markup))
+	case BidStrategyUnderbid:
+		v := new(big.Int).Sub(trueValue, etherToWei(b.Underbid))
+		if v.Sign() < 0 {
+			return new(big.Int)
+		}
+		return v
+	case BidStrategyRandom:
+		b.mu.Lock()
+		f := b.RNG.Float64()
+		b.mu.Unlock()
+		return etherToWei(b.RandomMin + f*(b.RandomMax-b.RandomMin))
+	default:
+		return new(big.Int).Set(trueValue)
+	}
+}
+
+func etherToWei(eth float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(eth), big.NewFloat(params.Ether)).Int(nil)
+	return wei
+}
+
+// PaymentAccount is the builder account that pays proposers, if any.
+type PaymentAccount struct {
+	account *TestAccount
+}
+
+func (p *PaymentAccount) String() string {
+	if p.account == nil {
+		return ""
+	}
+	return p.account.addr.String()
+}
+
+func (p *PaymentAccount) Set(s string) error {
+	if s == "" {
+		p.account = nil
+		return nil
+	}
+	pk, err := crypto.HexToECDSA(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return fmt.Errorf("failed interpret hex private key: %s", err)
+	}
+	p.account = &TestAccount{pk, crypto.PubkeyToAddress(pk.PublicKey)}
+	return nil
+}
+
+func (p *PaymentAccount) Type() string {
+	return "PaymentAccount"
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBidValue(t *testing.T) {
+	trueValue := big.NewInt(params.Ether / 100)
+	bids := new(BidConfig)
+	bids.Default()
+
+	bids.Strategy = BidStrategyTrue
+	require.Equal(t, trueValue, bids.Value(trueValue))
+
+	bids.Strategy = BidStrategyMarkup
+	bids.Markup = 0.01
+	require.Equal(t, big.NewInt(params.Ether/50), bids.Value(trueValue))
+
+	bids.Strategy = BidStrategyUnderbid
+	bids.Underbid = 0.005
+	require.Equal(t, big.NewInt(params.Ether/200), bids.Value(trueValue))
+	bids.Underbid = 1
+	require.Equal(t, 0, bids.Value(trueValue).Sign(), "underbid must not go negative")
+
+	bids.Strategy = BidStrategyRandom
+	bids.RandomMin = 0.1
+	bids.RandomMax = 0.2
+	for i := 0; i < 10; i++ {
+		v := bids.Value(trueValue)
+		require.True(t, v.Cmp(etherToWei(0.1)) >= 0 && v.Cmp(etherToWei(0.2)) <= 0, "random bid %v out of range", v)
+	}
+
+	bids.RandomMin = 0.3
+	require.Error(t, bids.Validate())
+	bids.Strategy = "generous"
+	require.Error(t, bids.Validate())
+}
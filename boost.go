@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"mergemock/api"
+	"mergemock/rpc"
+	"mergemock/types"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errNoRelays          = errors.New("no relays")
+	errNoRelayAvailable  = errors.New("no relay available")
+	errNoPayloadReceived = errors.New("no relay delivered the payload")
+)
+
+type BoostCmd struct {
+	ListenAddr   string        `ask:"--listen-addr" help:"Address to bind the builder API server to, for the consensus client"`
+	RelayAddrs   []string      `ask:"--relay" help:"Addresses of builder relay REST API endpoints to multiplex, a relay pubkey can be pinned with http://0xpubkey@host:port"`
+	RelayTimeout time.Duration `ask:"--relay-timeout" help:"Time to wait for the bids of relays in getHeader"`
+	RelaySSZ     bool          `ask:"--relay-ssz" help:"Prefer SSZ over JSON encoding with the relays, falling back to JSON for relays without SSZ support"`
+	MinBid       float64       `ask:"--min-bid" help:"Minimum bid value, in ETH, below which getHeader has no bid"`
+
+	Network          string `ask:"--network" help:"Network whose fork versions sign builder messages: mainnet, sepolia, holesky, or a consensus spec config YAML file"`
+	SlotsPerEpoch    uint64 `ask:"--slots-per-epoch" help:"Slots per epoch"`
+	CapellaForkEpoch uint64 `ask:"--capella-fork-epoch" help:"Epoch of the Capella fork, from which bids and blinded blocks are Capella ones"`
+	DenebForkEpoch   uint64 `ask:"--deneb-fork-epoch" help:"Epoch of the Deneb fork, from which bids and blinded blocks are Deneb ones"`
+
+	// embed timeout and logger options
+	Timeout rpc.Timeout `ask:".timeout" help:"Configure timeouts of the HTTP server"`
+	LogCmd  `ask:".log" help:"Change logger configuration"`
+
+	close chan struct{}
+	log   *logrus.Logger
+	srv   *http.Server
+}
+
+func (b *BoostCmd) Default() {
+	b.ListenAddr = "127.0.0.1:18550"
+	b.RelayTimeout = 950 * time.Millisecond
+
+	b.Network = types.Mainnet.Name
+	b.SlotsPerEpoch = 32
+	b.CapellaForkEpoch = math.MaxUint64
+	b.DenebForkEpoch = math.MaxUint64
+
+	b.Timeout.Read = 30 * time.Second
+	b.Timeout.ReadHeader = 10 * time.Second
+	b.Timeout.Write = 30 * time.Second
+	b.Timeout.Idle = 5 * time.Minute
+}
+
+func (b *BoostCmd) Help() string {
+	return "Run a mock mev-boost, multiplexing the builder API of several relays."
+}
+
+func (b *BoostCmd) Run(ctx context.Context, args ...string) error {
+	b.close = make(chan struct{})
+	logr, err := b.LogCmd.Create()
+	if err != nil {
+		return err
+	}
+	b.log = logr
+	backend, err := NewBoostBackend(b.log, b)
+	if err != nil {
+		return err
+	}
+	go b.startRESTApi(backend)
+	return nil
+}
+
+func (b *BoostCmd) Close() error {
+	if b.close != nil {
+		b.close <- struct{}{}
+	}
+	return nil
+}
+
+func (b *BoostCmd) startRESTApi(backend *BoostBackend) {
+	b.srv = &http.Server{
+		Addr:    b.ListenAddr,
+		Handler: backend.getRouter(),
+
+		ReadTimeout:       b.Timeout.Read,
+		ReadHeaderTimeout: b.Timeout.ReadHeader,
+		WriteTimeout:      b.Timeout.Write,
+		IdleTimeout:       b.Timeout.Idle,
+	}
+
+	b.log.WithField("listenAddr", b.ListenAddr).WithField("relays", len(backend.relays)).Info("Boost started")
+	go b.srv.ListenAndServe()
+	for range b.close {
+		b.srv.Close()
+		return
+	}
+}
+
+// BoostBackend serves the builder API to a consensus client, on top of the builder API of several relays.
+type BoostBackend struct {
+	log           *logrus.Logger
+	relays        []*api.RelayEntry
+	relayTimeout  time.Duration
+	useSSZ        bool
+	minBid        *big.Int
+	forks         types.ForkSchedule
+	builderDomain types.Domain
+
+	bids *lru.Cache // relays that gave the header of each block hash, for getPayload
+}
+
+func NewBoostBackend(log *logrus.Logger, cfg *BoostCmd) (*BoostBackend, error) {
+	if len(cfg.RelayAddrs) == 0 {
+		return nil, errNoRelays
+	}
+	var relays []*api.RelayEntry
+	for _, addr := range cfg.RelayAddrs {
+		relay, err := api.ParseRelayEntry(addr)
+		if err != nil {
+			return nil, err
+		}
+		relays = append(relays, relay)
+	}
+	network, err := loadNetwork(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+	bids, err := lru.New(128)
+	if err != nil {
+		return nil, err
+	}
+	return &BoostBackend{
+		log:          log,
+		relays:       relays,
+		relayTimeout: cfg.RelayTimeout,
+		useSSZ:       cfg.RelaySSZ,
+		minBid:       etherToWei(cfg.MinBid),
+		forks: types.ForkSchedule{
+			SlotsPerEpoch: cfg.SlotsPerEpoch,
+			CapellaEpoch:  cfg.CapellaForkEpoch,
+			DenebEpoch:    cfg.DenebForkEpoch,
+		},
+		builderDomain: network.BuilderDomain(),
+		bids:          bids,
+	}, nil
+}
+
+func (b *BoostBackend) getRouter() http.Handler {
+	router := mux.NewRouter()
+
+	// Add routes
+	router.HandleFunc(pathStatus, b.handleStatus).Methods(http.MethodGet)
+	router.HandleFunc(pathRegisterValidator, b.handleRegisterValidator).Methods(http.MethodPost)
+	router.HandleFunc(pathGetHeader, b.handleGetHeader).Methods(http.MethodGet)
+	router.HandleFunc(pathGetPayload, b.handleGetPayload).Methods(http.MethodPost)
+
+	// Add logging and return router
+	loggedRouter := LoggingMiddleware(router, b.log)
+	return loggedRouter
+}
+
+// forEachRelay calls f for all relays concurrently, and returns the number of calls that succeeded.
+func (b *BoostBackend) forEachRelay(relays []*api.RelayEntry, f func(relay *api.RelayEntry) error) int {
+	errs := make(chan error, len(relays))
+	for _, relay := range relays {
+		go func(relay *api.RelayEntry) {
+			errs <- f(relay)
+		}(relay)
+	}
+	ok := 0
+	for range relays {
+		if err := <-errs; err == nil {
+			ok++
+		}
+	}
+	return ok
+}
+
+// handleStatus reports ready when any relay is.
+func (b *BoostBackend) handleStatus(w http.ResponseWriter, req *http.Request) {
+	ok := b.forEachRelay(b.relays, func(relay *api.RelayEntry) error {
+		err := api.BuilderStatus(req.Context(), relay.Address)
+		if err != nil {
+			b.log.WithField("relay", relay).WithError(err).Warn("Relay not ready")
+		}
+		return err
+	})
+	if ok == 0 {
+		http.Error(w, errNoRelayAvailable.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{}`)
+}
+
+// handleRegisterValidator forwards the registrations to all relays, and succeeds if any relay accepts them.
+func (b *BoostBackend) handleRegisterValidator(w http.ResponseWriter, req *http.Request) {
+	isSSZ, err := requestIsSSZ(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	var payload []*types.SignedValidatorRegistration
+	if isSSZ {
+		body, err := ioutil.ReadAll(req.Body)
+		if err == nil {
+			payload, err = api.UnmarshalRegistrationsSSZ(body)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ok := b.forEachRelay(b.relays, func(relay *api.RelayEntry) error {
+		log := b.log.WithField("relay", relay)
+		err := api.BuilderRegisterValidators(req.Context(), log, relay.Address, payload, b.useSSZ)
+		if err != nil {
+			log.WithError(err).Warn("Relay rejected validator registrations")
+		}
+		return err
+	})
+	if ok == 0 {
+		http.Error(w, errNoRelayAvailable.Error(), http.StatusBadGateway)
+		return
+	}
+	b.log.WithField("count", len(payload)).WithField("relays", ok).Info("Registered validators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{}`)
+}
+
+// handleGetHeader asks all relays for a bid, and gives the best one. Relays that miss the relay timeout, or give
+// invalid bids, are left out.
+func (b *BoostBackend) handleGetHeader(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	plog := b.log.WithFields(logrus.Fields{
+		"slot":       vars["slot"],
+		"parentHash": vars["parent_hash"],
+		"pubkey":     vars["pubkey"],
+	})
+
+	slot, err := strconv.ParseUint(vars["slot"], 10, 64)
+	if err != nil {
+		http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(vars["parent_hash"]) != 66 {
+		http.Error(w, errInvalidHash.Error(), http.StatusBadRequest)
+		return
+	}
+	parentHash := common.HexToHash(vars["parent_hash"])
+	var pubkey types.PublicKey
+	if err := pubkey.UnmarshalText([]byte(vars["pubkey"])); err != nil {
+		http.Error(w, errInvalidPubkey.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), b.relayTimeout)
+	defer cancel()
+	type relayBid struct {
+		relay *api.RelayEntry
+		bid   *types.VersionedSignedBuilderBid
+		value *big.Int
+	}
+	bids := make(chan *relayBid, len(b.relays))
+	b.forEachRelay(b.relays, func(relay *api.RelayEntry) error {
+		log := plog.WithField("relay", relay)
+		bid, err := api.BuilderGetHeader(ctx, log, relay.Address, &b.forks, b.builderDomain, slot, parentHash, pubkey[:], relay.Pubkey, b.useSSZ)
+		if err == nil && common.Hash(bid.ParentHash()) != parentHash {
+			err = fmt.Errorf("bid builds on %s instead of %s", common.Hash(bid.ParentHash()), parentHash)
+		}
+		if err == api.ErrNoBid {
+			log.Debug("Relay has no bid")
+			return err
+		} else if err != nil {
+			log.WithError(err).Warn("Ignoring relay without valid bid")
+			return err
+		}
+		value := bid.Value()
+		bids <- &relayBid{relay, bid, new(big.Int).SetBytes(value[:])}
+		return nil
+	})
+	close(bids)
+
+	var best *relayBid
+	relays := make(map[types.Hash][]*api.RelayEntry)
+	for bid := range bids {
+		blockHash := bid.bid.BlockHash()
+		relays[blockHash] = append(relays[blockHash], bid.relay)
+		if best == nil || bid.value.Cmp(best.value) > 0 {
+			best = bid
+		}
+	}
+	if best == nil {
+		plog.Info("No bid from any relay")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if best.value.Cmp(b.minBid) < 0 {
+		plog.WithField("value", best.value).Info("Best bid is below the minimum bid")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Relays that gave the same block can all reveal its payload.
+	blockHash := best.bid.BlockHash()
+	b.bids.Add(blockHash, relays[blockHash])
+	plog.WithFields(logrus.Fields{
+		"relay":     best.relay,
+		"blockHash": common.Hash(blockHash),
+		"value":     best.value,
+		"relays":    len(relays[blockHash]),
+	}).Info("Giving best bid")
+
+	w.Header().Set(api.HeaderConsensusVersion, best.bid.Version)
+	if acceptsSSZ(req) {
+		writeSSZ(w, best.bid)
+		return
+	}
+	writeJSON(w, best.bid)
+}
+
+// handleGetPayload reveals the signed blinded block to the relays that gave its header, and returns the first
+// payload that matches the block.
+func (b *BoostBackend) handleGetPayload(w http.ResponseWriter, req *http.Request) {
+	plog := b.log.WithField("method", "getPayload")
+
+	isSSZ, err := requestIsSSZ(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	block, err := decodeBlindedBlock(&b.forks, body, req.Header.Get(api.HeaderConsensusVersion), isSSZ)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !block.Complete() {
+		http.Error(w, "missing execution payload header", http.StatusBadRequest)
+		return
+	}
+	blockHash := block.BlockHash()
+	cached, ok := b.bids.Get(blockHash)
+	if !ok {
+		plog.WithField("blockHash", common.Hash(blockHash)).Warn("Cannot unblind block")
+		http.Error(w, errUnknownBid.Error(), http.StatusBadRequest)
+		return
+	}
+	relays := cached.([]*api.RelayEntry)
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	payloads := make(chan *types.VersionedExecutionPayload, len(relays))
+	b.forEachRelay(relays, func(relay *api.RelayEntry) error {
+		log := plog.WithField("relay", relay)
+		payload, err := api.BuilderGetVersionedPayload(ctx, log, relay.Address, block, b.useSSZ)
+		if err == nil && payload.BlockHash() != blockHash {
+			err = fmt.Errorf("relay payload %s does not match block %s", common.Hash(payload.BlockHash()), common.Hash(blockHash))
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithError(err).Warn("Relay did not deliver the payload")
+			}
+			return err
+		}
+		payloads <- payload
+		cancel()
+		return nil
+	})
+	close(payloads)
+
+	payload, ok := <-payloads
+	if !ok {
+		http.Error(w, errNoPayloadReceived.Error(), http.StatusBadGateway)
+		return
+	}
+	plog.WithFields(logrus.Fields{
+		"slot":      block.Slot(),
+		"version":   payload.Version,
+		"blockHash": common.Hash(blockHash),
+	}).Info("Unblinded block")
+
+	w.Header().Set(api.HeaderConsensusVersion, payload.Version)
+	if acceptsSSZ(req) {
+		writeSSZ(w, payload)
+		return
+	}
+	writeJSON(w, payload)
+}
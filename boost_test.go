@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mergemock/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBoost(t *testing.T, relayAddrs ...string) *BoostBackend {
+	cfg := new(BoostCmd)
+	cfg.Default()
+	cfg.RelayAddrs = relayAddrs
+	boost, err := NewBoostBackend(logrus.New(), cfg)
+	require.NoError(t, err)
+	return boost
+}
+
+func (b *BoostBackend) testRequest(t *testing.T, method string, path string, payload any) *httptest.ResponseRecorder {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		require.NoError(t, err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	b.getRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBoost(t *testing.T) {
+	ctx := context.Background()
+	var relays []*testRelayBackend
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		relay := newTestRelay(t)
+		relay.engine.Run(ctx)
+		parentHash := relay.engine.mockChain().CurrentHeader().Hash()
+		_, err := relay.engine.backend.ForkchoiceUpdatedV1(
+			ctx,
+			&types.ForkchoiceStateV1{HeadBlockHash: parentHash, SafeBlockHash: parentHash, FinalizedBlockHash: parentHash},
+			&types.PayloadAttributesV1{Timestamp: relay.engine.mockChain().CurrentHeader().Time + 1},
+		)
+		require.NoError(t, err, "unable to initialize engine")
+		srv := httptest.NewServer(relay.getRouter())
+		t.Cleanup(srv.Close)
+		relays, addrs = append(relays, relay), append(addrs, srv.URL)
+	}
+	// The second relay outbids the first
+	relays[1].bids.Strategy = BidStrategyMarkup
+	boost := newTestBoost(t, addrs...)
+
+	rr := boost.testRequest(t, "GET", pathStatus, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Validators are registered with all relays
+	// The relays simulate the same validator set
+	proposer := relays[1].validators.ByIndex(2)
+	pk, sk, pubkey := proposer.Pubkey[:], proposer.sk, proposer.Pubkey
+	rr = boost.testRequest(t, "POST", pathRegisterValidator, []*types.SignedValidatorRegistration{newRegistration(t, sk, uint64(time.Now().Unix()))})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	for _, relay := range relays {
+		require.NotNil(t, relay.registry.Get(pubkey))
+	}
+
+	parentHash := relays[0].engine.mockChain().CurrentHeader().Hash()
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, parentHash.Hex(), pk)
+	rr = boost.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, types.VersionBellatrix, rr.Header().Get("Eth-Consensus-Version"))
+	bid := new(types.VersionedSignedBuilderBid)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	require.Equal(t, relays[1].pk, bid.Pubkey(), "best bid not given")
+
+	// No bid on an unknown parent
+	rr = boost.testRequest(t, "GET", fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, common.Hash{0x01}.Hex(), pk), nil)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	block, err := signBlindedBlockForBid(proposer, 1, bid, &types.Mainnet, &relays[1].genesisValidatorsRoot)
+	require.NoError(t, err)
+	rr = boost.testRequest(t, "POST", pathGetPayload, block)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	payload := &types.VersionedExecutionPayload{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), payload))
+	require.Equal(t, bid.BlockHash(), payload.BlockHash())
+
+	// Blocks of headers not given by the boost are not revealed to relays
+	block.Bellatrix.Message.Body.ExecutionPayloadHeader.BlockHash = types.Hash{0x01}
+	rr = boost.testRequest(t, "POST", pathGetPayload, block)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestBoostMinBid(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	relay.engine.Run(ctx)
+	parent := relay.engine.mockChain().CurrentHeader()
+	parentHash := parent.Hash()
+	_, err := relay.engine.backend.ForkchoiceUpdatedV1(
+		ctx,
+		&types.ForkchoiceStateV1{HeadBlockHash: parentHash, SafeBlockHash: parentHash, FinalizedBlockHash: parentHash},
+		&types.PayloadAttributesV1{Timestamp: parent.Time + 1},
+	)
+	require.NoError(t, err, "unable to initialize engine")
+	srv := httptest.NewServer(relay.getRouter())
+	defer srv.Close()
+
+	boost := newTestBoost(t, srv.URL)
+	boost.minBid = etherToWei(1)
+	pk, sk := newKeypair(t)
+	relay.registerValidator(t, sk)
+
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, parentHash.Hex(), pk)
+	rr := boost.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	// Relays that are down are left out
+	srv.Close()
+	rr = boost.testRequest(t, "GET", pathStatus, nil)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
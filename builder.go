@@ -0,0 +1,619 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"mergemock/api"
+	"mergemock/rpc"
+	"mergemock/types"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// builderSyncDepth is how many missing ancestors of a head the builder fetches from the engine.
+	builderSyncDepth = 64
+	// attributesEventsKept is how many slots of payload attributes events are kept.
+	attributesEventsKept = 64
+)
+
+var (
+	errNoGenesisTime = errors.New("beacon genesis time is needed without a beacon API")
+	errSubsidyUnpaid = errors.New("a subsidy needs a payment key")
+)
+
+type BuilderTxsConfig struct {
+	Accounts TestAccounts `ask:"--accounts" help:"Comma-separated list of hex encoded private keys of funded accounts to send the transactions of the mix from"`
+	Count    uint64       `ask:"--count" help:"Transactions per block, sent round-robin by the accounts to themselves"`
+	Tip      float64      `ask:"--tip" help:"Priority fee of the transactions, in gwei"`
+	Calldata uint64       `ask:"--calldata" help:"Bytes of zero calldata in each transaction"`
+}
+
+func (c *BuilderTxsConfig) Default() {
+	c.Count = 10
+	c.Tip = 1
+}
+
+type BuilderCmd struct {
+	EngineAddr    string `ask:"--engine" help:"Address of Engine JSON-RPC endpoint of the execution client to follow"`
+	JwtSecretPath string `ask:"--jwt-secret" help:"JWT secret key for authenticated communication"`
+	GenesisPath   string `ask:"--genesis" help:"Genesis execution-config file"`
+	DataDir       string `ask:"--datadir" help:"Directory to store execution chain data (empty for in-memory data)"`
+
+	BeaconAddr string   `ask:"--beacon" help:"Address of a beacon API, e.g. of the consensus mock, to follow payload attributes events and get the genesis time from (head of the engine if empty)"`
+	RelayAddrs []string `ask:"--relay" help:"Addresses of builder relay REST API endpoints to submit blocks to"`
+
+	SecretKey     string `ask:"--secret-key" help:"Hex encoded BLS secret key the builder signs bid traces with (random if neither this nor --secret-key-file is set)"`
+	SecretKeyPath string `ask:"--secret-key-file" help:"File with the hex encoded BLS secret key the builder signs bid traces with, see the keygen command"`
+	Network       string `ask:"--network" help:"Network whose fork versions sign builder messages: mainnet, sepolia, holesky, or a consensus spec config YAML file"`
+
+	BeaconGenesisTime uint64          `ask:"--beacon-genesis-time" help:"Beacon genesis time, required without --beacon"`
+	SlotTime          time.Duration   `ask:"--slot-time" help:"Time per slot"`
+	SubmitAt          []time.Duration `ask:"--submit-at" help:"Times within the slot before a proposal to submit blocks at (halfway and at five sixths of the slot if empty)"`
+
+	Payment PaymentAccount `ask:"--payment-key" help:"Hex encoded private key of a funded account. If set, the builder is the coinbase of its blocks and pays the bid to the fee recipient with a final transaction"`
+	Subsidy float64        `ask:"--subsidy" help:"Amount, in ETH, the builder adds to the value of its blocks, paid with the payment key"`
+
+	Txs BuilderTxsConfig `ask:".txs" help:"Configure the transaction mix of the built blocks"`
+
+	// embed logger options
+	LogCmd `ask:".log" help:"Change logger configuration"`
+
+	TraceLogConfig `ask:".trace" help:"Tracing options"`
+
+	close chan struct{}
+	log   *logrus.Logger
+}
+
+func (b *BuilderCmd) Default() {
+	b.EngineAddr = "http://127.0.0.1:8551"
+	b.JwtSecretPath = "jwt.hex"
+	b.GenesisPath = "genesis.json"
+	b.Network = types.Mainnet.Name
+	b.SlotTime = 12 * time.Second
+	b.LogLvl = "info"
+}
+
+func (b *BuilderCmd) Help() string {
+	return "Run a mock block builder, submitting blocks on the head of an engine to relays."
+}
+
+func (b *BuilderCmd) Run(ctx context.Context, args ...string) error {
+	logr, err := b.LogCmd.Create()
+	if err != nil {
+		return err
+	}
+	b.log = logr
+	backend, err := NewBuilderBackend(ctx, b.log, b)
+	if err != nil {
+		return err
+	}
+	b.close = make(chan struct{})
+	go b.runBuilder(ctx, backend)
+	return nil
+}
+
+func (b *BuilderCmd) Close() error {
+	if b.close != nil {
+		b.close <- struct{}{}
+	}
+	return nil
+}
+
+// runBuilder builds and submits blocks at the submission times of every slot, until the builder is closed.
+func (b *BuilderCmd) runBuilder(ctx context.Context, backend *BuilderBackend) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer backend.Close()
+	defer cancel()
+	if b.BeaconAddr != "" {
+		go backend.events.follow(ctx, b.BeaconAddr)
+	}
+
+	b.log.WithFields(logrus.Fields{
+		"builder": backend.pk,
+		"relays":  len(backend.relays),
+	}).Info("Builder started")
+	for {
+		slot, at := backend.nextSubmission(time.Now())
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-timer.C:
+		case <-b.close:
+			timer.Stop()
+			return
+		}
+		slog := b.log.WithField("slot", slot)
+		head, err := backend.head(ctx, slot)
+		if err != nil {
+			slog.WithError(err).Warn("No head to build on")
+			continue
+		}
+		accepted := backend.submitSlot(ctx, slot, head)
+		slog.WithField("parentHash", head.parentHash).WithField("accepted", accepted).Info("Submitted blocks")
+	}
+}
+
+// builderHead is what the blocks of a slot build on.
+type builderHead struct {
+	parentHash common.Hash
+	timestamp  uint64
+	prevRandao common.Hash
+}
+
+// builderBuild is a block built for the fee recipient and gas limit preferences of proposers.
+type builderBuild struct {
+	payload *types.ExecutionPayloadV1
+	value   *big.Int
+}
+
+type builderBuildKey struct {
+	feeRecipient types.Address
+	gasLimit     uint64
+}
+
+// BuilderBackend builds blocks with its own mock chain, and submits them to relays.
+type BuilderBackend struct {
+	log           logrus.Ext1FieldLogger
+	engine        *rpc.Client
+	mockChain     *MockChain
+	relays        []*api.RelayEntry
+	sk            bls.SecretKey
+	pk            types.PublicKey
+	builderDomain types.Domain
+
+	genesisTime uint64
+	slotTime    time.Duration
+	submitAt    []time.Duration
+
+	txs     TransactionsCreator
+	payment *TestAccount
+	subsidy *big.Int
+
+	events *attributesEvents
+}
+
+func NewBuilderBackend(ctx context.Context, log logrus.Ext1FieldLogger, cfg *BuilderCmd) (*BuilderBackend, error) {
+	if len(cfg.RelayAddrs) == 0 {
+		return nil, errNoRelays
+	}
+	if cfg.Subsidy != 0 && cfg.Payment.account == nil {
+		return nil, errSubsidyUnpaid
+	}
+	var relays []*api.RelayEntry
+	for _, addr := range cfg.RelayAddrs {
+		relay, err := api.ParseRelayEntry(addr)
+		if err != nil {
+			return nil, err
+		}
+		relays = append(relays, relay)
+	}
+
+	submitAt := cfg.SubmitAt
+	if len(submitAt) == 0 {
+		submitAt = []time.Duration{cfg.SlotTime / 2, cfg.SlotTime - cfg.SlotTime/6}
+	}
+	submitAt = append([]time.Duration(nil), submitAt...)
+	sort.Slice(submitAt, func(i, j int) bool { return submitAt[i] < submitAt[j] })
+	for _, at := range submitAt {
+		if at < 0 || at >= cfg.SlotTime {
+			return nil, fmt.Errorf("submission time %s is not within the slot", at)
+		}
+	}
+
+	genesisTime := cfg.BeaconGenesisTime
+	if genesisTime == 0 {
+		if cfg.BeaconAddr == "" {
+			return nil, errNoGenesisTime
+		}
+		genesis, err := beaconGenesisOf(ctx, cfg.BeaconAddr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get beacon genesis: %v", err)
+		}
+		genesisTime = genesis.GenesisTime
+	}
+
+	network, err := loadNetwork(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := loadSecretKey(cfg.SecretKey, cfg.SecretKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	var pk types.PublicKey
+	pk.FromSlice(sk.PublicKey().Marshal())
+
+	jwt, err := loadJwtSecret(cfg.JwtSecretPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read JWT secret: %v", err)
+	}
+	engine, err := rpc.DialContext(ctx, cfg.EngineAddr, jwt)
+	if err != nil {
+		return nil, err
+	}
+	db, err := NewDB(cfg.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open new db: %v", err)
+	}
+	mockChain, err := NewMockChain(log, &ExecutionConsensusMock{log: log}, cfg.GenesisPath, db, &cfg.TraceLogConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize mock chain: %v", err)
+	}
+
+	return &BuilderBackend{
+		log:           log,
+		engine:        engine,
+		mockChain:     mockChain,
+		relays:        relays,
+		sk:            sk,
+		pk:            pk,
+		builderDomain: network.BuilderDomain(),
+		genesisTime:   genesisTime,
+		slotTime:      cfg.SlotTime,
+		submitAt:      submitAt,
+		txs:           txMixCreator(&cfg.Txs),
+		payment:       cfg.Payment.account,
+		subsidy:       etherToWei(cfg.Subsidy),
+		events:        newAttributesEvents(log),
+	}, nil
+}
+
+func (b *BuilderBackend) Close() error {
+	b.engine.Close()
+	return b.mockChain.Close()
+}
+
+// nextSubmission returns the first submission time after now, with the slot of the proposal it builds for. Blocks
+// for a slot are submitted during the slot before it.
+func (b *BuilderBackend) nextSubmission(now time.Time) (uint64, time.Time) {
+	genesis := time.Unix(int64(b.genesisTime), 0)
+	slot := uint64(1)
+	if since := now.Sub(genesis); since > 0 {
+		slot = uint64(since/b.slotTime) + 1
+	}
+	for ; ; slot++ {
+		start := genesis.Add(time.Duration(slot-1) * b.slotTime)
+		for _, at := range b.submitAt {
+			if start.Add(at).After(now) {
+				return slot, start.Add(at)
+			}
+		}
+	}
+}
+
+// head returns what to build on for the slot: the payload attributes the beacon node announced for it if any,
+// otherwise the head of the engine, without a randao.
+func (b *BuilderBackend) head(ctx context.Context, slot uint64) (*builderHead, error) {
+	if event := b.events.get(slot); event != nil {
+		return &builderHead{
+			parentHash: event.ParentBlockHash,
+			timestamp:  event.PayloadAttributes.Timestamp,
+			prevRandao: event.PayloadAttributes.PrevRandao,
+		}, nil
+	}
+	var head *ethTypes.Header
+	if err := b.engine.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false); err != nil {
+		return nil, fmt.Errorf("cannot get engine head: %v", err)
+	}
+	if head == nil {
+		return nil, errNoHead
+	}
+	return &builderHead{
+		parentHash: head.Hash(),
+		timestamp:  b.genesisTime + uint64((time.Duration(slot) * b.slotTime).Seconds()),
+	}, nil
+}
+
+// syncParent imports the parent and its missing ancestors from the engine into the mock chain.
+func (b *BuilderBackend) syncParent(ctx context.Context, parentHash common.Hash) error {
+	var missing []*ethTypes.Block
+	for hash := parentHash; b.mockChain.chain.GetHeaderByHash(hash) == nil; {
+		if len(missing) == builderSyncDepth {
+			return fmt.Errorf("parent %s is more than %d blocks ahead", parentHash, builderSyncDepth)
+		}
+		block, err := b.engineBlock(ctx, hash)
+		if err != nil {
+			return err
+		}
+		missing = append(missing, block)
+		hash = block.ParentHash()
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		payload, err := api.BlockToPayload(missing[i])
+		if err != nil {
+			return err
+		}
+		if _, err := b.mockChain.ProcessPayload(payload); err != nil {
+			return fmt.Errorf("cannot import block %s: %v", missing[i].Hash(), err)
+		}
+	}
+	return nil
+}
+
+// engineBlock gets a block with its transactions from the engine.
+func (b *BuilderBackend) engineBlock(ctx context.Context, hash common.Hash) (*ethTypes.Block, error) {
+	var raw json.RawMessage
+	if err := b.engine.CallContext(ctx, &raw, "eth_getBlockByHash", hash, true); err != nil {
+		return nil, fmt.Errorf("cannot get block %s: %v", hash, err)
+	}
+	var header *ethTypes.Header
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("unknown block %s", hash)
+	}
+	var body struct {
+		Transactions []*ethTypes.Transaction `json:"transactions"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	return ethTypes.NewBlockWithHeader(header).WithBody(body.Transactions, nil), nil
+}
+
+// submitSlot builds a block for the proposer of the slot registered with each relay, and submits it. Proposers with
+// the same preferences get the same block. It returns the number of submissions relays accepted.
+func (b *BuilderBackend) submitSlot(ctx context.Context, slot uint64, head *builderHead) int {
+	slog := b.log.WithField("slot", slot)
+	if err := b.syncParent(ctx, head.parentHash); err != nil {
+		slog.WithError(err).Warn("Unable to sync parent")
+		return 0
+	}
+	builds := make(map[builderBuildKey]*builderBuild)
+	accepted := 0
+	for _, relay := range b.relays {
+		rlog := slog.WithField("relay", relay)
+		entries, err := api.RelayGetValidators(ctx, relay.Address)
+		if err != nil {
+			rlog.WithError(err).Warn("Unable to get proposers")
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Slot != slot || entry.Entry == nil || entry.Entry.Message == nil {
+				continue
+			}
+			registration := entry.Entry.Message
+			key := builderBuildKey{registration.FeeRecipient, registration.GasLimit}
+			build, ok := builds[key]
+			if !ok {
+				build, err = b.build(head, common.Address(registration.FeeRecipient), registration.GasLimit)
+				if err != nil {
+					rlog.WithError(err).Error("Failed to build block")
+					continue
+				}
+				builds[key] = build
+			}
+			if err := b.submit(ctx, rlog, relay, slot, registration, build); err != nil {
+				rlog.WithError(err).Warn("Relay rejected block")
+				continue
+			}
+			accepted++
+		}
+	}
+	return accepted
+}
+
+// build makes a block with the transaction mix for the fee recipient. With a payment key, the builder is the
+// coinbase instead, and pays what the mix earns the fee recipient, plus the subsidy, with a final transaction.
+func (b *BuilderBackend) build(head *builderHead, feeRecipient common.Address, gasLimit uint64) (*builderBuild, error) {
+	parent := b.mockChain.chain.GetHeaderByHash(head.parentHash)
+	gasLimit = core.CalcGasLimit(parent.GasLimit, gasLimit)
+	payload, err := b.buildPayload(head, feeRecipient, gasLimit, b.txs)
+	if err != nil {
+		return nil, err
+	}
+	value, err := b.mockChain.PayloadValue(payload)
+	if err != nil {
+		return nil, err
+	}
+	if b.payment != nil {
+		value.Add(value, b.subsidy)
+		payload, err = b.buildPayload(head, b.payment.addr, gasLimit, paymentTxsCreator(b.txs, b.payment, feeRecipient, value))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &builderBuild{payload, value}, nil
+}
+
+func (b *BuilderBackend) buildPayload(head *builderHead, coinbase common.Address, gasLimit uint64, txsCreator TransactionsCreator) (*types.ExecutionPayloadV1, error) {
+	bl, err := b.mockChain.AddNewBlock(head.parentHash, coinbase, head.timestamp, gasLimit, txsCreator,
+		head.prevRandao, []byte{}, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create block: %v", err)
+	}
+	return api.BlockToPayload(bl)
+}
+
+// submit signs the bid trace of the block for the proposer, and submits the block to the relay.
+func (b *BuilderBackend) submit(ctx context.Context, log logrus.Ext1FieldLogger, relay *api.RelayEntry, slot uint64, registration *types.RegisterValidatorRequestMessage, build *builderBuild) error {
+	restPayload, err := types.ELPayloadToRESTPayload(build.payload)
+	if err != nil {
+		return err
+	}
+	trace := &types.BidTrace{
+		Slot:                 slot,
+		ParentHash:           types.Hash(build.payload.ParentHash),
+		BlockHash:            types.Hash(build.payload.BlockHash),
+		BuilderPubkey:        b.pk,
+		ProposerPubkey:       registration.Pubkey,
+		ProposerFeeRecipient: registration.FeeRecipient,
+		GasLimit:             build.payload.GasLimit,
+		GasUsed:              build.payload.GasUsed,
+		Value:                types.U256Str(common.BigToHash(build.value)),
+	}
+	root, err := types.ComputeSigningRoot(trace, b.builderDomain)
+	if err != nil {
+		return err
+	}
+	var signature types.Signature
+	signature.FromSlice(b.sk.Sign(root[:]).Marshal())
+	submission := &types.BuilderSubmitBlockRequest{Signature: signature, Message: trace, ExecutionPayload: restPayload}
+	log = log.WithField("blockHash", build.payload.BlockHash).WithField("value", build.value)
+	if err := api.RelaySubmitBlock(ctx, log, relay.Address, submission); err != nil {
+		return err
+	}
+	log.Info("Relay accepted block")
+	return nil
+}
+
+// attributesEvents keeps the payload attributes events of a beacon node, by proposal slot.
+type attributesEvents struct {
+	log    logrus.Ext1FieldLogger
+	mu     sync.Mutex
+	events map[uint64]*payloadAttributesEventData
+}
+
+func newAttributesEvents(log logrus.Ext1FieldLogger) *attributesEvents {
+	return &attributesEvents{log: log, events: make(map[uint64]*payloadAttributesEventData)}
+}
+
+// follow keeps the payload attributes events of the beacon node, reconnecting when the stream ends.
+func (e *attributesEvents) follow(ctx context.Context, beaconAddr string) {
+	for {
+		if err := e.read(ctx, beaconAddr); err != nil && ctx.Err() == nil {
+			e.log.WithError(err).Warn("Beacon event stream ended")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (e *attributesEvents) read(ctx context.Context, beaconAddr string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, beaconAddr+pathEvents+"?topics="+topicPayloadAttributes, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("beacon API returned non-200 status code: %d", resp.StatusCode)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data := strings.TrimPrefix(scanner.Text(), "data: ")
+		if data == scanner.Text() {
+			continue
+		}
+		event := new(payloadAttributesEvent)
+		if err := json.Unmarshal([]byte(data), event); err != nil {
+			e.log.WithError(err).Warn("Invalid payload attributes event")
+			continue
+		}
+		e.add(&event.Data)
+	}
+	return scanner.Err()
+}
+
+func (e *attributesEvents) add(event *payloadAttributesEventData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events[event.ProposalSlot] = event
+	for slot := range e.events {
+		if slot+attributesEventsKept < event.ProposalSlot {
+			delete(e.events, slot)
+		}
+	}
+}
+
+// get returns the event for the proposal slot, if any.
+func (e *attributesEvents) get(slot uint64) *payloadAttributesEventData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.events[slot]
+}
+
+// beaconGenesisOf gets the genesis of a beacon API.
+func beaconGenesisOf(ctx context.Context, beaconAddr string) (*beaconGenesis, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, beaconAddr+pathGenesis, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("beacon API returned non-200 status code: %d", resp.StatusCode)
+	}
+	var genesis struct {
+		Data beaconGenesis `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&genesis); err != nil {
+		return nil, err
+	}
+	return &genesis.Data, nil
+}
+
+// txMixCreator creates the transaction mix: transfers of the accounts to themselves, round-robin, as far as the
+// accounts can pay for them and the block has gas for them besides a payment.
+func txMixCreator(cfg *BuilderTxsConfig) TransactionsCreator {
+	tip, _ := new(big.Float).Mul(big.NewFloat(cfg.Tip), big.NewFloat(params.GWei)).Int(nil)
+	gas := params.TxGas + cfg.Calldata*params.TxDataZeroGas
+	count, calldata := cfg.Count, cfg.Calldata
+	return TransactionsCreator{cfg.Accounts.accounts, func(config *params.ChainConfig, bc core.ChainContext,
+		statedb *state.StateDB, header *ethTypes.Header, vmCfg vm.Config, accounts []TestAccount) ([]*ethTypes.Transaction, error) {
+		if len(accounts) == 0 {
+			return nil, nil
+		}
+		signer := ethTypes.NewLondonSigner(config.ChainID)
+		feeCap := new(big.Int).Add(header.BaseFee, tip)
+		cost := new(big.Int).Mul(feeCap, new(big.Int).SetUint64(gas))
+		nonces := make([]uint64, len(accounts))
+		balances := make([]*big.Int, len(accounts))
+		for i, account := range accounts {
+			nonces[i] = statedb.GetNonce(account.addr)
+			balances[i] = new(big.Int).Set(statedb.GetBalance(account.addr))
+		}
+		var txs []*ethTypes.Transaction
+		gasLeft := header.GasLimit - params.TxGas
+		for n := uint64(0); n < count && gas <= gasLeft; n++ {
+			i := int(n % uint64(len(accounts)))
+			if balances[i].Cmp(cost) < 0 {
+				continue
+			}
+			tx, err := ethTypes.SignNewTx(accounts[i].pk, signer, &ethTypes.DynamicFeeTx{
+				ChainID:   config.ChainID,
+				Nonce:     nonces[i],
+				To:        &accounts[i].addr,
+				Gas:       gas,
+				GasFeeCap: feeCap,
+				GasTipCap: tip,
+				Data:      make([]byte, calldata),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("cannot sign transaction: %v", err)
+			}
+			txs = append(txs, tx)
+			nonces[i]++
+			balances[i].Sub(balances[i], cost)
+			gasLeft -= gas
+		}
+		return txs, nil
+	}}
+}
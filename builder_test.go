@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"mergemock/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	account := crypto.PubkeyToAddress(key.PublicKey)
+	relay := newTestRelay(t)
+	relay.engine.GenesisPath = newGenesis(t, account)
+	// Ports of its own, the builder follows this engine and not those of other tests
+	relay.engine.ListenAddr = "127.0.0.1:38581"
+	relay.engine.WebsocketAddr = "127.0.0.1:38582"
+	require.NoError(t, relay.engine.Run(ctx))
+	srv := httptest.NewServer(relay.getRouter())
+	defer srv.Close()
+
+	proposer := relay.validators.Proposer(1)
+	registration, err := proposer.Registration(uint64(time.Now().Unix()), types.DomainBuilder)
+	require.NoError(t, err)
+	rr := relay.testRequest(t, "POST", pathRegisterValidator, []*types.SignedValidatorRegistration{registration})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// The builder follows the head of the relay engine, and pays the proposer from its transaction mix account
+	cfg := new(BuilderCmd)
+	cfg.Default()
+	cfg.Txs.Default()
+	cfg.Txs.Count = 3
+	cfg.Txs.Calldata = 16
+	hexKey := common.Bytes2Hex(crypto.FromECDSA(key))
+	require.NoError(t, cfg.Txs.Accounts.Set(hexKey))
+	require.NoError(t, cfg.Payment.Set(hexKey))
+	cfg.Subsidy = 0.1
+	cfg.EngineAddr = "http://" + relay.engine.ListenAddr
+	cfg.JwtSecretPath = relay.engine.JwtSecretPath
+	cfg.GenesisPath = relay.engine.GenesisPath
+	cfg.BeaconGenesisTime = uint64(time.Now().Unix())
+	cfg.RelayAddrs = []string{srv.URL}
+	builder, err := NewBuilderBackend(ctx, logrus.New(), cfg)
+	require.NoError(t, err)
+	defer builder.Close()
+
+	var head *builderHead
+	require.Eventually(t, func() bool {
+		head, err = builder.head(ctx, 1)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond, "engine not reachable")
+	require.Equal(t, relay.engine.mockChain().CurrentHeader().Hash(), head.parentHash)
+	require.Equal(t, 1, builder.submitSlot(ctx, 1, head))
+
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/%s", 1, head.parentHash.Hex(), proposer.Pubkey)
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	bid := new(types.VersionedSignedBuilderBid)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	value := bid.Value()
+	require.Equal(t, 1, new(big.Int).SetBytes(value[:]).Cmp(etherToWei(cfg.Subsidy)), "bid is not the tips of the mix plus the subsidy")
+
+	block, err := signBlindedBlockForBid(proposer, 1, bid, &types.Mainnet, &relay.genesisValidatorsRoot)
+	require.NoError(t, err)
+	rr = relay.testRequest(t, "POST", pathGetPayload, block)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	payload := new(types.VersionedExecutionPayload)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), payload))
+	require.Equal(t, bid.BlockHash(), payload.BlockHash())
+	require.Len(t, payload.Bellatrix.Transactions, 4, "transaction mix and payment not included")
+}
+
+func TestBuilderSubmissionTimes(t *testing.T) {
+	b := &BuilderBackend{genesisTime: 1000, slotTime: 12 * time.Second, submitAt: []time.Duration{6 * time.Second, 10 * time.Second}}
+	genesis := time.Unix(1000, 0)
+
+	slot, at := b.nextSubmission(genesis.Add(-time.Minute))
+	require.Equal(t, uint64(1), slot)
+	require.Equal(t, genesis.Add(6*time.Second), at)
+
+	slot, at = b.nextSubmission(genesis.Add(7 * time.Second))
+	require.Equal(t, uint64(1), slot)
+	require.Equal(t, genesis.Add(10*time.Second), at)
+
+	// After the last submission time of the slot, the next submission is in the next slot, for the proposal after it
+	slot, at = b.nextSubmission(genesis.Add(10 * time.Second))
+	require.Equal(t, uint64(2), slot)
+	require.Equal(t, genesis.Add(18*time.Second), at)
+}
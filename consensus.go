@@ -10,7 +10,9 @@ import (
 	"mergemock/p2p"
 	"mergemock/rpc"
 	"mergemock/types"
+	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -23,9 +25,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/params"
-	"github.com/prysmaticlabs/prysm/crypto/bls"
-	"github.com/prysmaticlabs/prysm/crypto/bls/blst"
-	"github.com/prysmaticlabs/prysm/runtime/version"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/sirupsen/logrus"
 )
 
@@ -33,24 +33,35 @@ type ConsensusCmd struct {
 	BeaconGenesisTime uint64        `ask:"--beacon-genesis-time" help:"Beacon genesis time"`
 	SlotTime          time.Duration `ask:"--slot-time" help:"Time per slot"`
 	SlotsPerEpoch     uint64        `ask:"--slots-per-epoch" help:"Slots per epoch"`
+	CapellaForkEpoch  uint64        `ask:"--capella-fork-epoch" help:"Epoch of the Capella fork, from which builder bids and blinded blocks are Capella ones"`
+	DenebForkEpoch    uint64        `ask:"--deneb-fork-epoch" help:"Epoch of the Deneb fork, from which builder bids and blinded blocks are Deneb ones"`
 	// TODO ideas:
 	// - % random gap slots (= missing beacon blocks)
 	// - % random finality
 
-	EngineAddr    string `ask:"--engine" help:"Address of Engine JSON-RPC endpoint to use"`
-	BuilderAddr   string `ask:"--builder" help:"Address of builder relay REST API endpoint to use"`
-	DataDir       string `ask:"--datadir" help:"Directory to store execution chain data (empty for in-memory data)"`
-	EthashDir     string `ask:"--ethashdir" help:"Directory to store ethash data"`
-	GenesisPath   string `ask:"--genesis" help:"Genesis execution-config file"`
-	JwtSecretPath string `ask:"--jwt-secret" help:"JWT secret key for authenticated communication"`
-	Enode         string `ask:"--node" help:"Enode of execution client, required to insert pre-merge blocks."`
-	SlotBound     uint64 `ask:"--slot-bound" help:"Terminate after the specified number of slots."`
+	EngineAddr    string   `ask:"--engine" help:"Address of Engine JSON-RPC endpoint to use"`
+	BuilderAddrs  []string `ask:"--builder" help:"Addresses of builder relay REST API endpoints to use, a relay pubkey can be pinned with http://0xpubkey@host:port"`
+	DataDir       string   `ask:"--datadir" help:"Directory to store execution chain data (empty for in-memory data)"`
+	EthashDir     string   `ask:"--ethashdir" help:"Directory to store ethash data"`
+	GenesisPath   string   `ask:"--genesis" help:"Genesis execution-config file"`
+	JwtSecretPath string   `ask:"--jwt-secret" help:"JWT secret key for authenticated communication"`
+	Enode         string   `ask:"--node" help:"Enode of execution client, required to insert pre-merge blocks."`
+	SlotBound     uint64   `ask:"--slot-bound" help:"Terminate after the specified number of slots."`
+
+	BuilderTimeout time.Duration `ask:"--builder-timeout" help:"Time to wait for a builder bid before falling back to the local payload"`
+	BuilderMinBid  float64       `ask:"--builder-min-bid" help:"Minimum builder bid value, in ETH, to prefer it over the local payload"`
+	BuilderSSZ     bool          `ask:"--builder-ssz" help:"Prefer SSZ over JSON encoding with the builder API, falling back to JSON for relays without SSZ support"`
+
+	BeaconAddr string `ask:"--beacon-addr" help:"Address to serve a beacon API stand-in on, for validator clients and mev-boost (disabled if empty)"`
 
 	GenesisValidatorsRoot string `ask:"--genesis-validators-root" help:"Root of genesis validators"`
+	Network               string `ask:"--network" help:"Network whose fork versions sign builder and proposer messages: mainnet, sepolia, holesky, or a consensus spec config YAML file"`
 
 	// embed consensus behaviors
 	ConsensusBehavior `ask:"."`
 
+	Validators ValidatorsConfig `ask:".validators" help:"Configure the simulated validator set"`
+
 	// embed logger options
 	LogCmd `ask:".log" help:"Change logger configuration"`
 
@@ -64,11 +75,18 @@ type ConsensusCmd struct {
 	db        ethdb.Database
 
 	genesisValidatorsRoot types.Root
+	forks                 types.ForkSchedule
+	network               *types.Network
 
 	ethashCfg ethash.Config
 
-	mockChain *MockChain
-	sk        bls.SecretKey
+	mockChain  *MockChain
+	validators *ValidatorSet
+	relays     []*api.RelayEntry
+
+	beacon    *beaconChain
+	produced  *lru.Cache // payloads of blinded blocks produced by the beacon API, by block hash
+	beaconSrv *http.Server
 }
 
 func (c *ConsensusCmd) Default() {
@@ -78,10 +96,14 @@ func (c *ConsensusCmd) Default() {
 	c.JwtSecretPath = "jwt.hex"
 	c.Enode = ""
 	c.SlotBound = 0
+	c.BuilderTimeout = time.Second
 	c.SlotTime = time.Second * 12
 	c.SlotsPerEpoch = 32
+	c.CapellaForkEpoch = math.MaxUint64
+	c.DenebForkEpoch = math.MaxUint64
 	c.LogLvl = "info"
 	c.GenesisValidatorsRoot = "0x0000000000000000000000000000000000000000000000000000000000000000"
+	c.Network = types.Mainnet.Name
 }
 
 func (c *ConsensusCmd) Help() string {
@@ -105,6 +127,14 @@ func (c *ConsensusCmd) Run(ctx context.Context, args ...string) error {
 	log.WithField("val", common.Bytes2Hex(c.jwtSecret[:])).Info("Loaded JWT secret")
 
 	c.genesisValidatorsRoot = types.Root(common.HexToHash(c.GenesisValidatorsRoot))
+	c.forks = types.ForkSchedule{
+		SlotsPerEpoch: c.SlotsPerEpoch,
+		CapellaEpoch:  c.CapellaForkEpoch,
+		DenebEpoch:    c.DenebForkEpoch,
+	}
+	if c.network, err = loadNetwork(c.Network); err != nil {
+		return err
+	}
 
 	// Connect to execution client engine api
 	client, err := rpc.DialContext(ctx, c.EngineAddr, c.jwtSecret)
@@ -112,11 +142,20 @@ func (c *ConsensusCmd) Run(ctx context.Context, args ...string) error {
 		return err
 	}
 
-	// Create a BLS key
-	c.sk, err = blst.RandKey()
+	for _, addr := range c.BuilderAddrs {
+		relay, err := api.ParseRelayEntry(addr)
+		if err != nil {
+			return err
+		}
+		c.relays = append(c.relays, relay)
+	}
+
+	// Load the validator keys and proposer preferences
+	c.validators, err = NewValidatorSet(&c.Validators, c.SlotsPerEpoch, c.genesisValidatorsRoot)
 	if err != nil {
-		return errors.New("unable to generate bls key pair")
+		return fmt.Errorf("unable to load validators: %v", err)
 	}
+	log.WithField("count", c.validators.Len()).Info("Loaded validators")
 
 	c.ethashCfg = ethash.Config{
 		PowMode:        ethash.ModeNormal,
@@ -139,6 +178,14 @@ func (c *ConsensusCmd) Run(ctx context.Context, args ...string) error {
 	c.ctx = ctx
 	c.close = make(chan struct{})
 
+	c.beacon = newBeaconChain(c.SlotsPerEpoch)
+	if c.produced, err = lru.New(beaconProducedPayloadKept); err != nil {
+		return err
+	}
+	if c.BeaconAddr != "" {
+		c.startBeaconAPI(log)
+	}
+
 	go c.RunNode()
 
 	return nil
@@ -257,6 +304,9 @@ func (c *ConsensusCmd) RunNode() {
 		os.Exit(1)
 	}
 	c.mockChain = mc
+	c.beacon.addMockBlock(0, 0, mc.CurrentHeader())
+
+	go c.registerValidators()
 
 	for {
 		select {
@@ -272,6 +322,7 @@ func (c *ConsensusCmd) RunNode() {
 			if signedSlot == 0 {
 				c.log.WithField("slot", 0).Info("Genesis!")
 				safeHash = c.mockChain.CurrentHeader().Hash()
+				c.beacon.setCheckpoints(safeHash, finalizedHash)
 				continue
 			}
 			slot := uint64(signedSlot)
@@ -284,7 +335,9 @@ func (c *ConsensusCmd) RunNode() {
 				finalizedHash = nextFinalized
 				safeHash = finalizedHash
 				nextFinalized = c.mockChain.CurrentHeader().Hash()
+				c.beacon.setCheckpoints(safeHash, finalizedHash)
 				c.log.WithField("slot", slot).WithField("last", last).WithField("new", finalizedHash).WithField("next", nextFinalized).Info("Finalized block updated")
+				go c.registerValidators()
 			}
 			// Gap slot
 			if c.RNG.Float64() < c.Freq.GapSlot {
@@ -314,6 +367,17 @@ func (c *ConsensusCmd) RunNode() {
 				continue
 			}
 
+			// A validator client may propose the slot through the beacon API instead,
+			// the block it publishes is the one of the slot then
+			if !c.beacon.claimSlot(slot, claimMock) {
+				c.log.WithField("slot", slot).Info("Slot is proposed through the beacon API")
+				select {
+				case <-payloadId:
+				default:
+				}
+				continue
+			}
+
 			// Fake some forking by building on an ancestor
 			parent := c.mockChain.CurrentHeader()
 			if c.RNG.Float64() < c.Freq.ReorgFreq {
@@ -327,14 +391,16 @@ func (c *ConsensusCmd) RunNode() {
 				parent = c.calcReorgTarget(c.mockChain.chain, parent.Number.Uint64(), min)
 			}
 
-			slotLog := c.log.WithField("slot", slot)
+			proposer := c.validators.Proposer(slot)
+			slotLog := c.log.WithField("slot", slot).WithField("proposer", proposer.Index)
 			slotLog.WithField("previous", parent.Hash()).Info("Slot trigger")
 
 			// If we're proposing, get a block from the engine!
 			select {
 			case id := <-payloadId:
-				slotLog.WithField("payloadId", id).Info("Update forkchoice to block built by engine")
-				go c.mockProposal(slotLog, id, slot, false)
+				consensusFail, announce := c.proposalOutcome()
+				slotLog.WithField("payloadId", id).WithField("ignored", consensusFail).Info("Update forkchoice to block built by engine")
+				go c.mockProposal(slotLog, id, slot, consensusFail, announce)
 				continue
 			default:
 				// Not proposing a block
@@ -343,21 +409,14 @@ func (c *ConsensusCmd) RunNode() {
 			// Build a block, without using the engine, and insert it into the engine
 			slotLog.Debug("Mocking external block")
 
-			// TODO: different proposers, gas limit (target in london) changes, etc.
-			coinbase := common.Address{1}
-			timestamp := c.SlotTimestamp(slot)
-			gasLimit := parent.GasLimit
-			extraData := []byte("proto says hi")
-			uncleBlocks := []*ethTypes.Header{}
-			creator := TransactionsCreator{c.ConsensusBehavior.TestAccounts.accounts, dummyTxCreator}
-
-			block, err := c.mockChain.AddNewBlock(parent.Hash(), coinbase, timestamp, gasLimit, creator, [32]byte{}, extraData, uncleBlocks, true)
+			block, err := c.buildBlock(slot, proposer, parent, true)
 			if err != nil {
 				slotLog.WithError(err).Errorf("Failed to add block")
 				continue
 			}
 
 			slotLog.WithField("blockhash", block.Hash()).Debug("Built external block")
+			c.beacon.addMockBlock(slot, proposer.Index, block.Header())
 
 			go func(log logrus.Ext1FieldLogger, block *ethTypes.Block, safe, final common.Hash) {
 				c.mockExecution(log, block)
@@ -368,6 +427,7 @@ func (c *ConsensusCmd) RunNode() {
 				if c.RNG.Float64() < c.Freq.ProposalFreq {
 					// proposing next slot!
 					attributes = c.makePayloadAttributes(slot + 1)
+					c.publishPayloadAttributes(slot+1, block.Header(), attributes)
 				}
 				id, err := c.sendForkchoiceUpdated(latest, safe, final, attributes)
 				if err != nil {
@@ -381,6 +441,11 @@ func (c *ConsensusCmd) RunNode() {
 		case <-c.close:
 			c.log.Info("Closing consensus mock node")
 			c.engine.Close()
+			if c.beaconSrv != nil {
+				if err := c.beaconSrv.Close(); err != nil {
+					c.log.WithError(err).Error("Failed closing beacon API")
+				}
+			}
 			if err := c.mockChain.Close(); err != nil {
 				c.log.WithError(err).Error("Failed closing mock chain")
 			}
@@ -391,6 +456,18 @@ func (c *ConsensusCmd) RunNode() {
 	}
 }
 
+// buildBlock builds a block for the proposer of the slot without the engine, and inserts it in the mock chain if store is set.
+func (c *ConsensusCmd) buildBlock(slot uint64, proposer *Validator, parent *ethTypes.Header, store bool) (*ethTypes.Block, error) {
+	coinbase := proposer.FeeRecipient
+	timestamp := c.SlotTimestamp(slot)
+	gasLimit := core.CalcGasLimit(parent.GasLimit, proposer.GasLimit)
+	extraData := []byte("proto says hi")
+	uncleBlocks := []*ethTypes.Header{}
+	creator := TransactionsCreator{c.ConsensusBehavior.TestAccounts.accounts, dummyTxCreator}
+
+	return c.mockChain.AddNewBlock(parent.Hash(), coinbase, timestamp, gasLimit, creator, [32]byte{}, extraData, uncleBlocks, store)
+}
+
 func (c *ConsensusCmd) sendForkchoiceUpdated(latest, safe, final common.Hash, attributes *types.PayloadAttributesV1) (*types.PayloadID, error) {
 	result, _ := api.ForkchoiceUpdatedV1(c.ctx, c.engine, c.log, latest, safe, final, attributes)
 	if result.PayloadStatus.Status != types.ExecutionValid {
@@ -400,51 +477,287 @@ func (c *ConsensusCmd) sendForkchoiceUpdated(latest, safe, final common.Hash, at
 	return result.PayloadID, nil
 }
 
-func (c *ConsensusCmd) getMockProposal(ctx context.Context, log logrus.Ext1FieldLogger, payloadId types.PayloadID, slot uint64) (*types.ExecutionPayloadV1, error) {
-	// If the CL is connected to builder client, request the payload from there.
-	if c.BuilderAddr != "" {
-		header, err := api.BuilderGetHeader(c.ctx, log, c.BuilderAddr, slot, c.mockChain.CurrentHeader().Hash(), c.sk.PublicKey().Marshal())
+// registerValidators sends fresh registrations of all validators to every builder relay.
+func (c *ConsensusCmd) registerValidators() {
+	if len(c.relays) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, c.SlotTime)
+	defer cancel()
+
+	timestamp := uint64(time.Now().Unix())
+	registrations := make([]*types.SignedValidatorRegistration, 0, c.validators.Len())
+	for _, v := range c.validators.Validators() {
+		registration, err := v.Registration(timestamp, c.network.BuilderDomain())
 		if err != nil {
-			return nil, err
+			c.log.WithError(err).WithField("validator", v.Index).Error("Failed to sign validator registration")
+			return
+		}
+		registrations = append(registrations, registration)
+	}
+	var wg sync.WaitGroup
+	for _, relay := range c.relays {
+		wg.Add(1)
+		go func(relay *api.RelayEntry) {
+			defer wg.Done()
+			log := c.log.WithField("relay", relay)
+			if err := api.BuilderRegisterValidators(ctx, log, relay.Address, registrations, c.BuilderSSZ); err != nil {
+				log.WithError(err).Error("Failed to register validators with builder")
+				return
+			}
+			log.WithField("count", len(registrations)).Info("Registered validators with builder")
+		}(relay)
+	}
+	wg.Wait()
+}
+
+func (c *ConsensusCmd) getMockProposal(ctx context.Context, log logrus.Ext1FieldLogger, payloadId types.PayloadID, slot uint64) (*types.ExecutionPayloadV1, error) {
+	// Without a builder, the payload comes from the EL.
+	if len(c.relays) == 0 {
+		return api.GetPayloadV1(ctx, c.engine, log, payloadId)
+	}
+
+	// Otherwise ask both the EL and the builders, like mev-boost would, and pick the best.
+	var (
+		proposer = c.validators.Proposer(slot)
+		local    *types.ExecutionPayloadV1
+		localErr error
+		relay    *api.RelayEntry
+		bid      *types.VersionedSignedBuilderBid
+		bidErr   error
+		wg       sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		local, localErr = api.GetPayloadV1(ctx, c.engine, log, payloadId)
+	}()
+	go func() {
+		defer wg.Done()
+		relay, bid, bidErr = c.getBestBid(ctx, log, slot, c.mockChain.CurrentHeader().Hash(), proposer)
+	}()
+	wg.Wait()
+
+	decision := log.WithField("minBid", c.BuilderMinBid)
+	if localErr != nil && bidErr != nil {
+		return nil, fmt.Errorf("no local payload (%v) and no builder bid (%v)", localErr, bidErr)
+	}
+	if bidErr != nil {
+		decision.WithError(bidErr).Warn("Builder bid unavailable, proposing local payload")
+		return local, nil
+	}
+	value := bid.Value()
+	bidValue := new(big.Int).SetBytes(value[:])
+	decision = decision.WithField("bidValue", bidValue).WithField("relay", relay)
+	if localErr != nil {
+		decision.WithError(localErr).Warn("Local payload unavailable, proposing builder payload")
+		return c.getBuilderPayload(ctx, log, relay, proposer, slot, bid)
+	}
+	localValue, err := c.mockChain.PayloadValue(local)
+	if err != nil {
+		decision.WithError(err).Warn("Unable to compute local payload value, proposing local payload")
+		return local, nil
+	}
+	decision = decision.WithField("localValue", localValue)
+	minBid := etherToWei(c.BuilderMinBid)
+	if bidValue.Cmp(minBid) < 0 {
+		decision.Info("Builder bid below minimum, proposing local payload")
+		return local, nil
+	}
+	if bidValue.Cmp(localValue) < 0 {
+		decision.Info("Builder bid below local payload value, proposing local payload")
+		return local, nil
+	}
+	decision.Info("Builder bid matches or beats local payload, proposing builder payload")
+	return c.getBuilderPayload(ctx, log, relay, proposer, slot, bid)
+}
+
+// getBestBid requests a header from all relays at once, and returns the most valuable valid bid
+// that arrived before the builder timeout.
+func (c *ConsensusCmd) getBestBid(ctx context.Context, log logrus.Ext1FieldLogger, slot uint64, parentHash common.Hash, proposer *Validator) (*api.RelayEntry, *types.VersionedSignedBuilderBid, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.BuilderTimeout)
+	defer cancel()
+
+	type relayBid struct {
+		relay *api.RelayEntry
+		bid   *types.VersionedSignedBuilderBid
+		err   error
+	}
+	results := make(chan relayBid, len(c.relays))
+	for _, relay := range c.relays {
+		go func(relay *api.RelayEntry) {
+			bid, err := api.BuilderGetHeader(ctx, log.WithField("relay", relay), relay.Address, &c.forks, c.network.BuilderDomain(), slot, parentHash, proposer.Pubkey[:], relay.Pubkey, c.BuilderSSZ)
+			if err == nil && common.Hash(bid.ParentHash()) != parentHash {
+				err = fmt.Errorf("bid builds on %s instead of %s", common.Hash(bid.ParentHash()), parentHash)
+			}
+			results <- relayBid{relay, bid, err}
+		}(relay)
+	}
+
+	var (
+		best      relayBid
+		bestValue *big.Int
+	)
+	for range c.relays {
+		res := <-results
+		if res.err != nil {
+			log.WithField("relay", res.relay).WithError(res.err).Warn("Ignoring relay without valid bid")
+			continue
 		}
+		bidValue := res.bid.Value()
+		value := new(big.Int).SetBytes(bidValue[:])
+		log.WithField("relay", res.relay).WithField("value", value).Debug("Received bid")
+		if bestValue == nil || value.Cmp(bestValue) > 0 {
+			best, bestValue = res, value
+		}
+	}
+	if bestValue == nil {
+		return nil, nil, errors.New("no valid bid from any relay")
+	}
+	return best.relay, best.bid, nil
+}
+
+// getBuilderPayload signs the blinded block for the bid and reveals it to the builder.
+// Once signed there is no way back to the local payload, failures here miss the slot.
+func (c *ConsensusCmd) getBuilderPayload(ctx context.Context, log logrus.Ext1FieldLogger, relay *api.RelayEntry, proposer *Validator, slot uint64, bid *types.VersionedSignedBuilderBid) (*types.ExecutionPayloadV1, error) {
+	signedBlindedBeaconBlock, err := signBlindedBlockForBid(proposer, slot, bid, c.network, &c.genesisValidatorsRoot)
+	if err != nil {
+		return nil, err
+	}
 
-		signedBlindedBeaconBlock := &types.SignedBlindedBeaconBlock{
+	payload, err := api.BuilderGetPayload(ctx, log, proposer.sk, relay.Address, signedBlindedBeaconBlock, c.BuilderSSZ)
+	if err != nil {
+		return nil, err
+	}
+	if payload.BlockHash != common.Hash(bid.BlockHash()) {
+		return nil, fmt.Errorf("builder payload %s does not match bid %s", payload.BlockHash, common.Hash(bid.BlockHash()))
+	}
+	log.WithField("hash", payload.BlockHash.Hex()).WithField("relay", relay).Info("received payload from builder")
+
+	// The proposer is either the fee recipient, or paid by the builder within the payload.
+	value := bid.Value()
+	bidValue := new(big.Int).SetBytes(value[:])
+	if paid, err := c.mockChain.PaymentValue(payload, proposer.FeeRecipient); err != nil {
+		log.WithError(err).Warn("Unable to verify builder payment")
+	} else if paid.Cmp(bidValue) < 0 {
+		log.WithFields(logrus.Fields{"paid": paid, "bidValue": bidValue}).Warn("Builder paid less than its bid")
+	}
+	return payload, nil
+}
+
+// signBlindedBlockForBid makes the proposer sign a blinded block with the header of the bid, of the same fork as the bid.
+func signBlindedBlockForBid(proposer *Validator, slot uint64, bid *types.VersionedSignedBuilderBid, network *types.Network, genesisValidatorsRoot *types.Root) (*types.VersionedSignedBlindedBeaconBlock, error) {
+	domain, err := network.ProposerDomain(bid.Version, genesisValidatorsRoot)
+	if err != nil {
+		return nil, err
+	}
+	block, err := blindedBlockForBid(&blockFields{slot: slot, proposerIndex: proposer.Index}, bid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := proposer.Sign(block.Message(), domain)
+	if err != nil {
+		return nil, err
+	}
+	block.SetSignature(signature)
+	return block, nil
+}
+
+// blockFields are the consensus parts of a block made by the consensus mock. The operations of the body stay empty.
+type blockFields struct {
+	slot          uint64
+	proposerIndex uint64
+	parentRoot    types.Root
+	stateRoot     types.Root
+	randaoReveal  types.Signature
+	graffiti      types.Hash
+}
+
+// blindedBlockForBid makes an unsigned blinded block with the header of the bid, of the same fork as the bid.
+func blindedBlockForBid(f *blockFields, bid *types.VersionedSignedBuilderBid) (*types.VersionedSignedBlindedBeaconBlock, error) {
+	block := &types.VersionedSignedBlindedBeaconBlock{Version: bid.Version}
+	switch {
+	case bid.Bellatrix != nil:
+		block.Bellatrix = &types.SignedBlindedBeaconBlock{
 			Message: &types.BlindedBeaconBlock{
-				Slot:          slot,
-				ProposerIndex: 1,
+				Slot:          f.slot,
+				ProposerIndex: f.proposerIndex,
+				ParentRoot:    f.parentRoot,
+				StateRoot:     f.stateRoot,
 				Body: &types.BlindedBeaconBlockBody{
+					RandaoReveal:           f.randaoReveal,
 					Eth1Data:               &types.Eth1Data{},
+					Graffiti:               f.graffiti,
+					ProposerSlashings:      []*types.ProposerSlashing{},
+					AttesterSlashings:      []*types.AttesterSlashing{},
+					Attestations:           []*types.Attestation{},
+					Deposits:               []*types.Deposit{},
+					VoluntaryExits:         []*types.VoluntaryExit{},
 					SyncAggregate:          &types.SyncAggregate{},
-					ExecutionPayloadHeader: header,
+					ExecutionPayloadHeader: bid.Bellatrix.Message.Header,
 				},
 			},
-			Signature: types.Signature{},
 		}
-		domain := types.ComputeDomain(types.DomainTypeBeaconProposer, version.Bellatrix, &c.genesisValidatorsRoot)
-		root, err := types.ComputeSigningRoot(signedBlindedBeaconBlock.Message, domain)
-		if err != nil {
-			return nil, err
+	case bid.Capella != nil:
+		block.Capella = &types.SignedBlindedBeaconBlockCapella{
+			Message: &types.BlindedBeaconBlockCapella{
+				Slot:          f.slot,
+				ProposerIndex: f.proposerIndex,
+				ParentRoot:    f.parentRoot,
+				StateRoot:     f.stateRoot,
+				Body: &types.BlindedBeaconBlockBodyCapella{
+					RandaoReveal:           f.randaoReveal,
+					Eth1Data:               &types.Eth1Data{},
+					Graffiti:               f.graffiti,
+					ProposerSlashings:      []*types.ProposerSlashing{},
+					AttesterSlashings:      []*types.AttesterSlashing{},
+					Attestations:           []*types.Attestation{},
+					Deposits:               []*types.Deposit{},
+					VoluntaryExits:         []*types.VoluntaryExit{},
+					SyncAggregate:          &types.SyncAggregate{},
+					ExecutionPayloadHeader: bid.Capella.Message.Header,
+					BLSToExecutionChanges:  []*types.SignedBLSToExecutionChange{},
+				},
+			},
 		}
-		sig := c.sk.Sign(root[:]).Marshal()
-		signedBlindedBeaconBlock.Signature.FromSlice(sig)
-
-		payload, err := api.BuilderGetPayload(ctx, log, c.sk, c.BuilderAddr, signedBlindedBeaconBlock)
-		if err != nil {
-			return nil, err
+	case bid.Deneb != nil:
+		block.Deneb = &types.SignedBlindedBeaconBlockDeneb{
+			Message: &types.BlindedBeaconBlockDeneb{
+				Slot:          f.slot,
+				ProposerIndex: f.proposerIndex,
+				ParentRoot:    f.parentRoot,
+				StateRoot:     f.stateRoot,
+				Body: &types.BlindedBeaconBlockBodyDeneb{
+					RandaoReveal:           f.randaoReveal,
+					Eth1Data:               &types.Eth1Data{},
+					Graffiti:               f.graffiti,
+					ProposerSlashings:      []*types.ProposerSlashing{},
+					AttesterSlashings:      []*types.AttesterSlashing{},
+					Attestations:           []*types.Attestation{},
+					Deposits:               []*types.Deposit{},
+					VoluntaryExits:         []*types.VoluntaryExit{},
+					SyncAggregate:          &types.SyncAggregate{},
+					ExecutionPayloadHeader: bid.Deneb.Message.Header,
+					BLSToExecutionChanges:  []*types.SignedBLSToExecutionChange{},
+					BlobKzgCommitments:     bid.Deneb.Message.BlobKzgCommitments,
+				},
+			},
 		}
-		c.log.WithField("hash", payload.BlockHash.Hex()).Info("received payload from builder")
-		return payload, err
+	default:
+		return nil, errors.New("incomplete bid")
 	}
+	return block, nil
+}
 
-	// Otherwise, get payload from EL.
-	payload, err := api.GetPayloadV1(c.ctx, c.engine, log, payloadId)
-	if err != nil {
-		return nil, err
-	}
-	return payload, err
+// proposalOutcome rolls whether the payload the engine produces fails to become canonical on the consensus side,
+// and if so whether it is still announced to the engine.
+func (c *ConsensusCmd) proposalOutcome() (consensusFail bool, announce bool) {
+	consensusFail = c.RNG.Float64() < c.Freq.FailedProposalFreq
+	announce = consensusFail && c.RNG.Float64() < c.Freq.IgnoredAnnounce
+	return consensusFail, announce
 }
 
-func (c *ConsensusCmd) mockProposal(log logrus.Ext1FieldLogger, payloadId types.PayloadID, slot uint64, consensusFail bool) {
+func (c *ConsensusCmd) mockProposal(log logrus.Ext1FieldLogger, payloadId types.PayloadID, slot uint64, consensusFail bool, announce bool) {
 	ctx, cancel := context.WithTimeout(c.ctx, time.Second*20)
 	defer cancel()
 
@@ -460,7 +773,12 @@ func (c *ConsensusCmd) mockProposal(log logrus.Ext1FieldLogger, payloadId types.
 		return
 	}
 	if consensusFail {
-		log.Debug("Mocking a failed proposal on consensus-side, ignoring produced payload of engine")
+		// The payload never becomes head: the mock chain is left untouched,
+		// so the next slot builds on the old parent again.
+		log.WithField("blockhash", payload.BlockHash).Debug("Mocking a failed proposal on consensus-side, ignoring produced payload of engine")
+		if announce {
+			c.mockOrphanedPayload(ctx, log, payload)
+		}
 		return
 	}
 	block, err := c.mockChain.ProcessPayload(payload)
@@ -471,6 +789,7 @@ func (c *ConsensusCmd) mockProposal(log logrus.Ext1FieldLogger, payloadId types.
 	} else {
 		log.WithField("blockhash", block.Hash()).Debug("Processed payload in consensus mock world")
 	}
+	c.beacon.addMockBlock(slot, c.validators.Proposer(slot).Index, block.Header())
 
 	// Send it back to execution layer for execution
 	res, err := api.NewPayloadV1(ctx, c.engine, log, payload)
@@ -488,6 +807,27 @@ func (c *ConsensusCmd) mockProposal(log logrus.Ext1FieldLogger, payloadId types.
 	maybeExit(c.SlotBound)
 }
 
+// mockOrphanedPayload sends a payload that will not become canonical back to the engine,
+// as if it was seen on the network, and checks the engine still accepts its own work.
+func (c *ConsensusCmd) mockOrphanedPayload(ctx context.Context, log logrus.Ext1FieldLogger, payload *types.ExecutionPayloadV1) {
+	res, err := api.NewPayloadV1(ctx, c.engine, log, payload)
+	if err != nil {
+		log.WithError(err).Error("Failed to execute orphaned payload")
+		maybeExit(c.SlotBound)
+		return
+	}
+	switch res.Status {
+	case types.ExecutionValid, types.ExecutionAccepted:
+		log.WithField("blockhash", payload.BlockHash).WithField("status", res.Status).Debug("Engine processed orphaned payload")
+	case types.ExecutionInvalid:
+		log.WithField("blockhash", payload.BlockHash).Error("Engine produced payload and rejected it once orphaned!")
+		maybeExit(c.SlotBound)
+	default:
+		log.WithField("status", res.Status).Error("Unrecognized execution status for orphaned payload")
+		maybeExit(c.SlotBound)
+	}
+}
+
 func (c *ConsensusCmd) mockExecution(log logrus.Ext1FieldLogger, block *ethTypes.Block) {
 	ctx, cancel := context.WithTimeout(c.ctx, time.Second*20)
 	defer cancel()
@@ -503,7 +843,7 @@ func (c *ConsensusCmd) mockExecution(log logrus.Ext1FieldLogger, block *ethTypes
 	api.NewPayloadV1(ctx, c.engine, log, payload)
 }
 
-func dummyTxCreator(config *params.ChainConfig, bc core.ChainContext, statedb *state.StateDB, header *ethTypes.Header, cfg vm.Config, accounts []TestAccount) []*ethTypes.Transaction {
+func dummyTxCreator(config *params.ChainConfig, bc core.ChainContext, statedb *state.StateDB, header *ethTypes.Header, cfg vm.Config, accounts []TestAccount) ([]*ethTypes.Transaction, error) {
 	// TODO create some more txs and use all accounts
 	if len(accounts) != 0 {
 		signer := ethTypes.NewLondonSigner(config.ChainID)
@@ -516,11 +856,13 @@ func dummyTxCreator(config *params.ChainConfig, bc core.ChainContext, statedb *s
 			GasTipCap: big.NewInt(2),
 			Data:      []byte{},
 		}
-		tx := ethTypes.NewTx(txdata)
-		tx, _ = ethTypes.SignTx(tx, signer, accounts[0].pk)
-		return []*ethTypes.Transaction{tx}
+		tx, err := ethTypes.SignTx(ethTypes.NewTx(txdata), signer, accounts[0].pk)
+		if err != nil {
+			return nil, err
+		}
+		return []*ethTypes.Transaction{tx}, nil
 	} else {
-		return nil
+		return nil, nil
 	}
 }
 
@@ -543,7 +885,7 @@ func (c *ConsensusCmd) makePayloadAttributes(slot uint64) *types.PayloadAttribut
 	return &types.PayloadAttributesV1{
 		Timestamp:             c.SlotTimestamp(slot),
 		PrevRandao:            prevRandao,
-		SuggestedFeeRecipient: common.Address{0x13, 0x37},
+		SuggestedFeeRecipient: c.validators.Proposer(slot).FeeRecipient,
 	}
 }
 
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"mergemock/api"
+	"mergemock/types"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsensusFail(t *testing.T) {
+	c, engine := newTestConsensusEngine(t)
+	c.ConsensusBehavior.Default()
+	c.Freq.FailedProposalFreq = 1
+	consensusFail, _ := c.proposalOutcome()
+	require.True(t, consensusFail)
+
+	parent := c.mockChain.CurrentHeader()
+	for _, announce := range []bool{false, true} {
+		id, err := c.sendForkchoiceUpdated(parent.Hash(), parent.Hash(), common.Hash{}, c.makePayloadAttributes(1))
+		require.NoError(t, err)
+		require.NotNil(t, id)
+		c.mockProposal(c.log, *id, 1, true, announce)
+
+		// The payload is fetched, and only sent back to the engine if announced
+		cached, ok := engine.backend.recentPayloads.Get(*id)
+		require.True(t, ok)
+		payload := cached.(*types.ExecutionPayloadV1)
+		require.Equal(t, announce, engine.mockChain().chain.GetHeaderByHash(payload.BlockHash) != nil, "announced: %v", announce)
+
+		// It never becomes head on the consensus side
+		require.Nil(t, c.mockChain.chain.GetHeaderByHash(payload.BlockHash))
+		require.Equal(t, parent.Hash(), c.mockChain.CurrentHeader().Hash())
+		require.Equal(t, parent.Hash(), c.beacon.headBlock().BlockHash)
+	}
+
+	// The next slot builds on the old parent
+	block, err := c.buildBlock(2, c.validators.Proposer(2), c.mockChain.CurrentHeader(), true)
+	require.NoError(t, err)
+	require.Equal(t, parent.Hash(), block.ParentHash())
+}
+
+// newTestProposer returns a consensus mock with an embedded engine, and a transaction mix of an account its genesis
+// funds, to give local payloads a value.
+func newTestProposer(t *testing.T) (*ConsensusCmd, *EngineCmd, *BuilderTxsConfig) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	txs := &BuilderTxsConfig{}
+	txs.Default()
+	require.NoError(t, txs.Accounts.Set(common.Bytes2Hex(crypto.FromECDSA(key))))
+	c, engine := newTestConsensusEngine(t, crypto.PubkeyToAddress(key.PublicKey))
+	c.ConsensusBehavior.Default()
+	c.BuilderTimeout = 500 * time.Millisecond
+	return c, engine, txs
+}
+
+// newTestProposalRelay returns a relay on the same genesis as the consensus mock, with all its validators
+// registered, and its address.
+func newTestProposalRelay(t *testing.T, c *ConsensusCmd, txs *BuilderTxsConfig) (*testRelayBackend, string) {
+	relay := newTestRelay(t)
+	relay.engine.GenesisPath = newGenesis(t, common.Address{}, txs.Accounts.accounts[0].addr)
+	relay.engine.Run(context.Background())
+	require.Equal(t, c.mockChain.CurrentHeader().Hash(), prepareParent(t, relay), "relay has another genesis")
+	for _, v := range c.validators.Validators() {
+		relay.registerValidator(t, v.sk)
+	}
+	srv := httptest.NewServer(relay.getRouter())
+	t.Cleanup(srv.Close)
+	return relay, srv.URL
+}
+
+// localPayload has the engine of the consensus mock build the payload of the slot with the transactions,
+// and returns its payload id.
+func localPayload(t *testing.T, c *ConsensusCmd, engine *EngineCmd, slot uint64, txs TransactionsCreator) types.PayloadID {
+	parent := c.mockChain.CurrentHeader()
+	payload, err := engine.backend.buildPayload(parent.Hash(), c.makePayloadAttributes(slot), parent.GasLimit, txs)
+	require.NoError(t, err)
+	id := types.PayloadID{0xff, byte(slot)}
+	engine.backend.recentPayloads.Add(id, payload)
+	return id
+}
+
+func TestGetMockProposal(t *testing.T) {
+	c, engine, txs := newTestProposer(t)
+	relay, addr := newTestProposalRelay(t, c, txs)
+	entry, err := api.ParseRelayEntry(addr)
+	require.NoError(t, err)
+	relay.bids.Strategy = BidStrategyRandom
+	builderFeeRecipient := common.Address{0x42} // of the registrations of the test relay
+
+	const (
+		local   = "local"
+		builder = "builder"
+		failed  = "error"
+	)
+	for i, tc := range []struct {
+		name      string
+		bid       float64 // in ETH
+		minBid    float64
+		localTxs  bool
+		localErr  bool
+		misbehave func(m *MisbehaveConfig)
+		want      string
+	}{
+		{name: "bid beats local", bid: 0.01, want: builder},
+		{name: "bid matches local", bid: 0, want: builder},
+		{name: "local beats bid", bid: 0.0001, localTxs: true, want: local},
+		{name: "bid below min bid", bid: 0.01, minBid: 0.02, want: local},
+		{name: "bid at min bid", bid: 0.02, minBid: 0.02, want: builder},
+		{name: "local error", bid: 0.01, localErr: true, want: builder},
+		{name: "local error and no bid", localErr: true, misbehave: func(m *MisbehaveConfig) { m.NoBid = 1 }, want: failed},
+		{name: "no bid", bid: 0.01, misbehave: func(m *MisbehaveConfig) { m.NoBid = 1 }, want: local},
+		{name: "timeout", bid: 0.01, misbehave: func(m *MisbehaveConfig) { m.Slow = 1 }, want: local},
+		{name: "bad signature", bid: 0.01, misbehave: func(m *MisbehaveConfig) { m.WrongDomain = 1 }, want: local},
+		{name: "bad version", bid: 0.01, misbehave: func(m *MisbehaveConfig) { m.BadVersion = 1 }, want: local},
+		{name: "wrong parent", bid: 0.01, misbehave: func(m *MisbehaveConfig) { m.WrongParent = 1 }, want: local},
+		// Once the blinded block is signed there is no way back to the local payload
+		{name: "withheld payload", bid: 0.01, misbehave: func(m *MisbehaveConfig) { m.WithholdPayload = 1 }, want: failed},
+		{name: "wrong payload", bid: 0.01, misbehave: func(m *MisbehaveConfig) { m.WrongPayload = 1 }, want: failed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// A slot of its own, the relay keeps the bid of a slot
+			slot := uint64(i + 1)
+			relay.bids.RandomMin, relay.bids.RandomMax = tc.bid, tc.bid
+			m := relay.misbehave
+			m.WithholdPayload, m.WrongPayload, m.WrongDomain, m.BadVersion, m.WrongParent, m.Slow, m.NoBid = 0, 0, 0, 0, 0, 0, 0
+			if tc.misbehave != nil {
+				tc.misbehave(m)
+			}
+			c.relays = []*api.RelayEntry{entry}
+			c.BuilderMinBid = tc.minBid
+			localTxs := emptyTxsCreator
+			if tc.localTxs {
+				localTxs = txMixCreator(txs)
+			}
+			id := localPayload(t, c, engine, slot, localTxs)
+			if tc.localErr {
+				id = types.PayloadID{0xee}
+			}
+
+			payload, err := c.getMockProposal(context.Background(), c.log, id, slot)
+			if tc.want == failed {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.want == builder {
+				require.Equal(t, builderFeeRecipient, payload.FeeRecipient, "local payload proposed")
+			} else {
+				require.Equal(t, c.validators.Proposer(slot).FeeRecipient, payload.FeeRecipient, "builder payload proposed")
+				if tc.localTxs {
+					require.NotEmpty(t, payload.Transactions)
+				}
+			}
+		})
+	}
+}
+
+func TestGetBestBid(t *testing.T) {
+	c, engine, txs := newTestProposer(t)
+	var (
+		relays  []*testRelayBackend
+		entries []*api.RelayEntry
+	)
+	for _, bid := range []float64{0.01, 0.02, 0.05, 0.1} {
+		relay, addr := newTestProposalRelay(t, c, txs)
+		relay.bids.Strategy = BidStrategyRandom
+		relay.bids.RandomMin, relay.bids.RandomMax = bid, bid
+		entry, err := api.ParseRelayEntry(addr)
+		require.NoError(t, err)
+		relays, entries = append(relays, relay), append(entries, entry)
+	}
+	// The best bids come too late, or signed with another key than the one pinned for the relay
+	relays[2].misbehave.Slow = 1
+	relays[3].misbehave.WrongKey = 1
+	entries[3].Pubkey = &relays[3].pk
+	c.relays = entries
+
+	slot := uint64(1)
+	proposer := c.validators.Proposer(slot)
+	parentHash := c.mockChain.CurrentHeader().Hash()
+	start := time.Now()
+	relay, bid, err := c.getBestBid(context.Background(), c.log, slot, parentHash, proposer)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 2*c.BuilderTimeout, "slow relay waited for")
+	require.Equal(t, entries[1], relay)
+	require.Equal(t, relays[1].pk, bid.Pubkey())
+	value := bid.Value()
+	require.Equal(t, etherToWei(0.02), new(big.Int).SetBytes(value[:]))
+
+	// Only the relay of the winning bid gets the signed blinded block
+	payload, err := c.getMockProposal(context.Background(), c.log, localPayload(t, c, engine, slot, emptyTxsCreator), slot)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash(bid.BlockHash()), payload.BlockHash)
+	for i, relay := range relays {
+		delivered := relay.data.Delivered(&TraceFilter{})
+		if i == 1 {
+			require.Len(t, delivered, 1)
+		} else {
+			require.Empty(t, delivered, "relay %d unblinded a block", i)
+		}
+	}
+
+	// Without any valid bid
+	c.relays = entries[2:]
+	_, _, err = c.getBestBid(context.Background(), c.log, slot, parentHash, proposer)
+	require.Error(t, err)
+}
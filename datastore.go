@@ -0,0 +1,98 @@
+package main
+
+import (
+	"mergemock/types"
+	"sync"
+)
+
+// Number of bid traces the data store keeps of each kind, older traces are dropped.
+const maxDataStoreTraces = 10_000
+
+// DataStore records what the relay did, for the data API.
+type DataStore struct {
+	mu        sync.RWMutex
+	delivered []types.BidTraceV2
+	received  []types.BidTraceV2WithTimestamp
+
+	// totals, including the traces that were dropped
+	deliveredCount int
+	receivedCount  int
+}
+
+// TraceFilter selects bid traces, unset fields match everything.
+type TraceFilter struct {
+	Slot           *uint64
+	BlockHash      *types.Hash
+	ProposerPubkey *types.PublicKey
+	Limit          int
+}
+
+func (f *TraceFilter) matches(trace *types.BidTrace) bool {
+	if f.Slot != nil && trace.Slot != *f.Slot {
+		return false
+	}
+	if f.BlockHash != nil && trace.BlockHash != *f.BlockHash {
+		return false
+	}
+	if f.ProposerPubkey != nil && trace.ProposerPubkey != *f.ProposerPubkey {
+		return false
+	}
+	return true
+}
+
+func NewDataStore() *DataStore {
+	return &DataStore{}
+}
+
+func (d *DataStore) AddDelivered(trace types.BidTraceV2) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.delivered = append(d.delivered, trace)
+	d.deliveredCount++
+	if len(d.delivered) > maxDataStoreTraces {
+		d.delivered = d.delivered[len(d.delivered)-maxDataStoreTraces:]
+	}
+}
+
+func (d *DataStore) AddReceived(trace types.BidTraceV2WithTimestamp) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.received = append(d.received, trace)
+	d.receivedCount++
+	if len(d.received) > maxDataStoreTraces {
+		d.received = d.received[len(d.received)-maxDataStoreTraces:]
+	}
+}
+
+// Delivered returns the payloads delivered to proposers that match the filter, latest first.
+func (d *DataStore) Delivered(filter *TraceFilter) []types.BidTraceV2 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]types.BidTraceV2, 0)
+	for i := len(d.delivered) - 1; i >= 0 && (filter.Limit == 0 || len(out) < filter.Limit); i-- {
+		if filter.matches(&d.delivered[i].BidTrace) {
+			out = append(out, d.delivered[i])
+		}
+	}
+	return out
+}
+
+// Received returns the blocks received from builders that match the filter, latest first.
+func (d *DataStore) Received(filter *TraceFilter) []types.BidTraceV2WithTimestamp {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]types.BidTraceV2WithTimestamp, 0)
+	for i := len(d.received) - 1; i >= 0 && (filter.Limit == 0 || len(out) < filter.Limit); i-- {
+		if filter.matches(&d.received[i].BidTrace) {
+			out = append(out, d.received[i])
+		}
+	}
+	return out
+}
+
+// Counts returns how many payloads were delivered to proposers and how many blocks were received in total.
+func (d *DataStore) Counts() (delivered int, received int) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.deliveredCount, d.receivedCount
+}
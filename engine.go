@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"mergemock/api"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
@@ -24,6 +26,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+var errRecordWebsocket = errors.New("websocket traffic cannot be recorded, disable the websocket server with --ws-addr= to record")
+
 type EngineCmd struct {
 	// chain options
 	SlotsPerEpoch uint64 `ask:"--slots-per-epoch" help:"Slots per epoch"`
@@ -33,21 +37,23 @@ type EngineCmd struct {
 
 	// connectivity options
 	ListenAddr    string      `ask:"--listen-addr" help:"Address to bind RPC HTTP server to"`
-	WebsocketAddr string      `ask:"--ws-addr" help:"Address to serve /ws endpoint on for websocket JSON-RPC"`
+	WebsocketAddr string      `ask:"--ws-addr" help:"Address to serve /ws endpoint on for websocket JSON-RPC (disabled if empty)"`
 	Cors          []string    `ask:"--cors" help:"List of allowable origins (CORS http header)"`
 	Timeout       rpc.Timeout `ask:".timeout" help:"Configure timeouts of the HTTP servers"`
+	RecordPath    string      `ask:"--record" help:"File to append the JSON-RPC requests and responses of the HTTP server to, as JSON lines with timestamps, for the replay command. Needs the websocket server to be disabled (disabled if empty)"`
 
 	// embed logger options
 	LogCmd         `ask:".log" help:"Change logger configuration"`
 	TraceLogConfig `ask:".trace" help:"Tracing options"`
 
-	close   chan struct{}
-	log     logrus.Ext1FieldLogger
-	ctx     context.Context
-	backend *EngineBackend
-	rpcSrv  *gethRpc.Server
-	srv     *http.Server
-	wsSrv   *http.Server // upgrades to websocket rpc
+	close    chan struct{}
+	log      logrus.Ext1FieldLogger
+	ctx      context.Context
+	backend  *EngineBackend
+	rpcSrv   *gethRpc.Server
+	srv      *http.Server
+	wsSrv    *http.Server // upgrades to websocket rpc
+	recorder *sessionRecorder
 
 	jwtSecret []byte
 }
@@ -71,6 +77,9 @@ func (c *EngineCmd) Help() string {
 }
 
 func (c *EngineCmd) Run(ctx context.Context, args ...string) error {
+	if c.RecordPath != "" && c.WebsocketAddr != "" {
+		return errRecordWebsocket
+	}
 	if err := c.initLogger(ctx); err != nil {
 		// Logger wasn't initialized so we can't log. Error out instead.
 		return err
@@ -99,12 +108,19 @@ func (c *EngineCmd) RunNode() {
 	c.log.WithField("listenAddr", c.ListenAddr).Info("Engine started")
 
 	go c.srv.ListenAndServe()
-	go c.wsSrv.ListenAndServe()
+	if c.wsSrv != nil {
+		go c.wsSrv.ListenAndServe()
+	}
 
 	for range c.close {
 		c.rpcSrv.Stop()
 		c.srv.Close()
-		c.wsSrv.Close()
+		if c.wsSrv != nil {
+			c.wsSrv.Close()
+		}
+		if c.recorder != nil {
+			c.recorder.Close()
+		}
 		return
 		// TODO: any other tasks to run in this loop? mock sync changes?
 	}
@@ -167,7 +183,18 @@ func (c *EngineCmd) startRPC(ctx context.Context) {
 
 	c.rpcSrv = rpcSrv
 	c.srv = rpc.NewHTTPServer(ctx, c.log, c.rpcSrv, c.ListenAddr, c.Timeout, c.Cors)
-	c.wsSrv = rpc.NewWSServer(ctx, c.log, c.rpcSrv, c.WebsocketAddr, c.jwtSecret, c.Timeout, c.Cors)
+	if c.RecordPath != "" {
+		recorder, err := newSessionRecorder(c.log, c.RecordPath)
+		if err != nil {
+			c.log.WithField("err", err).Fatal("Unable to open session file")
+		}
+		c.recorder = recorder
+		c.srv.Handler = recorder.middleware(c.srv.Handler)
+		c.log.WithField("path", c.RecordPath).Info("Recording requests")
+	}
+	if c.WebsocketAddr != "" {
+		c.wsSrv = rpc.NewWSServer(ctx, c.log, c.rpcSrv, c.WebsocketAddr, c.jwtSecret, c.Timeout, c.Cors)
+	}
 }
 
 type EngineBackend struct {
@@ -198,6 +225,20 @@ func (e *EngineBackend) GetPayloadV1(ctx context.Context, id types.PayloadID) (*
 	return payload.(*types.ExecutionPayloadV1), nil
 }
 
+// GetPayloadV2 returns the payload with the value of its block to the fee recipient. The embedded engine builds
+// no withdrawals, the payload is the same as with GetPayloadV1.
+func (e *EngineBackend) GetPayloadV2(ctx context.Context, id types.PayloadID) (*types.GetPayloadV2Response, error) {
+	payload, err := e.GetPayloadV1(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	value, err := e.mockChain.PayloadValue(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &types.GetPayloadV2Response{ExecutionPayload: payload, BlockValue: (*hexutil.Big)(value)}, nil
+}
+
 func (e *EngineBackend) NewPayloadV1(ctx context.Context, payload *types.ExecutionPayloadV1) (*types.PayloadStatusV1, error) {
 	log := e.log.WithField("block_hash", payload.BlockHash)
 	if !payload.ValidateHash() {
@@ -240,27 +281,9 @@ func (e *EngineBackend) ForkchoiceUpdatedV1(ctx context.Context, heads *types.Fo
 	plog := e.log.WithField("payload_id", id)
 	plog.WithField("attributes", attributes).Info("Preparing new payload")
 
-	gasLimit := e.mockChain.gspec.GasLimit
-	txsCreator := TransactionsCreator{nil, func(config *params.ChainConfig, bc core.ChainContext,
-		statedb *state.StateDB, header *ethTypes.Header, cfg vm.Config, accounts []TestAccount) []*ethTypes.Transaction {
-		// empty payload
-		// TODO: maybe vary these a little?
-		return nil
-	}}
-	extraData := []byte{}
-
-	bl, err := e.mockChain.AddNewBlock(common.BytesToHash(heads.HeadBlockHash[:]), attributes.SuggestedFeeRecipient, uint64(attributes.Timestamp),
-		gasLimit, txsCreator, attributes.PrevRandao, extraData, nil, false)
-
+	payload, err := e.buildPayload(heads.HeadBlockHash, attributes, e.mockChain.gspec.GasLimit, emptyTxsCreator)
 	if err != nil {
-		// TODO: proper error codes
-		plog.WithError(err).Error("Failed to create block, cannot build new payload")
-		return nil, err
-	}
-
-	payload, err := api.BlockToPayload(bl)
-	if err != nil {
-		plog.WithError(err).Error("Failed to convert block to payload")
+		plog.WithError(err).Error("Failed to build new payload")
 		// TODO: proper error codes
 		return nil, err
 	}
@@ -271,3 +294,27 @@ func (e *EngineBackend) ForkchoiceUpdatedV1(ctx context.Context, heads *types.Fo
 
 	return &types.ForkchoiceUpdatedResult{PayloadStatus: types.PayloadStatusV1{Status: types.ExecutionValid, LatestValidHash: &heads.HeadBlockHash}, PayloadID: &id}, nil
 }
+
+var emptyTxsCreator = TransactionsCreator{nil, func(config *params.ChainConfig, bc core.ChainContext,
+	statedb *state.StateDB, header *ethTypes.Header, cfg vm.Config, accounts []TestAccount) ([]*ethTypes.Transaction, error) {
+	// empty payload
+	// TODO: maybe vary these a little?
+	return nil, nil
+}}
+
+// buildPayload builds a payload on top of the given parent, without adding it to the chain.
+func (e *EngineBackend) buildPayload(parentHash common.Hash, attributes *types.PayloadAttributesV1, gasLimit uint64, txsCreator TransactionsCreator) (*types.ExecutionPayloadV1, error) {
+	extraData := []byte{}
+
+	bl, err := e.mockChain.AddNewBlock(parentHash, attributes.SuggestedFeeRecipient, attributes.Timestamp,
+		gasLimit, txsCreator, attributes.PrevRandao, extraData, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create block: %v", err)
+	}
+
+	payload, err := api.BlockToPayload(bl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert block to payload: %v", err)
+	}
+	return payload, nil
+}
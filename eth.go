@@ -74,3 +74,8 @@ func (b *EthBackend) GetBlockByNumber(ctx context.Context, number gethRpc.BlockN
 		return b.rpcMarshalBlock(ctx, block, true, fullTx)
 	}
 }
+
+// Syncing reports the mock chain as synced, it only has the blocks it was given.
+func (b *EthBackend) Syncing(ctx context.Context) (interface{}, error) {
+	return false, nil
+}
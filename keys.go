@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+)
+
+// loadSecretKey reads a hex encoded BLS secret key, given directly or in a file. Without either, a random key is made.
+func loadSecretKey(hexKey string, path string) (bls.SecretKey, error) {
+	if hexKey != "" && path != "" {
+		return nil, errors.New("secret key and secret key file are mutually exclusive")
+	}
+	if path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		hexKey = string(raw)
+	}
+	if hexKey == "" {
+		return bls.RandKey()
+	}
+	hexKey = strings.TrimSpace(hexKey)
+	if !strings.HasPrefix(hexKey, "0x") {
+		hexKey = "0x" + hexKey
+	}
+	b, err := hexutil.Decode(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %v", err)
+	}
+	return bls.SecretKeyFromBytes(b)
+}
+
+type KeygenCmd struct {
+	Out string `ask:"--out" help:"File to write the hex encoded secret key to, for --secret-key-file. Printed if empty"`
+}
+
+func (c *KeygenCmd) Help() string {
+	return "Generate a BLS key for the relay, and print its pubkey."
+}
+
+func (c *KeygenCmd) Run(ctx context.Context, args ...string) error {
+	sk, err := bls.RandKey()
+	if err != nil {
+		return err
+	}
+	secret := hexutil.Encode(sk.Marshal())
+	if c.Out == "" {
+		fmt.Printf("secret key: %s\n", secret)
+	} else if err := ioutil.WriteFile(c.Out, []byte(secret), 0600); err != nil {
+		return err
+	}
+	fmt.Printf("pubkey: %s\n", hexutil.Encode(sk.PublicKey().Marshal()))
+	return nil
+}
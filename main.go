@@ -26,6 +26,16 @@ func (c *MergeMockCmd) Cmd(route string) (cmd interface{}, err error) {
 		cmd = &EngineCmd{}
 	case "relay":
 		cmd = &RelayCmd{}
+	case "keygen":
+		cmd = &KeygenCmd{}
+	case "boost":
+		cmd = &BoostCmd{}
+	case "builder":
+		cmd = &BuilderCmd{}
+	case "proxy":
+		cmd = &ProxyCmd{}
+	case "replay":
+		cmd = &ReplayCmd{}
 	default:
 		return nil, ask.UnrecognizedErr
 	}
@@ -33,7 +43,7 @@ func (c *MergeMockCmd) Cmd(route string) (cmd interface{}, err error) {
 }
 
 func (c *MergeMockCmd) Routes() []string {
-	return []string{"consensus", "engine", "relay"}
+	return []string{"consensus", "engine", "relay", "keygen", "boost", "builder", "proxy", "replay"}
 }
 
 type start struct {
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"mergemock/types"
+	"sync"
+	"time"
+
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+)
+
+// MisbehaveConfig makes the relay dishonest at random, to test how proposers and mev-boost deal with bad relays.
+// All frequencies are zero by default, for an honest relay.
+type MisbehaveConfig struct {
+	RNG RNG `ask:"--rng" help:"seed the RNG with an integer number"`
+
+	WithholdPayload float64       `ask:"--withhold-payload" help:"How often the payload is withheld after the proposer signed the blinded block"`
+	WrongPayload    float64       `ask:"--wrong-payload" help:"How often the payload returned does not match the bid"`
+	WrongKey        float64       `ask:"--wrong-key" help:"How often bids are signed with another key than the relay pubkey"`
+	WrongDomain     float64       `ask:"--wrong-domain" help:"How often bids are signed for the beacon proposer domain instead of the builder domain"`
+	BadVersion      float64       `ask:"--bad-version" help:"How often responses have a malformed version"`
+	WrongParent     float64       `ask:"--wrong-parent" help:"How often bids are for another parent than requested"`
+	Slow            float64       `ask:"--slow" help:"How often responses are delayed"`
+	SlowDelay       time.Duration `ask:"--slow-delay" help:"Delay of slow responses, past the proposer deadline"`
+	NoBid           float64       `ask:"--no-bid" help:"How often getHeader returns 204 without a bid"`
+
+	mu sync.Mutex
+}
+
+func (m *MisbehaveConfig) Default() {
+	m.RNG = RNG{rand.New(rand.NewSource(DefaultRNGSeed))}
+	m.SlowDelay = 2 * time.Second
+}
+
+func (m *MisbehaveConfig) Validate() error {
+	for name, freq := range map[string]float64{
+		"withhold-payload": m.WithholdPayload,
+		"wrong-payload":    m.WrongPayload,
+		"wrong-key":        m.WrongKey,
+		"wrong-domain":     m.WrongDomain,
+		"bad-version":      m.BadVersion,
+		"wrong-parent":     m.WrongParent,
+		"slow":             m.Slow,
+		"no-bid":           m.NoBid,
+	} {
+		if freq < 0 || freq > 1 {
+			return fmt.Errorf("misbehave frequency %s must be between 0 and 1, got %v", name, freq)
+		}
+	}
+	return nil
+}
+
+// roll tells if the relay misbehaves this time, with the given frequency.
+func (m *MisbehaveConfig) roll(freq float64) bool {
+	if freq <= 0 {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.RNG.Float64() < freq
+}
+
+// malformedVersion replaces the fork name in responses of a misbehaving relay.
+const malformedVersion = "bellatrix\x00"
+
+// misbehaveBid returns the bid to respond with, possibly tampered with.
+// The honest bid stays cached, so a bid can be served honestly once and dishonestly the next time.
+func (r *RelayBackend) misbehaveBid(bid *relayBid) (*types.VersionedSignedBuilderBid, error) {
+	m := r.misbehave
+	payload, sk, domain := bid.payload, r.sk, r.builderDomain
+	tampered := false
+	if m.roll(m.WrongParent) {
+		r.log.Warn("Misbehaving: bid for another parent")
+		wrongParent := *payload
+		m.mu.Lock()
+		m.RNG.Read(wrongParent.ParentHash[:])
+		m.mu.Unlock()
+		payload, tampered = &wrongParent, true
+	}
+	if m.roll(m.WrongKey) {
+		r.log.Warn("Misbehaving: bid signed with another key")
+		var err error
+		if sk, err = bls.RandKey(); err != nil {
+			return nil, err
+		}
+		tampered = true
+	}
+	if m.roll(m.WrongDomain) {
+		r.log.Warn("Misbehaving: bid signed for the wrong domain")
+		domain, tampered = types.ComputeDomain(types.DomainTypeBeaconProposer, types.ForkVersion{}, nil), true
+	}
+	signed := bid.signed
+	if tampered {
+		var err error
+		if signed, _, err = signBuilderBid(sk, r.pk, domain, signed.Version, payload, bid.fork, signed.Value()); err != nil {
+			return nil, err
+		}
+	}
+	if m.roll(m.BadVersion) {
+		r.log.Warn("Misbehaving: malformed bid version")
+		malformed := *signed
+		malformed.Version = malformedVersion
+		signed = &malformed
+	}
+	return signed, nil
+}
+
+// misbehavePayload returns the payload to respond with, possibly one that does not match the bid.
+func (r *RelayBackend) misbehavePayload(payload *types.ExecutionPayloadV1) *types.ExecutionPayloadV1 {
+	m := r.misbehave
+	if !m.roll(m.WrongPayload) {
+		return payload
+	}
+	r.log.Warn("Misbehaving: payload does not match the bid")
+	tampered := *payload
+	m.mu.Lock()
+	m.RNG.Read(tampered.BlockHash[:])
+	m.mu.Unlock()
+	return &tampered
+}
+
+// misbehaveDelay delays slow responses, unless the request is canceled first.
+func (r *RelayBackend) misbehaveDelay(done <-chan struct{}) {
+	m := r.misbehave
+	if !m.roll(m.Slow) {
+		return
+	}
+	r.log.WithField("delay", m.SlowDelay).Warn("Misbehaving: slow response")
+	select {
+	case <-time.After(m.SlowDelay):
+	case <-done:
+	}
+}
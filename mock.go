@@ -170,10 +170,10 @@ type TraceLogConfig struct {
 
 type TransactionsCreator struct {
 	accounts []TestAccount
-	fn       func(*params.ChainConfig, core.ChainContext, *state.StateDB, *types.Header, vm.Config, []TestAccount) []*types.Transaction
+	fn       func(*params.ChainConfig, core.ChainContext, *state.StateDB, *types.Header, vm.Config, []TestAccount) ([]*types.Transaction, error)
 }
 
-func (t *TransactionsCreator) Create(config *params.ChainConfig, bc core.ChainContext, statedb *state.StateDB, header *types.Header, cfg vm.Config) []*types.Transaction {
+func (t *TransactionsCreator) Create(config *params.ChainConfig, bc core.ChainContext, statedb *state.StateDB, header *types.Header, cfg vm.Config) ([]*types.Transaction, error) {
 	return t.fn(config, bc, statedb, header, cfg, t.accounts)
 }
 
@@ -284,7 +284,10 @@ func (c *MockChain) AddNewBlock(parentHash common.Hash, coinbase common.Address,
 		vmconf.Tracer = stl
 	}
 
-	txs := txsCreator.Create(config, c.chain, statedb, header, vmconf)
+	txs, err := txsCreator.Create(config, c.chain, statedb, header, vmconf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transactions: %v", err)
+	}
 	for i, tx := range txs {
 		receipt, err := core.ApplyTransaction(config, c.chain, &header.Coinbase, gasPool, statedb, header, tx, &header.GasUsed, vmconf)
 		if err != nil {
@@ -387,9 +390,78 @@ func (c *MockChain) MineBlock(parent *types.Header) (*types.Block, error) {
 }
 
 func (c *MockChain) ProcessPayload(payload *mmTypes.ExecutionPayloadV1) (*types.Block, error) {
+	block, _, statedb, err := c.executePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	config := c.gspec.Config
+	// Write state changes to db
+	root, err := statedb.Commit(config.IsEIP158(block.Number()))
+	if err != nil {
+		return nil, fmt.Errorf("state write error: %v", err)
+	}
+	if err := statedb.Database().TrieDB().Commit(root, false, nil); err != nil {
+		return nil, fmt.Errorf("trie write error: %v", err)
+	}
+	_, err = c.chain.InsertChain(types.Blocks{block})
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert block into chain")
+	}
+	return block, nil
+}
+
+// PayloadValue returns what the fee recipient earns with the payload:
+// the priority fees of its transactions plus the value of those sent to it by others.
+// Unlike its balance change, this holds when the fee recipient sends transactions itself.
+// Value sent to it from within contract calls is not counted.
+func (c *MockChain) PayloadValue(payload *mmTypes.ExecutionPayloadV1) (*big.Int, error) {
+	block, receipts, _, err := c.executePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.MakeSigner(c.gspec.Config, block.Number())
+	value := new(big.Int)
+	for i, tx := range block.Transactions() {
+		tip, err := tx.EffectiveGasTip(block.BaseFee())
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		value.Add(value, tip.Mul(tip, new(big.Int).SetUint64(receipts[i].GasUsed)))
+		if to := tx.To(); to == nil || *to != payload.FeeRecipient || receipts[i].Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		if from != payload.FeeRecipient {
+			value.Add(value, tx.Value())
+		}
+	}
+	return value, nil
+}
+
+// PaymentValue is the balance change of the recipient in the payload, e.g. a builder payment to the proposer.
+func (c *MockChain) PaymentValue(payload *mmTypes.ExecutionPayloadV1, recipient common.Address) (*big.Int, error) {
+	block, _, statedb, err := c.executePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	parent := c.chain.GetHeaderByHash(block.ParentHash())
+	parentState, err := c.chain.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	before := parentState.GetBalance(recipient)
+	return new(big.Int).Sub(statedb.GetBalance(recipient), before), nil
+}
+
+// executePayload applies the payload on top of its parent and verifies the result against it,
+// without writing the state changes or the block to the chain.
+func (c *MockChain) executePayload(payload *mmTypes.ExecutionPayloadV1) (*types.Block, []*types.Receipt, *state.StateDB, error) {
 	parent := c.chain.GetHeaderByHash(payload.ParentHash)
 	if parent == nil {
-		return nil, fmt.Errorf("unknown parent %s", payload.ParentHash)
+		return nil, nil, nil, fmt.Errorf("unknown parent %s", payload.ParentHash)
 	}
 	config := c.gspec.Config
 	statedb, err := state.New(parent.Root, state.NewDatabase(c.database), nil)
@@ -440,12 +512,12 @@ func (c *MockChain) ProcessPayload(payload *mmTypes.ExecutionPayloadV1) (*types.
 	for i, otx := range payload.Transactions {
 		var tx types.Transaction
 		if err := tx.UnmarshalBinary(otx); err != nil {
-			return nil, fmt.Errorf("failed to decode tx %d: %v", i, err)
+			return nil, nil, nil, fmt.Errorf("failed to decode tx %d: %v", i, err)
 		}
 		txs = append(txs, &tx)
 		receipt, err := core.ApplyTransaction(config, c.chain, &header.Coinbase, gasPool, statedb, header, &tx, &header.GasUsed, vmconf)
 		if err != nil {
-			return nil, fmt.Errorf("failed to apply transaction %d: %v", i, err)
+			return nil, nil, nil, fmt.Errorf("failed to apply transaction %d: %v", i, err)
 		}
 		rec, _ := json.MarshalIndent(receipt, "  ", "  ")
 		c.log.WithField("receipt_index", i).Debug("receipt:\n" + string(rec))
@@ -482,33 +554,21 @@ func (c *MockChain) ProcessPayload(payload *mmTypes.ExecutionPayloadV1) (*types.
 	}).Info("computed block from payload")
 
 	if used := block.GasUsed(); used != uint64(payload.GasUsed) {
-		return nil, fmt.Errorf("gas usage difference: %d <> %d", payload.GasUsed, header.GasUsed)
+		return nil, nil, nil, fmt.Errorf("gas usage difference: %d <> %d", payload.GasUsed, header.GasUsed)
 	}
 	if receiptHash := block.ReceiptHash(); receiptHash != common.Hash(payload.ReceiptsRoot) {
-		return nil, fmt.Errorf("receipt root difference: %s <> %s", receiptHash, payload.ReceiptsRoot)
+		return nil, nil, nil, fmt.Errorf("receipt root difference: %s <> %s", receiptHash, payload.ReceiptsRoot)
 	}
 	if bloom := block.Bloom(); bloom != payload.LogsBloom {
-		return nil, fmt.Errorf("logs bloom difference: %s <> %s", bloom, payload.LogsBloom)
+		return nil, nil, nil, fmt.Errorf("logs bloom difference: %s <> %s", bloom, payload.LogsBloom)
 	}
 	if block.Root() != common.Hash(payload.StateRoot) {
-		return nil, fmt.Errorf("state root difference: %s <> %s", stateRoot, payload.StateRoot)
+		return nil, nil, nil, fmt.Errorf("state root difference: %s <> %s", stateRoot, payload.StateRoot)
 	}
 	if hash := block.Hash(); hash != payload.BlockHash {
-		return nil, fmt.Errorf("block hash difference: %s <> %s", hash, payload.BlockHash)
+		return nil, nil, nil, fmt.Errorf("block hash difference: %s <> %s", hash, payload.BlockHash)
 	}
-	// Write state changes to db
-	root, err := statedb.Commit(config.IsEIP158(header.Number))
-	if err != nil {
-		return nil, fmt.Errorf("state write error: %v", err)
-	}
-	if err := statedb.Database().TrieDB().Commit(root, false, nil); err != nil {
-		return nil, fmt.Errorf("trie write error: %v", err)
-	}
-	_, err = c.chain.InsertChain(types.Blocks{block})
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert block into chain")
-	}
-	return block, nil
+	return block, receipts, statedb, nil
 }
 
 func (c *MockChain) Close() error {
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mergemock/types"
+
+	"gopkg.in/yaml.v2"
+)
+
+// loadNetwork returns the named network, or reads the fork versions of a custom network from a consensus spec
+// config YAML file.
+func loadNetwork(name string) (*types.Network, error) {
+	if network, ok := types.Networks[name]; ok {
+		return network, nil
+	}
+	raw, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown network %q: %v", name, err)
+	}
+	network := &types.Network{Name: name}
+	if err := yaml.Unmarshal(raw, network); err != nil {
+		return nil, fmt.Errorf("invalid network config %s: %v", name, err)
+	}
+	return network, nil
+}
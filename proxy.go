@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"mergemock/rpc"
+	"mergemock/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ProxyActionDelay     = "delay"
+	ProxyActionDrop      = "drop"
+	ProxyActionStatus    = "status"
+	ProxyActionDuplicate = "duplicate"
+)
+
+var errNoStatus = errors.New("response has no payload status")
+
+type ProxyCmd struct {
+	ListenAddr            string   `ask:"--listen-addr" help:"Address to bind the engine API proxy to, for the consensus client"`
+	UpstreamAddr          string   `ask:"--upstream" help:"Address of the engine JSON-RPC endpoint of the execution client to forward to"`
+	JwtSecretPath         string   `ask:"--jwt-secret" help:"JWT secret key the consensus client authenticates with"`
+	UpstreamJwtSecretPath string   `ask:"--upstream-jwt-secret" help:"JWT secret key to authenticate with the execution client (same as --jwt-secret if empty)"`
+	Rules                 []string `ask:"--rule" help:"Rules for the requests of a method, as method:action[:arg][@frequency], e.g. engine_newPayloadV1:delay:2s, engine_forkchoiceUpdated*:status:SYNCING@0.5, or with the drop and duplicate actions"`
+	RNG                   RNG      `ask:"--rng" help:"seed the RNG with an integer number"`
+
+	// embed timeout and logger options
+	Timeout rpc.Timeout `ask:".timeout" help:"Configure timeouts of the HTTP server"`
+	LogCmd  `ask:".log" help:"Change logger configuration"`
+
+	close chan struct{}
+	log   *logrus.Logger
+	srv   *http.Server
+}
+
+func (p *ProxyCmd) Default() {
+	p.ListenAddr = "127.0.0.1:18551"
+	p.UpstreamAddr = "http://127.0.0.1:8551"
+	p.JwtSecretPath = "jwt.hex"
+	p.RNG = RNG{rand.New(rand.NewSource(DefaultRNGSeed))}
+
+	p.Timeout.Read = 30 * time.Second
+	p.Timeout.ReadHeader = 10 * time.Second
+	p.Timeout.Write = 30 * time.Second
+	p.Timeout.Idle = 5 * time.Minute
+}
+
+func (p *ProxyCmd) Help() string {
+	return "Run an engine API proxy between a consensus client and an execution client, logging and tampering with the traffic."
+}
+
+func (p *ProxyCmd) Run(ctx context.Context, args ...string) error {
+	logr, err := p.LogCmd.Create()
+	if err != nil {
+		return err
+	}
+	p.log = logr
+	backend, err := NewProxyBackend(p.log, p)
+	if err != nil {
+		return err
+	}
+	p.close = make(chan struct{})
+	go p.startProxy(backend)
+	return nil
+}
+
+func (p *ProxyCmd) Close() error {
+	if p.close != nil {
+		p.close <- struct{}{}
+	}
+	return nil
+}
+
+func (p *ProxyCmd) startProxy(backend *ProxyBackend) {
+	p.srv = &http.Server{
+		Addr:    p.ListenAddr,
+		Handler: backend,
+
+		ReadTimeout:       p.Timeout.Read,
+		ReadHeaderTimeout: p.Timeout.ReadHeader,
+		WriteTimeout:      p.Timeout.Write,
+		IdleTimeout:       p.Timeout.Idle,
+	}
+
+	p.log.WithFields(logrus.Fields{
+		"listenAddr": p.ListenAddr,
+		"upstream":   p.UpstreamAddr,
+		"rules":      len(backend.rules),
+	}).Info("Proxy started")
+	go p.srv.ListenAndServe()
+	for range p.close {
+		p.srv.Close()
+		return
+	}
+}
+
+// proxyRule tampers with the requests of the methods it matches, as often as its frequency.
+type proxyRule struct {
+	method string // exact method name, or a prefix ending with *
+	action string
+	delay  time.Duration
+	status types.ExecutePayloadStatus
+	freq   float64
+}
+
+// parseProxyRule parses a rule of the form method:action[:arg][@frequency].
+func parseProxyRule(s string) (*proxyRule, error) {
+	rule := &proxyRule{freq: 1}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		freq, err := strconv.ParseFloat(s[i+1:], 64)
+		if err != nil || freq < 0 || freq > 1 {
+			return nil, fmt.Errorf("rule %q: frequency must be between 0 and 1", s)
+		}
+		rule.freq, s = freq, s[:i]
+	}
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, fmt.Errorf("rule %q is not method:action[:arg]", s)
+	}
+	rule.method, rule.action = parts[0], parts[1]
+	arg := ""
+	if len(parts) == 3 {
+		arg = parts[2]
+	}
+	switch rule.action {
+	case ProxyActionDelay:
+		delay, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid delay: %v", s, err)
+		}
+		rule.delay = delay
+	case ProxyActionStatus:
+		switch status := types.ExecutePayloadStatus(arg); status {
+		case types.ExecutionValid, types.ExecutionInvalid, types.ExecutionSyncing, types.ExecutionAccepted,
+			types.ExecutionInvalidBlockHash, types.ExecutionInvalidTerminalBlock:
+			rule.status = status
+		default:
+			return nil, fmt.Errorf("rule %q: unknown payload status %q", s, arg)
+		}
+	case ProxyActionDrop, ProxyActionDuplicate:
+		if arg != "" {
+			return nil, fmt.Errorf("rule %q: %s takes no argument", s, rule.action)
+		}
+	default:
+		return nil, fmt.Errorf("rule %q: unknown action %q", s, rule.action)
+	}
+	return rule, nil
+}
+
+func (r *proxyRule) matches(method string) bool {
+	if prefix := strings.TrimSuffix(r.method, "*"); prefix != r.method {
+		return strings.HasPrefix(method, prefix)
+	}
+	return r.method == method
+}
+
+func (r *proxyRule) String() string {
+	switch r.action {
+	case ProxyActionDelay:
+		return fmt.Sprintf("%s:%s", r.action, r.delay)
+	case ProxyActionStatus:
+		return fmt.Sprintf("%s:%s", r.action, r.status)
+	default:
+		return r.action
+	}
+}
+
+// ProxyBackend forwards authenticated engine API requests to an upstream execution client, under its own JWT secret.
+type ProxyBackend struct {
+	log            *logrus.Logger
+	client         *http.Client
+	upstream       string
+	jwtSecret      []byte
+	upstreamSecret []byte
+	rules          []*proxyRule
+
+	mu  sync.Mutex
+	rng RNG
+}
+
+func NewProxyBackend(log *logrus.Logger, cfg *ProxyCmd) (*ProxyBackend, error) {
+	jwt, err := loadJwtSecret(cfg.JwtSecretPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read JWT secret: %v", err)
+	}
+	upstreamJwt := jwt
+	if cfg.UpstreamJwtSecretPath != "" {
+		if upstreamJwt, err = loadJwtSecret(cfg.UpstreamJwtSecretPath); err != nil {
+			return nil, fmt.Errorf("unable to read upstream JWT secret: %v", err)
+		}
+	}
+	var rules []*proxyRule
+	for _, s := range cfg.Rules {
+		rule, err := parseProxyRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return &ProxyBackend{
+		log:            log,
+		client:         &http.Client{},
+		upstream:       cfg.UpstreamAddr,
+		jwtSecret:      jwt,
+		upstreamSecret: upstreamJwt,
+		rules:          rules,
+		rng:            cfg.RNG,
+	}, nil
+}
+
+// matchingRules returns the rules that apply to this request of the method.
+func (p *ProxyBackend) matchingRules(method string) []*proxyRule {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var rules []*proxyRule
+	for _, rule := range p.rules {
+		if rule.matches(method) && (rule.freq >= 1 || p.rng.Float64() < rule.freq) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// ServeHTTP forwards a JSON-RPC request of the consensus client, after the matching rules. Batch requests are
+// forwarded without rules.
+func (p *ProxyBackend) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := rpc.VerifyJwtAuthorization(req.Header.Get("Authorization"), p.jwtSecret); err != nil {
+		p.log.WithError(err).Warn("Rejected unauthenticated request")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var call struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	var rules []*proxyRule
+	if err := json.Unmarshal(body, &call); err == nil {
+		rules = p.matchingRules(call.Method)
+	}
+	plog := p.log.WithFields(logrus.Fields{
+		"method":  call.Method,
+		"id":      string(call.ID),
+		"rules":   rules,
+		"request": string(body),
+	})
+
+	start := time.Now()
+	for _, rule := range rules {
+		if rule.action != ProxyActionDelay {
+			continue
+		}
+		select {
+		case <-time.After(rule.delay):
+		case <-req.Context().Done():
+			plog.Warn("Consensus client gave up on delayed request")
+			return
+		}
+	}
+	for _, rule := range rules {
+		if rule.action == ProxyActionDrop {
+			plog.Warn("Dropped request")
+			// close the connection without a response, as if the execution client never answered
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	code, resp, err := p.forward(req.Context(), body)
+	if err != nil {
+		plog.WithError(err).Warn("Execution client unreachable")
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	for _, rule := range rules {
+		switch rule.action {
+		case ProxyActionDuplicate:
+			dupCode, dupResp, err := p.forward(req.Context(), body)
+			if err != nil {
+				plog.WithError(err).Warn("Duplicate request failed")
+				continue
+			}
+			plog.WithField("code", dupCode).WithField("response", string(dupResp)).Info("Duplicated request")
+		case ProxyActionStatus:
+			rewritten, err := rewritePayloadStatus(resp, rule.status)
+			if err != nil {
+				plog.WithError(err).Debug("Cannot rewrite payload status")
+				continue
+			}
+			resp = rewritten
+		}
+	}
+	plog.WithFields(logrus.Fields{
+		"code":       code,
+		"response":   string(resp),
+		"durationMs": time.Since(start).Milliseconds(),
+	}).Info("Proxied request")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(resp)
+}
+
+// forward sends the request body to the execution client, with a token of the upstream secret.
+func (p *ProxyBackend) forward(ctx context.Context, body []byte) (int, []byte, error) {
+	return rpc.PostRaw(ctx, p.client, p.upstream, p.upstreamSecret, body)
+}
+
+// rewritePayloadStatus replaces the payload status of a newPayload or forkchoiceUpdated response.
+func rewritePayloadStatus(resp []byte, status types.ExecutePayloadStatus) ([]byte, error) {
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(resp, &msg); err != nil {
+		return nil, err
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(msg["result"], &result); err != nil || result == nil {
+		return nil, errNoStatus
+	}
+	encoded, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := result["status"]; ok {
+		result["status"] = encoded
+	} else if raw, ok := result["payloadStatus"]; ok {
+		var payloadStatus map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &payloadStatus); err != nil || payloadStatus == nil {
+			return nil, errNoStatus
+		}
+		payloadStatus["status"] = encoded
+		if result["payloadStatus"], err = json.Marshal(payloadStatus); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errNoStatus
+	}
+	if msg["result"], err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+	return json.Marshal(msg)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mergemock/rpc"
+	"mergemock/types"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestUpstream returns an execution client stand-in that only accepts tokens of the secret, and answers
+// forkchoice updates as valid. It counts the calls of each method.
+func newTestUpstream(t *testing.T, secret []byte) (*httptest.Server, func(method string) int) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := rpc.VerifyJwtAuthorization(req.Header.Get("Authorization"), secret); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var call struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&call))
+		mu.Lock()
+		calls[call.Method]++
+		mu.Unlock()
+		result := `false`
+		if call.Method == "engine_forkchoiceUpdatedV1" {
+			result = `{"payloadStatus":{"status":"VALID","latestValidHash":null,"validationError":null},"payloadId":null}`
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, call.ID, result)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(method string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[method]
+	}
+}
+
+func TestProxy(t *testing.T) {
+	ctx := context.Background()
+	// The execution client has a secret of its own
+	upstreamJwtPath := fmt.Sprintf("%s/upstream.hex", t.TempDir())
+	require.NoError(t, os.WriteFile(upstreamJwtPath, []byte(common.Bytes2Hex(common.Hash{0x01}.Bytes())), 0644))
+	upstreamJwt, err := loadJwtSecret(upstreamJwtPath)
+	require.NoError(t, err)
+	upstream, calls := newTestUpstream(t, upstreamJwt)
+
+	cfg := new(ProxyCmd)
+	cfg.Default()
+	cfg.UpstreamAddr = upstream.URL
+	cfg.JwtSecretPath = newJwt(t)
+	cfg.UpstreamJwtSecretPath = upstreamJwtPath
+	cfg.Rules = []string{
+		"engine_forkchoiceUpdated*:status:SYNCING",
+		"eth_syncing:duplicate",
+		"eth_chainId:drop",
+		"eth_blockNumber:delay:100ms",
+	}
+	backend, err := NewProxyBackend(logrus.New(), cfg)
+	require.NoError(t, err)
+	srv := httptest.NewServer(backend)
+	defer srv.Close()
+
+	// Requests need a token of the proxy secret
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_syncing","params":[]}`)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Zero(t, calls("eth_syncing"))
+
+	jwt, err := loadJwtSecret(cfg.JwtSecretPath)
+	require.NoError(t, err)
+	client, err := rpc.DialContext(ctx, srv.URL, jwt)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var result types.ForkchoiceUpdatedResult
+	require.NoError(t, client.CallContext(ctx, &result, "engine_forkchoiceUpdatedV1", &types.ForkchoiceStateV1{}, nil))
+	require.Equal(t, types.ExecutionSyncing, result.PayloadStatus.Status)
+	require.Equal(t, 1, calls("engine_forkchoiceUpdatedV1"))
+
+	var syncing bool
+	require.NoError(t, client.CallContext(ctx, &syncing, "eth_syncing"))
+	require.Equal(t, 2, calls("eth_syncing"))
+
+	require.Error(t, client.CallContext(ctx, nil, "eth_chainId"))
+	require.Zero(t, calls("eth_chainId"))
+
+	start := time.Now()
+	require.NoError(t, client.CallContext(ctx, nil, "eth_blockNumber"))
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	require.Equal(t, 1, calls("eth_blockNumber"))
+}
+
+func TestProxyRules(t *testing.T) {
+	rule, err := parseProxyRule("engine_newPayloadV1:delay:2s@0.25")
+	require.NoError(t, err)
+	require.Equal(t, &proxyRule{method: "engine_newPayloadV1", action: ProxyActionDelay, delay: 2 * time.Second, freq: 0.25}, rule)
+	require.True(t, rule.matches("engine_newPayloadV1"))
+	require.False(t, rule.matches("engine_newPayloadV2"))
+
+	rule, err = parseProxyRule("engine_*:status:INVALID")
+	require.NoError(t, err)
+	require.Equal(t, types.ExecutionInvalid, rule.status)
+	require.True(t, rule.matches("engine_newPayloadV2"))
+	require.False(t, rule.matches("eth_syncing"))
+
+	for _, s := range []string{
+		"engine_newPayloadV1",
+		"engine_newPayloadV1:explode",
+		"engine_newPayloadV1:delay:soon",
+		"engine_newPayloadV1:status:FINE",
+		"engine_newPayloadV1:drop:now",
+		"engine_newPayloadV1:drop@2",
+	} {
+		_, err := parseProxyRule(s)
+		require.Error(t, err, s)
+	}
+
+	rewritten, err := rewritePayloadStatus([]byte(`{"jsonrpc":"2.0","id":1,"result":{"status":"VALID","latestValidHash":null}}`), types.ExecutionInvalid)
+	require.NoError(t, err)
+	var status struct {
+		Result types.PayloadStatusV1 `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(rewritten, &status))
+	require.Equal(t, types.ExecutionInvalid, status.Result.Status)
+	_, err = rewritePayloadStatus([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`), types.ExecutionInvalid)
+	require.ErrorIs(t, err, errNoStatus)
+}
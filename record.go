@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sessionEntry is a JSON-RPC request served by the engine and its response, one per line of a session file.
+type sessionEntry struct {
+	RequestTime  time.Time       `json:"requestTime"`
+	ResponseTime time.Time       `json:"responseTime"`
+	Status       int             `json:"status"`
+	Request      json.RawMessage `json:"request"`
+	Response     json.RawMessage `json:"response"`
+}
+
+// sessionRecorder appends the requests and responses of the HTTP server of the engine to a session file. The engine
+// does not record with its websocket server enabled, so that the session has every request.
+type sessionRecorder struct {
+	log logrus.Ext1FieldLogger
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func newSessionRecorder(log logrus.Ext1FieldLogger, path string) (*sessionRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionRecorder{log: log, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *sessionRecorder) record(entry *sessionEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(entry)
+}
+
+func (r *sessionRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// recordingResponseWriter keeps a copy of the response written through it.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// middleware records the POST requests of the handler with their responses.
+func (r *sessionRecorder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			next.ServeHTTP(w, req)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		// keep responses uncompressed, to record them as they are
+		req.Header.Del("Accept-Encoding")
+		entry := &sessionEntry{RequestTime: time.Now(), Request: asRawJSON(body)}
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, req)
+		entry.ResponseTime, entry.Status, entry.Response = time.Now(), rw.status, asRawJSON(rw.body.Bytes())
+		if err := r.record(entry); err != nil {
+			// the response is already given, the session just misses it
+			r.log.WithError(err).Warn("Failed to record request")
+		}
+	})
+}
+
+// asRawJSON returns the message as is if it is JSON, and as a JSON string otherwise, e.g. for an error in plain text.
+func asRawJSON(msg []byte) json.RawMessage {
+	msg = bytes.TrimSpace(msg)
+	if json.Valid(msg) {
+		return json.RawMessage(msg)
+	}
+	encoded, _ := json.Marshal(string(msg))
+	return encoded
+}
+
+// loadSession reads the entries of a session file.
+func loadSession(path string) ([]*sessionEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []*sessionEntry
+	scanner := bufio.NewScanner(f)
+	// payloads with many transactions make long lines
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := new(sessionEntry)
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mergemock/types"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Registrations dated further ahead than this are rejected, to allow for some clock drift.
+const maxRegistrationClockDrift = 10 * time.Second
+
+var (
+	errStaleRegistration  = errors.New("registration is older than the known registration")
+	errFutureRegistration = errors.New("registration timestamp is in the future")
+)
+
+// ValidatorRegistry keeps the latest registration of every validator that registered with the relay.
+// If a path is set, the registrations are persisted as JSON, to survive relay restarts.
+type ValidatorRegistry struct {
+	mu            sync.RWMutex
+	registrations map[types.PublicKey]*types.SignedValidatorRegistration
+	path          string
+}
+
+func NewValidatorRegistry(path string) (*ValidatorRegistry, error) {
+	r := &ValidatorRegistry{
+		registrations: make(map[types.PublicKey]*types.SignedValidatorRegistration),
+		path:          path,
+	}
+	if path == "" {
+		return r, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var stored []*types.SignedValidatorRegistration
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return nil, err
+	}
+	for _, reg := range stored {
+		r.registrations[reg.Message.Pubkey] = reg
+	}
+	return r, nil
+}
+
+func (r *ValidatorRegistry) Get(pubkey types.PublicKey) *types.SignedValidatorRegistration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.registrations[pubkey]
+}
+
+func (r *ValidatorRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.registrations)
+}
+
+// Update stores the registrations, which are expected to have valid signatures already.
+// Either all registrations are accepted, or none if any of them is stale or future-dated.
+// Re-sending the known registration is accepted, but does not change anything.
+func (r *ValidatorRegistry) Update(registrations []*types.SignedValidatorRegistration, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	maxTimestamp := uint64(now.Add(maxRegistrationClockDrift).Unix())
+	for _, reg := range registrations {
+		if reg.Message.Timestamp > maxTimestamp {
+			return errFutureRegistration
+		}
+		if known, ok := r.registrations[reg.Message.Pubkey]; ok && reg.Message.Timestamp < known.Message.Timestamp {
+			return errStaleRegistration
+		}
+	}
+	changed := false
+	for _, reg := range registrations {
+		if known, ok := r.registrations[reg.Message.Pubkey]; ok && reg.Message.Timestamp == known.Message.Timestamp {
+			continue
+		}
+		r.registrations[reg.Message.Pubkey] = reg
+		changed = true
+	}
+	if !changed || r.path == "" {
+		return nil
+	}
+	return r.persist()
+}
+
+func (r *ValidatorRegistry) persist() error {
+	all := make([]*types.SignedValidatorRegistration, 0, len(r.registrations))
+	for _, reg := range r.registrations {
+		all = append(all, reg)
+	}
+	raw, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	// write and rename, so a crash never leaves a partial file behind
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
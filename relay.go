@@ -2,19 +2,32 @@ package main
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"mergemock/api"
 	"mergemock/rpc"
 	"mergemock/types"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/gorilla/mux"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/prysmaticlabs/prysm/crypto/bls"
-	"github.com/prysmaticlabs/prysm/runtime/version"
 	"github.com/sirupsen/logrus"
 )
 
@@ -30,24 +43,69 @@ var (
 	errInvalidHash      = errors.New("invalid hash")
 	errInvalidPubkey    = errors.New("invalid pubkey")
 	errInvalidSignature = errors.New("invalid signature")
+	errUnknownValidator = errors.New("unknown validator")
+	errUnknownBid       = errors.New("no bid with this header was given for the slot")
+	errSlotNotCurrent   = errors.New("block is not for the current slot")
+	errSubmissionSlot   = errors.New("submission is not for the current or next slot")
+	errSubmissionFork   = errors.New("block submissions are Bellatrix payloads, without withdrawals or blobs")
+	errEmbeddedFork     = errors.New("the embedded engine builds Bellatrix payloads only, Capella and Deneb slots need --upstream-engine")
+	errAttributesSlot   = errors.New("payload attributes of the consensus client are for another slot")
+	errProposerMismatch = errors.New("proposer index belongs to another pubkey")
+	errEquivocation     = errors.New("another block was already signed for the slot")
+	errTraceMismatch    = errors.New("bid trace does not match execution payload")
+	errFeeRecipient     = errors.New("payload does not pay the registered fee recipient")
+	errBidUnpaid        = errors.New("proposer payment is less than the bid value")
+	errMediaType        = errors.New("unsupported media type")
+	errEngineNotRunning = errors.New("engine is not running")
+	errNoHead           = errors.New("no head to build on")
+	errBuildFailed      = errors.New("failed to build block")
 
 	pathStatus            = "/eth/v1/builder/status"
 	pathRegisterValidator = "/eth/v1/builder/validators"
 	pathGetHeader         = "/eth/v1/builder/header/{slot:[0-9]+}/{parent_hash:0x[a-fA-F0-9]+}/{pubkey:0x[a-fA-F0-9]+}"
 	pathGetPayload        = "/eth/v1/builder/blinded_blocks"
+
+	pathSubmitBlock       = "/relay/v1/builder/blocks"
+	pathBuilderValidators = "/relay/v1/builder/validators"
+
+	pathDataPayloadsDelivered     = "/relay/v1/data/bidtraces/proposer_payload_delivered"
+	pathDataBlocksReceived        = "/relay/v1/data/bidtraces/builder_blocks_received"
+	pathDataValidatorRegistration = "/relay/v1/data/validator_registration"
+
+	pathMockStatus = "/mock/v1/status"
 )
 
 type RelayCmd struct {
 	// connectivity options
-	ListenAddr         string `ask:"--listen-addr" help:"Address to bind relay HTTP server to"`
-	EngineListenAddr   string `ask:"--engine-listen-addr" help:"Address to bind engine JSON-RPC server to"`
-	EngineListenAddrWs string `ask:"--engine-listen-addr-ws" help:"Address to bind engine JSON-RPC WebSocket server to"`
+	ListenAddr         string        `ask:"--listen-addr" help:"Address to bind relay HTTP server to"`
+	EngineListenAddr   string        `ask:"--engine-listen-addr" help:"Address to bind engine JSON-RPC server to"`
+	EngineListenAddrWs string        `ask:"--engine-listen-addr-ws" help:"Address to bind engine JSON-RPC WebSocket server to"`
+	UpstreamEngine     string        `ask:"--upstream-engine" help:"Engine API address of an external execution client to build blocks with, instead of the embedded engine. Needs --beacon for the payload attributes, and the gas limit of the engine set to the registered one"`
+	UpstreamBuildTime  time.Duration `ask:"--upstream-build-time" help:"Time the upstream engine builds a payload for before getHeader gets it"`
+	BeaconAddr         string        `ask:"--beacon" help:"Address of a beacon API, e.g. of the consensus mock, to follow payload attributes events of for the timestamp and randao of builds, and to get the genesis time from. Needed with --upstream-engine"`
+	JwtSecretPath      string        `ask:"--jwt-secret" help:"JWT secret key for authenticated communication with the engine"`
+	SecretKey          string        `ask:"--secret-key" help:"Hex encoded BLS secret key the relay signs bids with (random if neither this nor --secret-key-file is set)"`
+	SecretKeyPath      string        `ask:"--secret-key-file" help:"File with the hex encoded BLS secret key the relay signs bids with, see the keygen command"`
 
 	// embed timeout and logger options
 	Timeout rpc.Timeout `ask:".timeout" help:"Configure timeouts of the HTTP servers"`
 	LogCmd  `ask:".log" help:"Change logger configuration"`
 
-	GenesisValidatorsRoot string `ask:"--genesis-validators-root" help:"Root of genesis validators"`
+	GenesisValidatorsRoot string        `ask:"--genesis-validators-root" help:"Root of genesis validators"`
+	Network               string        `ask:"--network" help:"Network whose fork versions sign builder and proposer messages: mainnet, sepolia, holesky, or a consensus spec config YAML file"`
+	BeaconGenesisTime     uint64        `ask:"--beacon-genesis-time" help:"Beacon genesis time, for the timestamps of builds and to check blocks are unblinded in their slot. Taken from --beacon if 0; without either, builds keep the timestamp the consensus client prepared, and blocks must be for the highest slot of getHeader requests"`
+	SlotTime              time.Duration `ask:"--slot-time" help:"Time per slot"`
+	SlotsPerEpoch         uint64        `ask:"--slots-per-epoch" help:"Slots per epoch"`
+	CapellaForkEpoch      uint64        `ask:"--capella-fork-epoch" help:"Epoch of the Capella fork, from which bids and blinded blocks are Capella ones. Only --upstream-engine builds Capella payloads"`
+	DenebForkEpoch        uint64        `ask:"--deneb-fork-epoch" help:"Epoch of the Deneb fork, from which bids and blinded blocks are Deneb ones. Only --upstream-engine builds Deneb payloads"`
+
+	// The relay has no beacon node, it simulates the same validator set as the consensus mock for proposer duties.
+	Validators        ValidatorsConfig `ask:".validators" help:"Configure the simulated validator set, for proposer duties"`
+	RegistrationsPath string           `ask:"--registrations" help:"File to persist validator registrations in (empty for in-memory only)"`
+
+	Bid       BidConfig        `ask:".bid" help:"Configure how the relay values its bids"`
+	Txs       BuilderTxsConfig `ask:".txs" help:"Configure the transaction mix of relay-built blocks, which earns the proposer the priority fees the bids are valued by"`
+	Misbehave MisbehaveConfig  `ask:".misbehave" help:"Make the relay misbehave at random, to test proposers against bad relays"`
 
 	close chan struct{}
 	log   *logrus.Logger
@@ -59,8 +117,15 @@ func (r *RelayCmd) Default() {
 	r.ListenAddr = "127.0.0.1:28545"
 	r.EngineListenAddr = "127.0.0.1:8551"
 	r.EngineListenAddrWs = "127.0.0.1:8552"
+	r.JwtSecretPath = "jwt.hex"
+	r.UpstreamBuildTime = 500 * time.Millisecond
 
 	r.GenesisValidatorsRoot = "0x0000000000000000000000000000000000000000000000000000000000000000"
+	r.Network = types.Mainnet.Name
+	r.SlotTime = time.Second * 12
+	r.SlotsPerEpoch = 32
+	r.CapellaForkEpoch = math.MaxUint64
+	r.DenebForkEpoch = math.MaxUint64
 
 	r.Timeout.Read = 30 * time.Second
 	r.Timeout.ReadHeader = 10 * time.Second
@@ -79,13 +144,36 @@ func (r *RelayCmd) Run(ctx context.Context, args ...string) error {
 		// Logger wasn't initialized so we can't log. Error out instead.
 		return err
 	}
-	backend, err := NewRelayBackend(r.log, r.EngineListenAddr, r.EngineListenAddrWs, r.GenesisValidatorsRoot)
+	if err := r.Bid.Validate(); err != nil {
+		return err
+	}
+	if err := r.Misbehave.Validate(); err != nil {
+		return err
+	}
+	if r.BeaconGenesisTime == 0 && r.BeaconAddr != "" {
+		genesis, err := beaconGenesisOf(ctx, r.BeaconAddr)
+		if err != nil {
+			return fmt.Errorf("unable to get beacon genesis: %v", err)
+		}
+		r.BeaconGenesisTime = genesis.GenesisTime
+	}
+	backend, err := NewRelayBackend(r.log, r)
 	if err != nil {
 		r.log.WithField("err", err).Fatal("Unable to initialize backend")
 	}
-	if err := backend.engine.Run(ctx); err != nil {
+	if r.UpstreamEngine != "" {
+		if r.BeaconAddr == "" {
+			return errNoUpstreamBeacon
+		}
+		if err := backend.connectUpstream(ctx, r.UpstreamEngine, r.JwtSecretPath); err != nil {
+			r.log.WithField("err", err).Fatal("Unable to connect to upstream engine")
+		}
+	} else if err := backend.engine.Run(ctx); err != nil {
 		r.log.WithField("err", err).Fatal("Unable to initialize engine")
 	}
+	if r.BeaconAddr != "" {
+		go backend.events.follow(ctx, r.BeaconAddr)
+	}
 	go r.startRESTApi(ctx, backend)
 	return nil
 }
@@ -117,7 +205,7 @@ func (r *RelayCmd) startRESTApi(ctx context.Context, backend *RelayBackend) {
 		IdleTimeout:       r.Timeout.Idle,
 	}
 
-	r.log.WithField("listenAddr", r.ListenAddr).Info("Relay started")
+	r.log.WithField("listenAddr", r.ListenAddr).WithField("pubkey", backend.pk).Info("Relay started")
 	go r.srv.ListenAndServe()
 	for range r.close {
 		r.srv.Close()
@@ -126,27 +214,141 @@ func (r *RelayCmd) startRESTApi(ctx context.Context, backend *RelayBackend) {
 }
 
 type RelayBackend struct {
-	log    *logrus.Logger
-	engine *EngineCmd
-	pk     types.PublicKey
-	sk     bls.SecretKey
+	log      *logrus.Logger
+	engine   *EngineCmd
+	upstream *rpc.Client // builds the blocks instead of the embedded engine, if set
+	started  time.Time
+	pk       types.PublicKey
+	sk       bls.SecretKey
 
 	genesisValidatorsRoot types.Root
+	network               *types.Network
+	builderDomain         types.Domain
+	registry              *ValidatorRegistry
+	beaconGenesisTime     uint64
+	slotTime              time.Duration
+	slotsPerEpoch         uint64
+	forks                 types.ForkSchedule
+	validators            *ValidatorSet
+	headSlot              uint64     // highest slot of getHeader requests, if the genesis time is unknown
+	bidCache              *lru.Cache // best bid to give in the next getHeader, by bidKey
+	servedBids            *lru.Cache // bids given in getHeader, by servedKey
+	data                  *DataStore
+	bids                  *BidConfig
+	txs                   TransactionsCreator
+	misbehave             *MisbehaveConfig
+	upstreamAddr          string
+	upstreamBuildTime     time.Duration
+	events                *attributesEvents // payload attributes events of the beacon node, for the attributes of builds
 
-	latestPubkey types.PublicKey // cache for pubkey from latest getHeader call
+	mu        sync.Mutex
+	unblinded map[uint64]types.Root // root of the block that was unblinded, by slot
+	// Validators outside the simulated set, e.g. of a real beacon chain, have their proposer index bound to
+	// the first pubkey that signed a block for it.
+	proposers map[uint64]types.PublicKey
 }
 
-func NewRelayBackend(log *logrus.Logger, engineListenAddr, engineListenAddrWs, genesisValidatorsRoot string) (*RelayBackend, error) {
+// bidKey identifies the getHeader request a bid was given for.
+type bidKey struct {
+	Slot       uint64
+	ParentHash common.Hash
+	Pubkey     types.PublicKey
+}
+
+// servedKey identifies a bid given in getHeader. Better submissions replace the best bid of a request,
+// bids already given stay deliverable.
+type servedKey struct {
+	bidKey
+	HeaderRoot types.Root
+}
+
+type relayBid struct {
+	key        bidKey
+	signed     *types.VersionedSignedBuilderBid
+	headerRoot types.Root // of the header in the bid, whatever its fork
+	payload    *types.ExecutionPayloadV1
+	fork       *types.PayloadForkFields // withdrawals and blobs of upstream Capella and Deneb payloads
+	trace      *types.BidTrace
+}
+
+func bidTraceV2(trace *types.BidTrace, payload *types.ExecutionPayloadV1) types.BidTraceV2 {
+	return types.BidTraceV2{
+		BidTrace:    *trace,
+		BlockNumber: payload.Number,
+		NumTx:       uint64(len(payload.Transactions)),
+	}
+}
+
+func NewRelayBackend(log *logrus.Logger, cfg *RelayCmd) (*RelayBackend, error) {
 	engine := &EngineCmd{}
 	engine.Default()
 	engine.LogCmd.Default()
-	engine.ListenAddr = engineListenAddr
-	engine.WebsocketAddr = engineListenAddrWs
+	engine.ListenAddr = cfg.EngineListenAddr
+	engine.WebsocketAddr = cfg.EngineListenAddrWs
+	engine.JwtSecretPath = cfg.JwtSecretPath
+
+	registry, err := NewValidatorRegistry(cfg.RegistrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load validator registrations: %v", err)
+	}
 
-	sk, _ := bls.RandKey()
+	bidCache, err := lru.New(128)
+	if err != nil {
+		return nil, err
+	}
+	servedBids, err := lru.New(256)
+	if err != nil {
+		return nil, err
+	}
+
+	genesisValidatorsRoot := types.Root(common.HexToHash(cfg.GenesisValidatorsRoot))
+	validators, err := NewValidatorSet(&cfg.Validators, cfg.SlotsPerEpoch, genesisValidatorsRoot)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load validators: %v", err)
+	}
+
+	network, err := loadNetwork(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	sk, err := loadSecretKey(cfg.SecretKey, cfg.SecretKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load relay key: %v", err)
+	}
 	var pk types.PublicKey
 	copy(pk[:], sk.PublicKey().Marshal())
-	return &RelayBackend{log, engine, pk, sk, types.Root(common.HexToHash(genesisValidatorsRoot)), types.PublicKey{}}, nil
+	return &RelayBackend{
+		log:                   log,
+		engine:                engine,
+		started:               time.Now(),
+		pk:                    pk,
+		sk:                    sk,
+		genesisValidatorsRoot: genesisValidatorsRoot,
+		network:               network,
+		builderDomain:         network.BuilderDomain(),
+		beaconGenesisTime:     cfg.BeaconGenesisTime,
+		slotTime:              cfg.SlotTime,
+		slotsPerEpoch:         cfg.SlotsPerEpoch,
+		forks: types.ForkSchedule{
+			SlotsPerEpoch: cfg.SlotsPerEpoch,
+			CapellaEpoch:  cfg.CapellaForkEpoch,
+			DenebEpoch:    cfg.DenebForkEpoch,
+		},
+		validators: validators,
+		registry:   registry,
+		bidCache:   bidCache,
+		servedBids: servedBids,
+		data:       NewDataStore(),
+		bids:       &cfg.Bid,
+		txs:        txMixCreator(&cfg.Txs),
+		misbehave:  &cfg.Misbehave,
+		unblinded:  make(map[uint64]types.Root),
+		proposers:  make(map[uint64]types.PublicKey),
+
+		upstreamBuildTime: cfg.UpstreamBuildTime,
+		events:            newAttributesEvents(log),
+	}, nil
 }
 
 func (r *RelayBackend) getRouter() http.Handler {
@@ -157,43 +359,139 @@ func (r *RelayBackend) getRouter() http.Handler {
 	router.HandleFunc(pathRegisterValidator, r.handleRegisterValidator).Methods(http.MethodPost)
 	router.HandleFunc(pathGetHeader, r.handleGetHeader).Methods(http.MethodGet)
 	router.HandleFunc(pathGetPayload, r.handleGetPayload).Methods(http.MethodPost)
+	router.HandleFunc(pathSubmitBlock, r.handleSubmitBlock).Methods(http.MethodPost)
+	router.HandleFunc(pathBuilderValidators, r.handleBuilderValidators).Methods(http.MethodGet)
+	router.HandleFunc(pathDataPayloadsDelivered, r.handleDataPayloadsDelivered).Methods(http.MethodGet)
+	router.HandleFunc(pathDataBlocksReceived, r.handleDataBlocksReceived).Methods(http.MethodGet)
+	router.HandleFunc(pathDataValidatorRegistration, r.handleDataValidatorRegistration).Methods(http.MethodGet)
+	router.HandleFunc(pathMockStatus, r.handleMockStatus).Methods(http.MethodGet)
 
 	// Add logging and return router
 	loggedRouter := LoggingMiddleware(router, r.log)
 	return loggedRouter
 }
 
+// handleStatus reports the relay ready when its engine is reachable and synced, with a head to build on.
 func (r *RelayBackend) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if _, _, err := r.head(req.Context()); err != nil {
+		r.log.WithError(err).Warn("Relay not ready")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{}`)
 }
 
-func (r *RelayBackend) handleRegisterValidator(w http.ResponseWriter, req *http.Request) {
-	payload := new(types.SignedValidatorRegistration)
-	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// RelayStatus is the state of the mock relay, for scripts to wait for readiness and follow its activity
+type RelayStatus struct {
+	Ready         bool         `json:"ready"`
+	Error         string       `json:"error,omitempty"`
+	Engine        string       `json:"engine"` // "embedded", or the upstream engine address
+	HeadHash      *common.Hash `json:"head_hash,omitempty"`
+	HeadNumber    uint64       `json:"head_number,string"`
+	Slot          uint64       `json:"slot,string"`
+	Registrations int          `json:"registrations"`
+	Bids          int          `json:"bids"`               // blocks built for getHeader or submitted by builders
+	Delivered     int          `json:"payloads_delivered"` // payloads unblinded for proposers
+	Uptime        uint64       `json:"uptime,string"`      // seconds
+}
+
+// handleMockStatus reports the state of the relay, with the readiness status code of handleStatus.
+func (r *RelayBackend) handleMockStatus(w http.ResponseWriter, req *http.Request) {
+	status := RelayStatus{
+		Engine:        "embedded",
+		Slot:          r.currentSlot(time.Now()),
+		Registrations: r.registry.Len(),
+		Uptime:        uint64(time.Since(r.started) / time.Second),
+	}
+	status.Delivered, status.Bids = r.data.Counts()
+	if r.upstream != nil {
+		status.Engine = r.upstreamAddr
+	}
+	hash, number, err := r.head(req.Context())
+	if err != nil {
+		status.Error = err.Error()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(&status)
 		return
 	}
+	status.Ready, status.HeadHash, status.HeadNumber = true, &hash, number
+	writeJSON(w, &status)
+}
 
-	if len(payload.Message.Pubkey) != 48 {
-		http.Error(w, errInvalidPubkey.Error(), http.StatusBadRequest)
-		return
+// head returns the hash and number of the head of the embedded or upstream engine.
+func (r *RelayBackend) head(ctx context.Context) (common.Hash, uint64, error) {
+	if r.upstream != nil {
+		head, err := r.upstreamHead(ctx)
+		if err != nil {
+			return common.Hash{}, 0, err
+		}
+		return head.Hash, uint64(head.Number), nil
 	}
+	if r.engine.backend == nil {
+		return common.Hash{}, 0, errEngineNotRunning
+	}
+	head := r.engine.mockChain().CurrentHeader()
+	if head == nil {
+		return common.Hash{}, 0, errNoHead
+	}
+	return head.Hash(), head.Number.Uint64(), nil
+}
 
-	if len(payload.Signature) != 96 {
-		http.Error(w, errInvalidSignature.Error(), http.StatusBadRequest)
+func (r *RelayBackend) handleRegisterValidator(w http.ResponseWriter, req *http.Request) {
+	isSSZ, err := requestIsSSZ(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	var payload []*types.SignedValidatorRegistration
+	if isSSZ {
+		body, err := ioutil.ReadAll(req.Body)
+		if err == nil {
+			payload, err = api.UnmarshalRegistrationsSSZ(body)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	ok, err := types.VerifySignature(payload.Message, types.DomainBuilder, payload.Message.Pubkey[:], payload.Signature[:])
-	if !ok || err != nil {
-		r.log.WithError(err).Error("error verifying signature")
-		http.Error(w, errInvalidSignature.Error(), http.StatusBadRequest)
+	for _, registration := range payload {
+		if registration == nil || registration.Message == nil {
+			http.Error(w, "missing registration message", http.StatusBadRequest)
+			return
+		}
+
+		if len(registration.Message.Pubkey) != 48 {
+			http.Error(w, errInvalidPubkey.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(registration.Signature) != 96 {
+			http.Error(w, errInvalidSignature.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ok, err := types.VerifySignature(registration.Message, r.builderDomain, registration.Message.Pubkey[:], registration.Signature[:])
+		if !ok || err != nil {
+			r.log.WithError(err).WithField("pubkey", registration.Message.Pubkey).Error("error verifying signature")
+			http.Error(w, errInvalidSignature.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := r.registry.Update(payload, time.Now()); err != nil {
+		r.log.WithError(err).Warn("Rejected validator registrations")
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	r.log.WithField("count", len(payload)).Info("Registered validators")
 
-	// TODO: update mapping?
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{}`)
@@ -211,7 +509,8 @@ func (r *RelayBackend) handleGetHeader(w http.ResponseWriter, req *http.Request)
 	})
 	plog.Info("getHeader")
 
-	if _, err := strconv.ParseInt(slot, 10, 64); err != nil {
+	slotNum, err := strconv.ParseUint(slot, 10, 64)
+	if err != nil {
 		http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
 		return
 	}
@@ -226,101 +525,752 @@ func (r *RelayBackend) handleGetHeader(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	payload, ok := r.engine.backend.recentPayloads.Get(common.HexToHash(parentHashHex))
-	if !ok {
-		plog.Warn("Cannot get unknown payload")
-		http.Error(w, "Cannot get unknown payload", http.StatusBadRequest)
+	var proposerPubkey types.PublicKey
+	if err := proposerPubkey.UnmarshalText([]byte(pubkey)); err != nil {
+		http.Error(w, errInvalidPubkey.Error(), http.StatusBadRequest)
+		return
+	}
+	registration := r.registry.Get(proposerPubkey)
+	if registration == nil {
+		plog.Warn("Validator is not registered")
+		http.Error(w, errUnknownValidator.Error(), http.StatusBadRequest)
 		return
 	}
 
-	payloadHeader, err := types.PayloadToPayloadHeader(payload.(*types.ExecutionPayloadV1))
+	r.observeSlot(slotNum)
+	if r.misbehave.roll(r.misbehave.NoBid) {
+		plog.Warn("Misbehaving: no bid")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	key := bidKey{Slot: slotNum, ParentHash: common.HexToHash(parentHashHex), Pubkey: proposerPubkey}
+	if cached, ok := r.bidCache.Get(key); ok {
+		plog.Info("Returning best bid for proposer")
+		r.serveBid(w, req, cached.(*relayBid))
+		return
+	}
+
+	payload, fork, trueValue, value, err := r.buildPayload(req.Context(), slotNum, key.ParentHash, registration.Message)
+	if errors.Is(err, errBuildFailed) {
+		plog.WithError(err).Error("Cannot build payload")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		plog.WithError(err).Warn("Cannot build payload")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	plog.WithFields(logrus.Fields{
+		"blockHash":    payload.BlockHash,
+		"feeRecipient": registration.Message.FeeRecipient,
+		"coinbase":     payload.FeeRecipient,
+		"gasLimit":     payload.GasLimit,
+		"trueValue":    trueValue,
+		"value":        value,
+		"strategy":     r.bids.Strategy,
+	}).Info("Built payload for proposer")
+
+	signed, headerRoot, err := r.signBid(r.forks.Version(slotNum), payload, fork, types.U256Str(common.BigToHash(value)))
 	if err != nil {
-		plog.Warn("Cannot convert payload to header")
-		http.Error(w, "cannot convert payload to header", http.StatusBadRequest)
+		plog.WithError(err).Warn("Cannot sign bid")
+		http.Error(w, "cannot sign bid", http.StatusBadRequest)
 		return
 	}
+	trace := &types.BidTrace{
+		Slot:                 key.Slot,
+		ParentHash:           types.Hash(key.ParentHash),
+		BlockHash:            types.Hash(payload.BlockHash),
+		BuilderPubkey:        r.pk,
+		ProposerPubkey:       key.Pubkey,
+		ProposerFeeRecipient: registration.Message.FeeRecipient,
+		GasLimit:             payload.GasLimit,
+		GasUsed:              payload.GasUsed,
+		Value:                signed.Value(),
+	}
+	bid := &relayBid{key: key, signed: signed, headerRoot: headerRoot, payload: payload, fork: fork, trace: trace}
+	r.data.AddReceived(types.BidTraceV2WithTimestamp{BidTraceV2: bidTraceV2(trace, payload), Timestamp: time.Now().Unix()})
+	// A builder submission may have arrived while building
+	best, _ := r.offerBid(bid)
 
 	plog.Info("Consensus client retrieved prepared payload header")
+	r.serveBid(w, req, best)
+}
 
-	bid := types.BuilderBid{
-		Header: payloadHeader,
-		Value:  [32]byte{0x1},
-		Pubkey: r.pk,
+// offerBid caches the bid as the best of its request, unless a bid of at least its value is cached already,
+// and returns the best bid and whether it is the offered one.
+func (r *RelayBackend) offerBid(bid *relayBid) (*relayBid, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached, ok := r.bidCache.Peek(bid.key); ok {
+		cachedBid := cached.(*relayBid)
+		cachedValue, value := cachedBid.signed.Value(), bid.signed.Value()
+		if new(big.Int).SetBytes(value[:]).Cmp(new(big.Int).SetBytes(cachedValue[:])) <= 0 {
+			return cachedBid, false
+		}
 	}
-	msg, err := types.ComputeSigningRoot(&bid, types.DomainBuilder)
+	r.bidCache.Add(bid.key, bid)
+	return bid, true
+}
+
+// serveBid writes the bid and remembers it was given, so its block can be unblinded after a better bid replaced it.
+func (r *RelayBackend) serveBid(w http.ResponseWriter, req *http.Request, bid *relayBid) {
+	r.servedBids.Add(servedKey{bidKey: bid.key, HeaderRoot: bid.headerRoot}, bid)
+	r.writeBid(w, req, bid)
+}
+
+func (r *RelayBackend) signBid(version string, payload *types.ExecutionPayloadV1, fork *types.PayloadForkFields, value types.U256Str) (*types.VersionedSignedBuilderBid, types.Root, error) {
+	return signBuilderBid(r.sk, r.pk, r.builderDomain, version, payload, fork, value)
+}
+
+// signBuilderBid signs a bid of the given fork for the payload, and returns it with the root of its header.
+// Capella and Deneb payloads without fork fields have no withdrawals nor blobs.
+func signBuilderBid(sk bls.SecretKey, pk types.PublicKey, domain types.Domain, version string, payload *types.ExecutionPayloadV1, fork *types.PayloadForkFields, value types.U256Str) (*types.VersionedSignedBuilderBid, types.Root, error) {
+	bid, err := newBuilderBid(pk, version, payload, fork, value)
 	if err != nil {
-		plog.Warn("cannot compute signing root")
-		http.Error(w, "cannot compute signing root", http.StatusBadRequest)
-		return
+		return nil, types.Root{}, err
 	}
-	var sig types.Signature
-	tmp := r.sk.Sign(msg[:])
-	copy(sig[:], tmp.Marshal())
-	response := &types.GetHeaderResponse{
-		Version: "bellatrix",
-		Data:    &types.SignedBuilderBid{Message: &bid, Signature: sig},
+	headerRoot, err := bid.HeaderRoot()
+	if err != nil {
+		return nil, types.Root{}, err
+	}
+	msg, err := types.ComputeSigningRoot(bid.Message(), domain)
+	if err != nil {
+		return nil, types.Root{}, err
 	}
+	var signature types.Signature
+	copy(signature[:], sk.Sign(msg[:]).Marshal())
+	bid.SetSignature(signature)
+	return bid, headerRoot, nil
+}
 
-	if err = r.latestPubkey.UnmarshalText([]byte(pubkey)); err != nil {
-		plog.Warn("Cannot unmarshal pubkey")
-		http.Error(w, "cannot unmarshal pubkey", http.StatusBadRequest)
-		return
+// newBuilderBid makes an unsigned bid of the fork version for the payload, with the fields of its fork.
+func newBuilderBid(pk types.PublicKey, version string, payload *types.ExecutionPayloadV1, fork *types.PayloadForkFields, value types.U256Str) (*types.VersionedSignedBuilderBid, error) {
+	bid := &types.VersionedSignedBuilderBid{Version: version}
+	switch version {
+	case types.VersionBellatrix:
+		h, err := types.PayloadToPayloadHeader(payload)
+		if err != nil {
+			return nil, err
+		}
+		bid.Bellatrix = &types.SignedBuilderBid{Message: &types.BuilderBid{Header: h, Value: value, Pubkey: pk}}
+	case types.VersionCapella:
+		h, err := types.PayloadToPayloadHeaderCapella(payload, fork)
+		if err != nil {
+			return nil, err
+		}
+		bid.Capella = &types.SignedBuilderBidCapella{Message: &types.BuilderBidCapella{Header: h, Value: value, Pubkey: pk}}
+	case types.VersionDeneb:
+		h, err := types.PayloadToPayloadHeaderDeneb(payload, fork)
+		if err != nil {
+			return nil, err
+		}
+		bid.Deneb = &types.SignedBuilderBidDeneb{Message: &types.BuilderBidDeneb{
+			Header:             h,
+			BlobKzgCommitments: fork.BlobKzgCommitments(),
+			Value:              value,
+			Pubkey:             pk,
+		}}
+	default:
+		return nil, fmt.Errorf("unsupported version %q", version)
 	}
+	return bid, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+func (r *RelayBackend) writeBid(w http.ResponseWriter, req *http.Request, bid *relayBid) {
+	signed, err := r.misbehaveBid(bid)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	r.misbehaveDelay(req.Context().Done())
+	w.Header().Set(api.HeaderConsensusVersion, signed.Version)
+	if acceptsSSZ(req) {
+		writeSSZ(w, signed)
+		return
+	}
+	writeJSON(w, signed)
 }
 
 func (r *RelayBackend) handleGetPayload(w http.ResponseWriter, req *http.Request) {
 	plog := r.log.WithField("method", "getPayload")
 
-	payload := new(types.SignedBlindedBeaconBlock)
-	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+	isSSZ, err := requestIsSSZ(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, err := decodeBlindedBlock(&r.forks, body, req.Header.Get(api.HeaderConsensusVersion), isSSZ)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if len(payload.Signature) != 96 {
-		http.Error(w, errInvalidSignature.Error(), http.StatusBadRequest)
+	if !payload.Complete() {
+		http.Error(w, "missing execution payload header", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.checkSlot(payload.Slot(), time.Now()); err != nil {
+		plog.WithError(err).Warn("Cannot unblind block")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bid, err := r.deliveredBid(payload)
+	if err != nil {
+		plog.WithError(err).Warn("Cannot unblind block")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.misbehave.roll(r.misbehave.WithholdPayload) {
+		plog.WithField("slot", payload.Slot()).Warn("Misbehaving: withholding payload")
+		http.Error(w, "payload withheld", http.StatusInternalServerError)
 		return
 	}
 
-	domain := types.ComputeDomain(types.DomainTypeBeaconProposer, version.Bellatrix, &r.genesisValidatorsRoot)
-	ok, err := types.VerifySignature(payload.Message, domain, r.latestPubkey[:], payload.Signature[:])
+	first, err := r.markUnblinded(payload, bid.key.Pubkey)
+	if err != nil {
+		plog.WithError(err).Warn("Cannot unblind block")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if first {
+		r.data.AddDelivered(bidTraceV2(bid.trace, bid.payload))
+	}
+	plog.WithFields(logrus.Fields{
+		"slot":      payload.Slot(),
+		"version":   payload.Version,
+		"pubkey":    bid.key.Pubkey,
+		"blockHash": bid.payload.BlockHash,
+	}).Info("Unblinding block for proposer")
+
+	execPayload, err := types.ELToVersionedPayload(payload.Version, r.misbehavePayload(bid.payload), bid.fork)
+	if err != nil {
+		plog.WithError(err).Warn("Cannot convert payload")
+		http.Error(w, "cannot convert payload", http.StatusBadRequest)
+		return
+	}
+
+	if r.misbehave.roll(r.misbehave.BadVersion) {
+		plog.Warn("Misbehaving: malformed payload version")
+		execPayload.Version = malformedVersion
+	}
+	r.misbehaveDelay(req.Context().Done())
+	w.Header().Set(api.HeaderConsensusVersion, execPayload.Version)
+	if acceptsSSZ(req) {
+		writeSSZ(w, execPayload)
+		return
+	}
+	writeJSON(w, execPayload)
+}
+
+// decodeBlindedBlock decodes a posted signed blinded block, for the fork named in the request, or else the fork of
+// the block slot.
+func decodeBlindedBlock(forks *types.ForkSchedule, body []byte, version string, isSSZ bool) (*types.VersionedSignedBlindedBeaconBlock, error) {
+	if version == "" {
+		slot, err := blindedBlockSlot(body, isSSZ)
+		if err != nil {
+			return nil, err
+		}
+		version = forks.Version(slot)
+	}
+	block := &types.VersionedSignedBlindedBeaconBlock{Version: version}
+	if isSSZ {
+		return block, block.UnmarshalSSZ(body)
+	}
+	return block, json.Unmarshal(body, block)
+}
+
+// blindedBlockSlot reads the slot of a signed blinded block of any fork: it comes first in the message,
+// which comes first in the JSON object, and after the message offset and signature in SSZ.
+func blindedBlockSlot(body []byte, isSSZ bool) (uint64, error) {
+	if isSSZ {
+		if len(body) < 108 {
+			return 0, errors.New("signed blinded block too short")
+		}
+		return binary.LittleEndian.Uint64(body[100:108]), nil
+	}
+	var block struct {
+		Message *struct {
+			Slot uint64 `json:"slot,string"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &block); err != nil {
+		return 0, err
+	}
+	if block.Message == nil {
+		return 0, errors.New("missing blinded block message")
+	}
+	return block.Message.Slot, nil
+}
+
+// Number of slots to remember unblinded blocks of, to detect equivocations.
+const unblindedSlotsKept = 64
+
+// checkSlot checks the block is unblinded during its slot, allowing for half a slot of clock drift ahead of it.
+// Without a genesis time, the block must be for the highest slot of getHeader requests.
+func (r *RelayBackend) checkSlot(slot uint64, now time.Time) error {
+	if r.beaconGenesisTime == 0 {
+		if slot != r.currentSlot(now) {
+			return errSlotNotCurrent
+		}
+		return nil
+	}
+	slotStart := time.Unix(int64(r.beaconGenesisTime), 0).Add(time.Duration(slot) * r.slotTime)
+	if now.Before(slotStart.Add(-r.slotTime/2)) || !now.Before(slotStart.Add(r.slotTime)) {
+		return errSlotNotCurrent
+	}
+	return nil
+}
+
+// markUnblinded checks the proposer index of the block belongs to the pubkey, records that the block was unblinded,
+// and returns whether it is unblinded for the first time. Unblinding the same block again is fine, but a different
+// block for the slot is an equivocation. Validators of the simulated set must use their index there, others
+// must be registered and keep the index they first signed with.
+func (r *RelayBackend) markUnblinded(block *types.VersionedSignedBlindedBeaconBlock, pubkey types.PublicKey) (bool, error) {
+	root, err := block.Message().HashTreeRoot()
+	if err != nil {
+		return false, err
+	}
+	proposerIndex, blockSlot := block.ProposerIndex(), block.Slot()
+	simulated := r.validators.ByPubkey(pubkey)
+	if simulated != nil && simulated.Index != proposerIndex {
+		return false, errProposerMismatch
+	}
+	if simulated == nil && r.registry.Get(pubkey) == nil {
+		return false, errUnknownValidator
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if known, ok := r.proposers[proposerIndex]; simulated == nil && ok && known != pubkey {
+		return false, errProposerMismatch
+	}
+	known, ok := r.unblinded[blockSlot]
+	if ok && known != root {
+		return false, errEquivocation
+	}
+	if simulated == nil {
+		r.proposers[proposerIndex] = pubkey
+	}
+	r.unblinded[blockSlot] = root
+	for slot := range r.unblinded {
+		if slot+unblindedSlotsKept < blockSlot {
+			delete(r.unblinded, slot)
+		}
+	}
+	return !ok, nil
+}
+
+// deliveredBid finds the bid that was given in getHeader for the slot and parent of the signed blinded block,
+// with exactly its header, to the proposer that signed it.
+func (r *RelayBackend) deliveredBid(block *types.VersionedSignedBlindedBeaconBlock) (*relayBid, error) {
+	headerRoot, err := block.HeaderRoot()
+	if err != nil {
+		return nil, err
+	}
+	domain, err := r.network.ProposerDomain(block.Version, &r.genesisValidatorsRoot)
+	if err != nil {
+		return nil, err
+	}
+	signature := block.Signature()
+	matched := false
+	for _, k := range r.servedBids.Keys() {
+		key := k.(servedKey)
+		if key.Slot != block.Slot() || key.ParentHash != common.Hash(block.ParentHash()) || key.HeaderRoot != headerRoot {
+			continue
+		}
+		cached, ok := r.servedBids.Peek(key)
+		if !ok {
+			continue
+		}
+		bid := cached.(*relayBid)
+		matched = true
+		if ok, err := types.VerifySignature(block.Message(), domain, key.Pubkey[:], signature[:]); ok && err == nil {
+			return bid, nil
+		}
+	}
+	if matched {
+		return nil, errInvalidSignature
+	}
+	return nil, errUnknownBid
+}
+
+func (r *RelayBackend) handleSubmitBlock(w http.ResponseWriter, req *http.Request) {
+	plog := r.log.WithField("method", "submitBlock")
+
+	submission := new(types.BuilderSubmitBlockRequest)
+	if err := json.NewDecoder(req.Body).Decode(submission); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if submission.Message == nil || submission.ExecutionPayload == nil {
+		http.Error(w, "missing bid trace or execution payload", http.StatusBadRequest)
+		return
+	}
+	trace := submission.Message
+	plog = plog.WithFields(logrus.Fields{
+		"slot":      trace.Slot,
+		"builder":   trace.BuilderPubkey,
+		"proposer":  trace.ProposerPubkey,
+		"blockHash": trace.BlockHash,
+		"value":     trace.Value.String(),
+	})
+
+	ok, err := types.VerifySignature(trace, r.builderDomain, trace.BuilderPubkey[:], submission.Signature[:])
 	if !ok || err != nil {
-		plog.WithError(err).Error("error verifying signature")
+		plog.WithError(err).Warn("error verifying builder signature")
 		http.Error(w, errInvalidSignature.Error(), http.StatusBadRequest)
 		return
 	}
 
-	parentHashHex := payload.Message.Body.ExecutionPayloadHeader.ParentHash.String()
-	_execPayloadEL, ok := r.engine.backend.recentPayloads.Get(common.HexToHash(parentHashHex))
-	if !ok {
-		plog.Warn("Cannot get unknown payload")
-		http.Error(w, "Cannot get unknown payload", http.StatusBadRequest)
+	payload, err := types.RESTPayloadToELPayload(submission.ExecutionPayload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.BlockHash != common.Hash(trace.BlockHash) || payload.ParentHash != common.Hash(trace.ParentHash) ||
+		payload.GasLimit != trace.GasLimit || payload.GasUsed != trace.GasUsed {
+		http.Error(w, errTraceMismatch.Error(), http.StatusBadRequest)
+		return
+	}
+
+	registration := r.registry.Get(trace.ProposerPubkey)
+	if registration == nil {
+		http.Error(w, errUnknownValidator.Error(), http.StatusBadRequest)
+		return
+	}
+	if trace.ProposerFeeRecipient != registration.Message.FeeRecipient {
+		http.Error(w, errFeeRecipient.Error(), http.StatusBadRequest)
+		return
+	}
+	if current := r.currentSlot(time.Now()); trace.Slot != current && trace.Slot != current+1 {
+		plog.WithField("currentSlot", current).Warn("Submission for another slot")
+		http.Error(w, errSubmissionSlot.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.forks.Version(trace.Slot) != types.VersionBellatrix {
+		http.Error(w, errSubmissionFork.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Simulate the block on top of its parent, without adding it to the chain.
+	if r.upstream != nil {
+		http.Error(w, errNoSimulation.Error(), http.StatusBadRequest)
+		return
+	}
+	paid, err := r.engine.mockChain().PaymentValue(payload, common.Address(trace.ProposerFeeRecipient))
+	if err != nil {
+		plog.WithError(err).Warn("Block simulation failed")
+		http.Error(w, fmt.Sprintf("block simulation failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	value := new(big.Int).SetBytes(trace.Value[:])
+	if paid.Cmp(value) < 0 {
+		plog.WithField("paid", paid).Warn("Builder does not pay its bid")
+		http.Error(w, errBidUnpaid.Error(), http.StatusBadRequest)
+		return
+	}
+
+	signed, headerRoot, err := r.signBid(r.forks.Version(trace.Slot), payload, nil, trace.Value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	key := bidKey{Slot: trace.Slot, ParentHash: payload.ParentHash, Pubkey: trace.ProposerPubkey}
+	_, best := r.offerBid(&relayBid{key: key, signed: signed, headerRoot: headerRoot, payload: payload, trace: trace})
+	r.data.AddReceived(types.BidTraceV2WithTimestamp{BidTraceV2: bidTraceV2(trace, payload), Timestamp: time.Now().Unix()})
+	plog.WithField("best", best).Info("Accepted block submission")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{}`)
+}
+
+// handleBuilderValidators returns the registered proposers of the current and next epoch.
+func (r *RelayBackend) handleBuilderValidators(w http.ResponseWriter, req *http.Request) {
+	current := r.currentSlot(time.Now())
+	epoch := current / r.slotsPerEpoch
+	entries := make([]types.BuilderGetValidatorsResponseEntry, 0)
+	for e := epoch; e <= epoch+1; e++ {
+		for i, index := range r.validators.ProposerDuties(e) {
+			slot := e*r.slotsPerEpoch + uint64(i)
+			if slot < current {
+				continue
+			}
+			registration := r.registry.Get(r.validators.ByIndex(index).Pubkey)
+			if registration == nil {
+				continue
+			}
+			entries = append(entries, types.BuilderGetValidatorsResponseEntry{
+				Slot:           slot,
+				ValidatorIndex: index,
+				Entry:          registration,
+			})
+		}
+	}
+	writeJSON(w, entries)
+}
+
+func (r *RelayBackend) handleDataPayloadsDelivered(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseTraceFilter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	plog.Info(_execPayloadEL)
+	writeJSON(w, r.data.Delivered(filter))
+}
 
-	execPayload, err := types.ELPayloadToRESTPayload(_execPayloadEL.(*types.ExecutionPayloadV1))
+func (r *RelayBackend) handleDataBlocksReceived(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseTraceFilter(req)
 	if err != nil {
-		plog.Warn("Cannot convert payload to payloadREST")
-		http.Error(w, "cannot convert payload to payloadREST", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	writeJSON(w, r.data.Received(filter))
+}
 
-	response := types.GetPayloadResponse{
-		Version: "bellatrix",
-		Data:    execPayload,
+func (r *RelayBackend) handleDataValidatorRegistration(w http.ResponseWriter, req *http.Request) {
+	var pubkey types.PublicKey
+	if err := pubkey.UnmarshalText([]byte(req.URL.Query().Get("pubkey"))); err != nil {
+		http.Error(w, errInvalidPubkey.Error(), http.StatusBadRequest)
+		return
+	}
+	registration := r.registry.Get(pubkey)
+	if registration == nil {
+		http.Error(w, errUnknownValidator.Error(), http.StatusNotFound)
+		return
 	}
+	writeJSON(w, registration)
+}
 
+// parseTraceFilter reads the slot, block_hash, proposer_pubkey and limit query parameters.
+func parseTraceFilter(req *http.Request) (*TraceFilter, error) {
+	query := req.URL.Query()
+	filter := new(TraceFilter)
+	if v := query.Get("slot"); v != "" {
+		slot, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errInvalidSlot
+		}
+		filter.Slot = &slot
+	}
+	if v := query.Get("block_hash"); v != "" {
+		var hash types.Hash
+		if err := hash.UnmarshalText([]byte(v)); err != nil {
+			return nil, errInvalidHash
+		}
+		filter.BlockHash = &hash
+	}
+	if v := query.Get("proposer_pubkey"); v != "" {
+		var pubkey types.PublicKey
+		if err := pubkey.UnmarshalText([]byte(v)); err != nil {
+			return nil, errInvalidPubkey
+		}
+		filter.ProposerPubkey = &pubkey
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit")
+		}
+		filter.Limit = int(limit)
+	}
+	return filter, nil
+}
+
+// requestIsSSZ tells if the request body is SSZ rather than JSON encoded.
+func requestIsSSZ(req *http.Request) (bool, error) {
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		return false, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false, err
+	}
+	switch mediaType {
+	case api.MediaTypeJSON:
+		return false, nil
+	case api.MediaTypeSSZ:
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: %s", errMediaType, mediaType)
+	}
+}
+
+// acceptsSSZ tells if the client prefers an SSZ response, following the quality values of its Accept header.
+// JSON is the default.
+func acceptsSSZ(req *http.Request) bool {
+	var sszQ, jsonQ float64
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case api.MediaTypeSSZ:
+			sszQ = math.Max(sszQ, q)
+		case api.MediaTypeJSON, "application/*", "*/*":
+			jsonQ = math.Max(jsonQ, q)
+		}
+	}
+	return sszQ > jsonQ
+}
+
+func writeSSZ(w http.ResponseWriter, v interface{ MarshalSSZ() ([]byte, error) }) {
+	b, err := v.MarshalSSZ()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", api.MediaTypeSSZ)
+	w.Write(b)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
+
+// currentSlot is the wall clock slot, or the highest slot of getHeader requests if the genesis time is unknown.
+func (r *RelayBackend) currentSlot(now time.Time) uint64 {
+	if r.beaconGenesisTime == 0 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.headSlot
+	}
+	since := now.Sub(time.Unix(int64(r.beaconGenesisTime), 0))
+	if since < 0 {
+		return 0
+	}
+	return uint64(since / r.slotTime)
+}
+
+func (r *RelayBackend) observeSlot(slot uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slot > r.headSlot {
+		r.headSlot = slot
+	}
+}
+
+// slotAttributes returns the timestamp and randao of the slot, from the payload attributes for the slot and parent:
+// those of the beacon node's event if the relay follows one, otherwise those the consensus client prepared a payload
+// on the parent with. The timestamp is genesis time + slot × slot time, and the attributes must have it; without a
+// genesis time, the timestamp of the attributes is taken as it is.
+func (r *RelayBackend) slotAttributes(slot uint64, parentHash common.Hash) (timestamp uint64, randao common.Hash, err error) {
+	if event := r.events.get(slot); event != nil && event.ParentBlockHash == parentHash {
+		timestamp, randao = event.PayloadAttributes.Timestamp, event.PayloadAttributes.PrevRandao
+	} else if prepared, ok := r.engine.backend.recentPayloads.Get(parentHash); ok {
+		timestamp, randao = prepared.(*types.ExecutionPayloadV1).Timestamp, prepared.(*types.ExecutionPayloadV1).Random
+	} else {
+		return 0, common.Hash{}, fmt.Errorf("no payload prepared for parent %s", parentHash)
+	}
+	if r.beaconGenesisTime == 0 {
+		return timestamp, randao, nil
+	}
+	if slotTimestamp := r.beaconGenesisTime + uint64((time.Duration(slot) * r.slotTime).Seconds()); timestamp != slotTimestamp {
+		return 0, common.Hash{}, fmt.Errorf("%w: timestamp %d instead of %d", errAttributesSlot, timestamp, slotTimestamp)
+	}
+	return timestamp, randao, nil
+}
+
+// buildPayload builds a payload with the transaction mix on top of the parent, for the proposer with the given
+// registration, and returns it with the block revenue and the bid value.
+// The timestamp and randao are those of the slot, and the gas limit moves towards the registered gas limit.
+// Without a payment account the fee recipient is the registered one. Otherwise the payment account is the
+// coinbase, and a final transaction pays the bid value to the registered fee recipient.
+func (r *RelayBackend) buildPayload(ctx context.Context, slot uint64, parentHash common.Hash, registration *types.RegisterValidatorRequestMessage) (payload *types.ExecutionPayloadV1, fork *types.PayloadForkFields, revenue *big.Int, value *big.Int, err error) {
+	if r.upstream != nil {
+		return r.buildUpstreamPayload(ctx, slot, parentHash, registration)
+	}
+	if r.forks.Version(slot) != types.VersionBellatrix {
+		return nil, nil, nil, nil, errEmbeddedFork
+	}
+	parent := r.engine.mockChain().chain.GetHeaderByHash(parentHash)
+	if parent == nil {
+		return nil, nil, nil, nil, fmt.Errorf("unknown parent %s", parentHash)
+	}
+	timestamp, randao, err := r.slotAttributes(slot, parentHash)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	feeRecipient := common.Address(registration.FeeRecipient)
+	payment := r.bids.Payment.account
+	attributes := &types.PayloadAttributesV1{
+		Timestamp:             timestamp,
+		PrevRandao:            randao,
+		SuggestedFeeRecipient: feeRecipient,
+	}
+	if payment != nil {
+		attributes.SuggestedFeeRecipient = payment.addr
+	}
+	gasLimit := core.CalcGasLimit(parent.GasLimit, registration.GasLimit)
+	payload, err = r.engine.backend.buildPayload(parentHash, attributes, gasLimit, r.txs)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("%w: %v", errBuildFailed, err)
+	}
+	revenue, err = r.engine.mockChain().PayloadValue(payload)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("cannot compute payload value: %v", err)
+	}
+	value = r.bids.Value(revenue)
+
+	if payment != nil {
+		// same block again, now with the payment to the proposer at the end
+		payload, err = r.engine.backend.buildPayload(parentHash, attributes, gasLimit, paymentTxsCreator(r.txs, payment, feeRecipient, value))
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("%w: cannot pay proposer: %v", errBuildFailed, err)
+		}
+	}
+	return payload, nil, revenue, value, nil
+}
+
+// paymentTxsCreator creates the transactions of txsCreator, followed by a transfer of value from the payment
+// account to the fee recipient. The payment only pays the base fee, there is no tip.
+func paymentTxsCreator(txsCreator TransactionsCreator, payment *TestAccount, feeRecipient common.Address, value *big.Int) TransactionsCreator {
+	return TransactionsCreator{[]TestAccount{*payment}, func(config *params.ChainConfig, bc core.ChainContext,
+		statedb *state.StateDB, header *ethTypes.Header, cfg vm.Config, accounts []TestAccount) ([]*ethTypes.Transaction, error) {
+		txs, err := txsCreator.Create(config, bc, statedb, header, cfg)
+		if err != nil {
+			return nil, err
+		}
+		signer := ethTypes.NewLondonSigner(config.ChainID)
+		// the transactions are not applied yet, the payment comes after those sent from the same account
+		nonce := statedb.GetNonce(accounts[0].addr)
+		for _, tx := range txs {
+			if from, err := ethTypes.Sender(signer, tx); err == nil && from == accounts[0].addr {
+				nonce++
+			}
+		}
+		tx, err := ethTypes.SignNewTx(accounts[0].pk, signer, &ethTypes.DynamicFeeTx{
+			ChainID:   config.ChainID,
+			Nonce:     nonce,
+			To:        &feeRecipient,
+			Value:     value,
+			Gas:       params.TxGas,
+			GasFeeCap: header.BaseFee,
+			GasTipCap: new(big.Int),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot sign payment transaction: %v", err)
+		}
+		return append(txs, tx), nil
+	}}
+}
@@ -3,24 +3,30 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"mergemock/api"
 	"mergemock/types"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/prysmaticlabs/prysm/crypto/bls"
-	"github.com/prysmaticlabs/prysm/runtime/version"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
@@ -30,14 +36,24 @@ type testRelayBackend struct {
 }
 
 func newTestRelay(t *testing.T) *testRelayBackend {
-	relay, err := NewRelayBackend(logrus.New(), "127.0.0.1:38551", "127.0.0.1:38552", "0x1234000000000000000000000000000000000000000000000000000000000000")
+	cfg := new(RelayCmd)
+	cfg.Default()
+	cfg.Bid.Default()
+	cfg.Txs.Default()
+	cfg.Misbehave.Default()
+	cfg.Validators.Default()
+	cfg.Validators.Count = 8
+	cfg.EngineListenAddr = "127.0.0.1:38551"
+	cfg.EngineListenAddrWs = "127.0.0.1:38552"
+	cfg.GenesisValidatorsRoot = "0x1234000000000000000000000000000000000000000000000000000000000000"
+	relay, err := NewRelayBackend(logrus.New(), cfg)
 	if err != nil {
-		t.Fatal("unable to create relay")
+		t.Fatalf("unable to create relay: %v", err)
 	}
 
 	testRelay := testRelayBackend{relay}
 	testRelay.engine.JwtSecretPath = newJwt(t)
-	testRelay.engine.GenesisPath = newGenesis(t)
+	testRelay.engine.GenesisPath = newGenesis(t, common.Address{})
 	return &testRelay
 }
 
@@ -67,6 +83,12 @@ func newKeypair(t *testing.T) (pubkey []byte, privkey bls.SecretKey) {
 	return sk.PublicKey().Marshal(), sk
 }
 
+// proposerKeypair returns the keys of a validator of the simulated validator set, which the relay knows the index of.
+func proposerKeypair(relay *testRelayBackend, index uint64) (pubkey []byte, privkey bls.SecretKey) {
+	v := relay.validators.ByIndex(index)
+	return v.Pubkey[:], v.sk
+}
+
 func newJwt(t *testing.T) string {
 	path := fmt.Sprintf("%s/jwt.hex", t.TempDir())
 	jwt := []byte("ed6588309287e7dbbb0ca2ba8c8be6e6063a72dc0f2235999ee6a751e8459cbc")
@@ -76,9 +98,12 @@ func newJwt(t *testing.T) string {
 	return path
 }
 
-func newGenesis(t *testing.T) string {
+func newGenesis(t *testing.T, faucet common.Address, funded ...common.Address) string {
 	path := fmt.Sprintf("%s/genesis.json", t.TempDir())
-	genesis := core.DeveloperGenesisBlock(5, 30_000_000, common.Address{})
+	genesis := core.DeveloperGenesisBlock(5, 30_000_000, faucet)
+	for _, addr := range funded {
+		genesis.Alloc[addr] = genesis.Alloc[faucet]
+	}
 	genesis.Config.MergeForkBlock = common.Big0
 	genesis.Config.TerminalTotalDifficulty = common.Big0
 	buf, err := genesis.MarshalJSON()
@@ -91,10 +116,115 @@ func newGenesis(t *testing.T) string {
 	return path
 }
 
+// prepareParent has the relay engine prepare a payload on its head, as the consensus client would before the proposer
+// asks for a header, and returns the head hash.
+func prepareParent(t *testing.T, relay *testRelayBackend) common.Hash {
+	parent := relay.engine.mockChain().CurrentHeader()
+	parentHash := parent.Hash()
+	_, err := relay.engine.backend.ForkchoiceUpdatedV1(
+		context.Background(),
+		&types.ForkchoiceStateV1{
+			HeadBlockHash:      parentHash,
+			SafeBlockHash:      parentHash,
+			FinalizedBlockHash: parentHash,
+		},
+		&types.PayloadAttributesV1{
+			Timestamp:             parent.Time + 1,
+			PrevRandao:            common.Hash{0x01},
+			SuggestedFeeRecipient: common.Address{0x02},
+		},
+	)
+	require.NoError(t, err, "unable to initialize engine")
+	return parentHash
+}
+
 func TestStatusEndpoint(t *testing.T) {
 	relay := newTestRelay(t)
 	rr := relay.testRequest(t, "GET", "/eth/v1/builder/status", nil)
-	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, errEngineNotRunning.Error()+"\n", rr.Body.String())
+
+	relay.engine.Run(context.Background())
+	rr = relay.testRequest(t, "GET", "/eth/v1/builder/status", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	_, sk := newKeypair(t)
+	relay.registerValidator(t, sk)
+	rr = relay.testRequest(t, "GET", "/mock/v1/status", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	status := new(RelayStatus)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), status))
+	head := relay.engine.mockChain().CurrentHeader().Hash()
+	require.True(t, status.Ready)
+	require.Equal(t, "embedded", status.Engine)
+	require.Equal(t, &head, status.HeadHash)
+	require.Equal(t, 1, status.Registrations)
+	require.Equal(t, 0, status.Bids)
+
+	// Upstream engine that cannot be reached
+	require.NoError(t, relay.connectUpstream(context.Background(), "http://127.0.0.1:1", relay.engine.JwtSecretPath))
+	rr = relay.testRequest(t, "GET", "/eth/v1/builder/status", nil)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	rr = relay.testRequest(t, "GET", "/mock/v1/status", nil)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	status = new(RelayStatus)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), status))
+	require.False(t, status.Ready)
+	require.Equal(t, "http://127.0.0.1:1", status.Engine)
+	require.NotEmpty(t, status.Error)
+}
+
+func TestRelaySecretKey(t *testing.T) {
+	sk, err := bls.RandKey()
+	require.NoError(t, err)
+	path := t.TempDir() + "/relay.key"
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("0x%x\n", sk.Marshal())), 0600))
+
+	cfg := new(RelayCmd)
+	cfg.Default()
+	cfg.Validators.Default()
+	cfg.SecretKeyPath = path
+	relay, err := NewRelayBackend(logrus.New(), cfg)
+	require.NoError(t, err)
+	require.Equal(t, sk.PublicKey().Marshal(), relay.pk[:])
+
+	cfg.SecretKeyPath, cfg.SecretKey = "", fmt.Sprintf("%x", sk.Marshal())
+	relay, err = NewRelayBackend(logrus.New(), cfg)
+	require.NoError(t, err)
+	require.Equal(t, sk.PublicKey().Marshal(), relay.pk[:])
+
+	cfg.SecretKeyPath = path
+	_, err = NewRelayBackend(logrus.New(), cfg)
+	require.Error(t, err)
+}
+
+func newRegistration(t *testing.T, sk bls.SecretKey, timestamp uint64) *types.SignedValidatorRegistration {
+	return newRegistrationWithGasLimit(t, sk, timestamp, 15_000_000)
+}
+
+func newRegistrationWithGasLimit(t *testing.T, sk bls.SecretKey, timestamp uint64, gasLimit uint64) *types.SignedValidatorRegistration {
+	var pubkey types.PublicKey
+	pubkey.FromSlice(sk.PublicKey().Marshal())
+	msg := &types.RegisterValidatorRequestMessage{
+		FeeRecipient: types.Address{0x42},
+		GasLimit:     gasLimit,
+		Timestamp:    timestamp,
+		Pubkey:       pubkey,
+	}
+	return signRegistration(t, sk, msg)
+}
+
+func signRegistration(t *testing.T, sk bls.SecretKey, msg *types.RegisterValidatorRequestMessage) *types.SignedValidatorRegistration {
+	root, err := types.ComputeSigningRoot(msg, types.DomainBuilder)
+	require.NoError(t, err)
+	var signature types.Signature
+	signature.FromSlice(sk.Sign(root[:]).Marshal())
+	return &types.SignedValidatorRegistration{Message: msg, Signature: signature}
+}
+
+func (mr *testRelayBackend) registerValidator(t *testing.T, sk bls.SecretKey) {
+	rr := mr.testRequest(t, "POST", "/eth/v1/builder/validators", []*types.SignedValidatorRegistration{newRegistration(t, sk, uint64(time.Now().Unix()))})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 }
 
 func TestValidatorRegistration(t *testing.T) {
@@ -120,93 +250,764 @@ func TestValidatorRegistration(t *testing.T) {
 	signature.FromSlice(sig)
 	require.Equal(t, sig[:], signature[:])
 
-	rr := relay.testRequest(t, "POST", "/eth/v1/builder/validators", types.SignedValidatorRegistration{
+	rr := relay.testRequest(t, "POST", "/eth/v1/builder/validators", []types.SignedValidatorRegistration{{
 		Message:   msg,
 		Signature: signature,
-	})
+	}})
 	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, msg, relay.registry.Get(pubkey).Message)
 
 	// Invalid signature
 	signature[len(signature)-1] = 0x00
-	rr = relay.testRequest(t, "POST", "/eth/v1/builder/validators", types.SignedValidatorRegistration{
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/validators", []types.SignedValidatorRegistration{{
 		Message:   msg,
 		Signature: signature,
-	})
+	}})
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	require.Equal(t, errInvalidSignature.Error()+"\n", rr.Body.String())
+
+	// Single object instead of an array
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/validators", newRegistration(t, sk, msg.Timestamp))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestValidatorRegistrationTimestamps(t *testing.T) {
+	relay := newTestRelay(t)
+	_, sk1 := newKeypair(t)
+	_, sk2 := newKeypair(t)
+	now := uint64(time.Now().Unix())
+
+	// Batch registration
+	rr := relay.testRequest(t, "POST", "/eth/v1/builder/validators", []*types.SignedValidatorRegistration{
+		newRegistration(t, sk1, now-10),
+		newRegistration(t, sk2, now-10),
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, 2, relay.registry.Len())
+
+	// Re-sending the same registration is fine
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/validators", []*types.SignedValidatorRegistration{newRegistration(t, sk1, now-10)})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Stale registration, the whole batch is rejected
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/validators", []*types.SignedValidatorRegistration{
+		newRegistration(t, sk1, now),
+		newRegistration(t, sk2, now-20),
+	})
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errStaleRegistration.Error()+"\n", rr.Body.String())
+	var pubkey types.PublicKey
+	pubkey.FromSlice(sk1.PublicKey().Marshal())
+	require.Equal(t, now-10, relay.registry.Get(pubkey).Message.Timestamp)
+
+	// Future registration
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/validators", []*types.SignedValidatorRegistration{newRegistration(t, sk1, now+3600)})
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errFutureRegistration.Error()+"\n", rr.Body.String())
+
+	// Newer registration replaces the known one
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/validators", []*types.SignedValidatorRegistration{newRegistration(t, sk1, now)})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, now, relay.registry.Get(pubkey).Message.Timestamp)
+}
+
+func TestValidatorRegistryPersistence(t *testing.T) {
+	path := fmt.Sprintf("%s/registrations.json", t.TempDir())
+	registry, err := NewValidatorRegistry(path)
+	require.NoError(t, err)
+	_, sk := newKeypair(t)
+	reg := newRegistration(t, sk, uint64(time.Now().Unix()))
+	require.NoError(t, registry.Update([]*types.SignedValidatorRegistration{reg}, time.Now()))
+
+	reloaded, err := NewValidatorRegistry(path)
+	require.NoError(t, err)
+	require.Equal(t, reg, reloaded.Get(reg.Message.Pubkey))
+}
+
+func TestBuilderRegisterValidators(t *testing.T) {
+	relay := newTestRelay(t)
+	srv := httptest.NewServer(relay.getRouter())
+	defer srv.Close()
+
+	cfg := &ValidatorsConfig{}
+	cfg.Default()
+	cfg.Count = 2
+	validators, err := NewValidatorSet(cfg, 32, types.Root{})
+	require.NoError(t, err)
+
+	registrations := make([]*types.SignedValidatorRegistration, 0, validators.Len())
+	for _, v := range validators.Validators() {
+		registration, err := v.Registration(uint64(time.Now().Unix()), types.DomainBuilder)
+		require.NoError(t, err)
+		registrations = append(registrations, registration)
+	}
+	err = api.BuilderRegisterValidators(context.Background(), logrus.New(), srv.URL, registrations, false)
+	require.NoError(t, err)
+
+	// Tampered registration is rejected
+	registrations[1].Message.GasLimit++
+	err = api.BuilderRegisterValidators(context.Background(), logrus.New(), srv.URL, registrations, false)
+	require.Error(t, err)
 }
 
 func TestGetHeader(t *testing.T) {
 	ctx := context.Background()
 	relay := newTestRelay(t)
 	relay.engine.Run(ctx)
-	pk, _ := newKeypair(t)
+	pk, sk := newKeypair(t)
+	relay.registerValidator(t, sk)
 	parent := relay.engine.mockChain().CurrentHeader()
-	parentHash := parent.Hash()
-
-	// Initialize engine
-	_, err := relay.engine.backend.ForkchoiceUpdatedV1(
-		ctx,
-		&types.ForkchoiceStateV1{
-			HeadBlockHash:      parentHash,
-			SafeBlockHash:      parentHash,
-			FinalizedBlockHash: parentHash,
-		},
-		&types.PayloadAttributesV1{
-			Timestamp:             parent.Time + 1,
-			PrevRandao:            common.Hash{0x01},
-			SuggestedFeeRecipient: common.Address{0x02},
-		},
-	)
-	require.NoError(t, err, "unable to initialize engine")
+	parentHash := prepareParent(t, relay)
 
-	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 0, parentHash.Hex(), pk)
+	// Unregistered validator
+	unknown, _ := newKeypair(t)
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 0, parentHash.Hex(), unknown)
 	rr := relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errUnknownValidator.Error()+"\n", rr.Body.String())
+
+	path = fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 0, parentHash.Hex(), pk)
+	rr = relay.testRequest(t, "GET", path, nil)
 	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
 
 	bid := new(types.GetHeaderResponse)
-	err = json.Unmarshal(rr.Body.Bytes(), bid)
-	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
 
 	require.Equal(t, parentHash[:], bid.Data.Message.Header.ParentHash[:], "didn't build on expected parent")
+	require.Equal(t, types.Address{0x42}, bid.Data.Message.Header.FeeRecipient, "registered fee recipient not used")
+	require.Equal(t, core.CalcGasLimit(parent.GasLimit, 15_000_000), bid.Data.Message.Header.GasLimit, "gas limit didn't move towards registered gas limit")
+	require.NotEqual(t, parent.GasLimit, bid.Data.Message.Header.GasLimit)
 	ok, err := types.VerifySignature(bid.Data.Message, types.DomainBuilder, relay.pk[:], bid.Data.Signature[:])
 	require.NoError(t, err, "error verifying signature")
 	require.True(t, ok, "bid signature not valid")
 
-	require.Equal(t, pk, relay.latestPubkey[:])
+	// The same bid is given again for the same request
+	var pubkey types.PublicKey
+	pubkey.FromSlice(pk)
+	_, ok = relay.bidCache.Get(bidKey{Slot: 0, ParentHash: parentHash, Pubkey: pubkey})
+	require.True(t, ok)
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	again := new(types.GetHeaderResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), again))
+	require.Equal(t, bid.Data, again.Data)
 }
 
-func TestGetPayload(t *testing.T) {
+func TestGetHeaderSlotAttributes(t *testing.T) {
 	ctx := context.Background()
 	relay := newTestRelay(t)
 	relay.engine.Run(ctx)
 	pk, sk := newKeypair(t)
+	relay.registerValidator(t, sk)
 	parent := relay.engine.mockChain().CurrentHeader()
-	parentHash := parent.Hash()
+	parentHash := prepareParent(t, relay)
+	relay.beaconGenesisTime = parent.Time + 1
 
-	// Initialize engine
-	_, err := relay.engine.backend.ForkchoiceUpdatedV1(
-		ctx,
-		&types.ForkchoiceStateV1{
-			HeadBlockHash:      parentHash,
-			SafeBlockHash:      parentHash,
-			FinalizedBlockHash: parentHash,
+	// The consensus client prepared the payload for slot 0
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 0, parentHash.Hex(), pk)
+	rr := relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	bid := new(types.GetHeaderResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	require.Equal(t, parent.Time+1, bid.Data.Message.Header.Timestamp)
+	require.Equal(t, types.Hash{0x01}, bid.Data.Message.Header.Random)
+
+	// Its attributes are not those of slot 1
+	path = fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, parentHash.Hex(), pk)
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), errAttributesSlot.Error())
+
+	// The payload attributes event of the slot gives its randao
+	timestamp := relay.beaconGenesisTime + uint64(relay.slotTime.Seconds())
+	event := &payloadAttributesEventData{ProposalSlot: 1, ParentBlockHash: parentHash}
+	event.PayloadAttributes.Timestamp = timestamp
+	event.PayloadAttributes.PrevRandao = common.Hash{0x0b}
+	relay.events.add(event)
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	require.Equal(t, timestamp, bid.Data.Message.Header.Timestamp)
+	require.Equal(t, types.Hash{0x0b}, bid.Data.Message.Header.Random)
+}
+
+func TestGetHeaderValue(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	require.Empty(t, relay.txs.accounts, "no transaction mix by default")
+	cfg := &BuilderTxsConfig{}
+	cfg.Default()
+	require.NoError(t, cfg.Accounts.Set(common.Bytes2Hex(crypto.FromECDSA(key))))
+	relay.txs = txMixCreator(cfg)
+	relay.engine.GenesisPath = newGenesis(t, crypto.PubkeyToAddress(key.PublicKey))
+	relay.engine.Run(ctx)
+	pk, sk := newKeypair(t)
+	relay.registerValidator(t, sk)
+	parentHash := prepareParent(t, relay)
+
+	// The true value of the bid is what the transaction mix tips the fee recipient
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 0, parentHash.Hex(), pk)
+	rr := relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	bid := new(types.GetHeaderResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	value := new(big.Int).SetBytes(bid.Data.Message.Value[:])
+	require.Equal(t, 1, value.Sign(), "bid has no value")
+
+	var pubkey types.PublicKey
+	pubkey.FromSlice(pk)
+	cached, ok := relay.bidCache.Get(bidKey{Slot: 0, ParentHash: parentHash, Pubkey: pubkey})
+	require.True(t, ok)
+	payload := cached.(*relayBid).payload
+	require.Len(t, payload.Transactions, int(cfg.Count))
+	paid, err := relay.engine.mockChain().PaymentValue(payload, common.Address{0x42})
+	require.NoError(t, err)
+	require.Equal(t, paid, value)
+	tips := new(big.Int).Mul(big.NewInt(params.GWei), new(big.Int).SetUint64(cfg.Count*params.TxGas))
+	require.Equal(t, tips, value)
+}
+
+func TestGetHeaderValueFeeRecipientSends(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	cfg := &BuilderTxsConfig{}
+	cfg.Default()
+	require.NoError(t, cfg.Accounts.Set(common.Bytes2Hex(crypto.FromECDSA(key))))
+	relay.txs = txMixCreator(cfg)
+	relay.engine.GenesisPath = newGenesis(t, addr)
+	relay.engine.Run(ctx)
+	pk, sk := newKeypair(t)
+	var pubkey types.PublicKey
+	pubkey.FromSlice(pk)
+	registration := signRegistration(t, sk, &types.RegisterValidatorRequestMessage{
+		FeeRecipient: types.Address(addr),
+		GasLimit:     15_000_000,
+		Timestamp:    uint64(time.Now().Unix()),
+		Pubkey:       pubkey,
+	})
+	require.NoError(t, relay.registry.Update([]*types.SignedValidatorRegistration{registration}, time.Now()))
+	parentHash := prepareParent(t, relay)
+
+	// The fee recipient sends the transaction mix itself: its balance drops by the base fees it pays,
+	// but the value of the block to it is still the tips
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 0, parentHash.Hex(), pk)
+	rr := relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	bid := new(types.GetHeaderResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	value := new(big.Int).SetBytes(bid.Data.Message.Value[:])
+	tips := new(big.Int).Mul(big.NewInt(params.GWei), new(big.Int).SetUint64(cfg.Count*params.TxGas))
+	require.Equal(t, tips, value)
+
+	cached, ok := relay.bidCache.Get(bidKey{Slot: 0, ParentHash: parentHash, Pubkey: pubkey})
+	require.True(t, ok)
+	payload := cached.(*relayBid).payload
+	require.Len(t, payload.Transactions, int(cfg.Count))
+	balance, err := relay.engine.mockChain().PaymentValue(payload, addr)
+	require.NoError(t, err)
+	require.Equal(t, -1, balance.Sign())
+}
+
+func TestGetHeaderPayment(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	paymentKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	require.NoError(t, relay.bids.Payment.Set(fmt.Sprintf("%x", crypto.FromECDSA(paymentKey))))
+	relay.bids.Strategy = BidStrategyMarkup
+	paymentAddr := crypto.PubkeyToAddress(paymentKey.PublicKey)
+	mixKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	cfg := &BuilderTxsConfig{}
+	cfg.Default()
+	require.NoError(t, cfg.Accounts.Set(common.Bytes2Hex(crypto.FromECDSA(mixKey))))
+	relay.txs = txMixCreator(cfg)
+	relay.engine.GenesisPath = newGenesis(t, paymentAddr, crypto.PubkeyToAddress(mixKey.PublicKey))
+	relay.engine.Run(ctx)
+	pk, sk := newKeypair(t)
+	relay.registerValidator(t, sk)
+	parentHash := prepareParent(t, relay)
+
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 0, parentHash.Hex(), pk)
+	rr := relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	bid := new(types.GetHeaderResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	header := bid.Data.Message.Header
+	require.Equal(t, types.Address(paymentAddr), header.FeeRecipient, "relay is not the coinbase")
+	value := new(big.Int).SetBytes(bid.Data.Message.Value[:])
+	tips := new(big.Int).Mul(big.NewInt(params.GWei), new(big.Int).SetUint64(cfg.Count*params.TxGas))
+	require.Equal(t, new(big.Int).Add(tips, etherToWei(relay.bids.Markup)), value, "bid is not the tips of the mix plus the markup")
+
+	// The last transaction pays the bid to the registered fee recipient
+	var pubkey types.PublicKey
+	pubkey.FromSlice(pk)
+	cached, ok := relay.bidCache.Get(bidKey{Slot: 0, ParentHash: parentHash, Pubkey: pubkey})
+	require.True(t, ok)
+	payload := cached.(*relayBid).payload
+	require.Len(t, payload.Transactions, int(cfg.Count)+1)
+	var tx ethTypes.Transaction
+	require.NoError(t, tx.UnmarshalBinary(payload.Transactions[len(payload.Transactions)-1]))
+	require.Equal(t, common.Address{0x42}, *tx.To())
+	require.Equal(t, value, tx.Value())
+	paid, err := relay.engine.mockChain().PaymentValue(payload, common.Address{0x42})
+	require.NoError(t, err)
+	require.Equal(t, value, paid)
+
+	// A payment key that cannot sign fails the request instead of the relay
+	relay.bids.Payment.account = &TestAccount{&ecdsa.PrivateKey{PublicKey: paymentKey.PublicKey, D: new(big.Int)}, paymentAddr}
+	path = fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, parentHash.Hex(), pk)
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusInternalServerError, rr.Code, rr.Body.String())
+	require.Contains(t, rr.Body.String(), "cannot sign payment transaction")
+}
+
+func TestBuilderGetHeaderRelayPubkey(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	relay.engine.Run(ctx)
+	srv := httptest.NewServer(relay.getRouter())
+	defer srv.Close()
+	pk, sk := newKeypair(t)
+	relay.registerValidator(t, sk)
+	parentHash := prepareParent(t, relay)
+
+	// Pinned to the relay key
+	entry, err := api.ParseRelayEntry(strings.Replace(srv.URL, "http://", fmt.Sprintf("http://%s@", relay.pk), 1))
+	require.NoError(t, err)
+	require.Equal(t, srv.URL, entry.Address)
+	require.Equal(t, relay.pk, *entry.Pubkey)
+	bid, err := api.BuilderGetHeader(ctx, logrus.New(), entry.Address, &relay.forks, relay.builderDomain, 0, parentHash, pk, entry.Pubkey, false)
+	require.NoError(t, err)
+	require.Equal(t, relay.pk, bid.Pubkey())
+
+	// Pinned to another key
+	_, err = api.BuilderGetHeader(ctx, logrus.New(), entry.Address, &relay.forks, relay.builderDomain, 0, parentHash, pk, &types.PublicKey{0x01}, false)
+	require.Error(t, err)
+}
+
+func TestBuilderSSZ(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	relay.engine.Run(ctx)
+	srv := httptest.NewServer(relay.getRouter())
+	defer srv.Close()
+	pk, sk := proposerKeypair(relay, 2)
+	registration := newRegistration(t, sk, uint64(time.Now().Unix()))
+	err := api.BuilderRegisterValidators(ctx, logrus.New(), srv.URL, []*types.SignedValidatorRegistration{registration}, true)
+	require.NoError(t, err)
+	require.Equal(t, registration, relay.registry.Get(registration.Message.Pubkey))
+
+	parentHash := prepareParent(t, relay)
+
+	// SSZ and JSON give the same bid
+	bid, err := api.BuilderGetHeader(ctx, logrus.New(), srv.URL, &relay.forks, relay.builderDomain, 1, parentHash, pk, nil, true)
+	require.NoError(t, err)
+	jsonBid, err := api.BuilderGetHeader(ctx, logrus.New(), srv.URL, &relay.forks, relay.builderDomain, 1, parentHash, pk, nil, false)
+	require.NoError(t, err)
+	require.Equal(t, jsonBid, bid)
+
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, parentHash.Hex(), pk)
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Accept", "application/json;q=0.5, application/octet-stream")
+	rr := httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, api.MediaTypeSSZ, rr.Header().Get("Content-Type"))
+	require.Equal(t, types.VersionBellatrix, rr.Header().Get(api.HeaderConsensusVersion))
+
+	msg := &types.BlindedBeaconBlock{
+		Slot:          1,
+		ProposerIndex: 2,
+		Body: &types.BlindedBeaconBlockBody{
+			Eth1Data:               &types.Eth1Data{},
+			SyncAggregate:          &types.SyncAggregate{},
+			ExecutionPayloadHeader: bid.Bellatrix.Message.Header,
 		},
-		&types.PayloadAttributesV1{
-			Timestamp:             parent.Time + 1,
-			PrevRandao:            common.Hash{0x01},
-			SuggestedFeeRecipient: common.Address{0x02},
+	}
+	signed := &types.VersionedSignedBlindedBeaconBlock{Version: types.VersionBellatrix, Bellatrix: signBlindedBlock(t, relay, sk, msg)}
+
+	// Unsupported request encoding
+	body, err := json.Marshal(signed)
+	require.NoError(t, err)
+	req = httptest.NewRequest("POST", "/eth/v1/builder/blinded_blocks", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	rr = httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+
+	payload, err := api.BuilderGetPayload(ctx, logrus.New(), sk, srv.URL, signed, true)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash(bid.BlockHash()), payload.BlockHash)
+	require.Equal(t, common.Hash(bid.ParentHash()), payload.ParentHash)
+}
+
+func TestBuilderForks(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	relay.forks.CapellaEpoch, relay.forks.DenebEpoch = 1, 2
+	relay.engine.Run(ctx)
+	srv := httptest.NewServer(relay.getRouter())
+	defer srv.Close()
+	pk, sk := proposerKeypair(relay, 2)
+	relay.registerValidator(t, sk)
+	proposer := relay.validators.ByIndex(2)
+	embeddedParent := prepareParent(t, relay)
+
+	// Capella and Deneb payloads are built upstream
+	parentHash := common.Hash{0x0a}
+	upstream, _ := newTestForkUpstream(t, parentHash)
+	relay.upstreamBuildTime = 10 * time.Millisecond
+	require.NoError(t, relay.connectUpstream(ctx, upstream.URL, relay.engine.JwtSecretPath))
+	registration := newRegistrationWithGasLimit(t, sk, uint64(time.Now().Unix())+1, 30_000_000)
+	require.NoError(t, relay.registry.Update([]*types.SignedValidatorRegistration{registration}, time.Now()))
+	root := types.Root{0x0e}
+	for _, tc := range []struct {
+		slot    uint64
+		version string
+		useSSZ  bool
+	}{
+		{31, types.VersionBellatrix, false},
+		{32, types.VersionCapella, false},
+		{33, types.VersionCapella, true},
+		{64, types.VersionDeneb, false},
+		{65, types.VersionDeneb, true},
+	} {
+		event := &payloadAttributesEventData{ProposalSlot: tc.slot, ParentBlockHash: parentHash}
+		event.PayloadAttributes.Withdrawals = []*types.Withdrawal{{Index: tc.slot, Amount: 1}}
+		event.PayloadAttributes.ParentBeaconBlockRoot = &root
+		relay.events.add(event)
+		bid, err := api.BuilderGetHeader(ctx, logrus.New(), srv.URL, &relay.forks, relay.builderDomain, tc.slot, parentHash, pk, nil, tc.useSSZ)
+		require.NoError(t, err, tc.version)
+		require.Equal(t, tc.version, bid.Version)
+		require.Equal(t, types.Hash(parentHash), bid.ParentHash())
+
+		signed, err := signBlindedBlockForBid(proposer, tc.slot, bid, relay.network, &relay.genesisValidatorsRoot)
+		require.NoError(t, err)
+		payload, err := api.BuilderGetVersionedPayload(ctx, logrus.New(), srv.URL, signed, tc.useSSZ)
+		require.NoError(t, err, tc.version)
+		require.Equal(t, tc.version, payload.Version)
+		require.Equal(t, bid.BlockHash(), payload.BlockHash())
+		if tc.version == types.VersionDeneb {
+			require.Len(t, payload.Deneb.BlobsBundle.Blobs, 1)
+		}
+	}
+
+	// A bid is only accepted for the fork of the slot
+	forks := relay.forks
+	forks.DenebEpoch = math.MaxUint64
+	_, err := api.BuilderGetHeader(ctx, logrus.New(), srv.URL, &forks, relay.builderDomain, 66, parentHash, pk, nil, false)
+	require.Error(t, err)
+
+	// The embedded engine builds Bellatrix payloads only
+	relay.upstream = nil
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 66, embeddedParent.Hex(), pk)
+	rr := relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), errEmbeddedFork.Error())
+}
+
+func TestMisbehave(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	relay.engine.Run(ctx)
+	srv := httptest.NewServer(relay.getRouter())
+	defer srv.Close()
+	pk, sk := proposerKeypair(relay, 2)
+	relay.registerValidator(t, sk)
+	parentHash := prepareParent(t, relay)
+
+	getHeader := func(freq *float64) (*types.VersionedSignedBuilderBid, error) {
+		*freq = 1
+		defer func() { *freq = 0 }()
+		return api.BuilderGetHeader(ctx, logrus.New(), srv.URL, &relay.forks, relay.builderDomain, 1, parentHash, pk, nil, false)
+	}
+	m := relay.misbehave
+	_, err := getHeader(&m.NoBid)
+	require.ErrorIs(t, err, api.ErrNoBid)
+	_, err = getHeader(&m.BadVersion)
+	require.Error(t, err)
+	_, err = getHeader(&m.WrongKey)
+	require.Error(t, err)
+	_, err = getHeader(&m.WrongDomain)
+	require.Error(t, err)
+	bid, err := getHeader(&m.WrongParent)
+	require.NoError(t, err)
+	require.NotEqual(t, types.Hash(parentHash), bid.ParentHash())
+
+	m.Slow, m.SlowDelay = 1, time.Second
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err = api.BuilderGetHeader(timeoutCtx, logrus.New(), srv.URL, &relay.forks, relay.builderDomain, 1, parentHash, pk, nil, false)
+	cancel()
+	require.Error(t, err)
+	m.Slow = 0
+
+	// The honest bid is still served
+	bid, err = api.BuilderGetHeader(ctx, logrus.New(), srv.URL, &relay.forks, relay.builderDomain, 1, parentHash, pk, nil, false)
+	require.NoError(t, err)
+	require.Equal(t, types.Hash(parentHash), bid.ParentHash())
+
+	signed := &types.VersionedSignedBlindedBeaconBlock{Version: types.VersionBellatrix, Bellatrix: signBlindedBlock(t, relay, sk, &types.BlindedBeaconBlock{
+		Slot:          1,
+		ProposerIndex: 2,
+		Body: &types.BlindedBeaconBlockBody{
+			Eth1Data:               &types.Eth1Data{},
+			SyncAggregate:          &types.SyncAggregate{},
+			ExecutionPayloadHeader: bid.Bellatrix.Message.Header,
 		},
-	)
-	require.NoError(t, err, "unable to initialize engine")
+	})}
+	m.WithholdPayload = 1
+	_, err = api.BuilderGetPayload(ctx, logrus.New(), sk, srv.URL, signed, false)
+	require.Error(t, err)
+	m.WithholdPayload = 0
+	require.Empty(t, relay.data.Delivered(&TraceFilter{}))
+
+	m.WrongPayload = 1
+	payload, err := api.BuilderGetPayload(ctx, logrus.New(), sk, srv.URL, signed, false)
+	require.NoError(t, err)
+	require.NotEqual(t, common.Hash(bid.BlockHash()), payload.BlockHash)
+	m.WrongPayload = 0
+	require.Len(t, relay.data.Delivered(&TraceFilter{}), 1)
+
+	payload, err = api.BuilderGetPayload(ctx, logrus.New(), sk, srv.URL, signed, false)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash(bid.BlockHash()), payload.BlockHash)
+
+	m.NoBid = 2
+	require.Error(t, m.Validate())
+}
+
+func TestUpstreamEngine(t *testing.T) {
+	ctx := context.Background()
+	upstream := newTestRelay(t)
+	// Ports of its own, the embedded engines of other tests keep listening
+	upstream.engine.ListenAddr = "127.0.0.1:38561"
+	upstream.engine.WebsocketAddr = "127.0.0.1:38562"
+	upstream.engine.Run(ctx)
+	genesis := upstream.engine.mockChain().CurrentHeader()
+
+	cfg := new(RelayCmd)
+	cfg.Default()
+	cfg.Bid.Default()
+	cfg.Misbehave.Default()
+	cfg.Validators.Default()
+	cfg.JwtSecretPath = upstream.engine.JwtSecretPath
+	cfg.UpstreamBuildTime = 10 * time.Millisecond
+	cfg.CapellaForkEpoch = 1
+	relay, err := NewRelayBackend(logrus.New(), cfg)
+	require.NoError(t, err)
+	relay.bids.Payment.account = &TestAccount{}
+	require.ErrorIs(t, relay.connectUpstream(ctx, "http://"+upstream.engine.ListenAddr, cfg.JwtSecretPath), errUpstreamPayment)
+	relay.bids.Payment.account = nil
+	require.NoError(t, relay.connectUpstream(ctx, "http://"+upstream.engine.ListenAddr, cfg.JwtSecretPath))
+	require.Eventually(t, func() bool {
+		var head *ethTypes.Header
+		return relay.upstream.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false) == nil
+	}, 5*time.Second, 50*time.Millisecond, "upstream engine not reachable")
+	rr := httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/v1/builder/status", nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	pk, sk := newKeypair(t)
+	registration := newRegistration(t, sk, uint64(time.Now().Unix()))
+	require.NoError(t, relay.registry.Update([]*types.SignedValidatorRegistration{registration}, time.Now()))
+
+	// The randao is unknown without a payload attributes event
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, genesis.Hash().Hex(), pk)
+	rr = httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errNoAttributes.Error()+"\n", rr.Body.String())
+
+	event := &payloadAttributesEventData{ProposalSlot: 1, ParentBlockHash: genesis.Hash()}
+	event.PayloadAttributes.Timestamp = genesis.Time + 12
+	event.PayloadAttributes.PrevRandao = common.Hash{0x0a}
+	relay.events.add(event)
+	rr = httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), errUpstreamGasLimit.Error())
+
+	// The embedded engine builds with the gas limit of its genesis
+	registration = newRegistrationWithGasLimit(t, sk, uint64(time.Now().Unix())+1, genesis.GasLimit)
+	require.NoError(t, relay.registry.Update([]*types.SignedValidatorRegistration{registration}, time.Now()))
+	rr = httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	bid := new(types.GetHeaderResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	header := bid.Data.Message.Header
+	require.Equal(t, types.Hash(genesis.Hash()), header.ParentHash)
+	require.Equal(t, registration.Message.FeeRecipient, header.FeeRecipient)
+	require.Equal(t, genesis.Time+12, header.Timestamp)
+	require.Equal(t, types.Hash{0x0a}, header.Random)
+
+	// Unknown parent
+	path = fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, common.Hash{0x01}.Hex(), pk)
+	rr = httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// newTestForkUpstream returns an execution client stand-in for builds on the parent, with a gas limit of 30M.
+// Payloads have the withdrawals of the forkchoice update, and one blob from Deneb. The parameters of the last call
+// of each method are kept.
+func newTestForkUpstream(t *testing.T, parent common.Hash) (*httptest.Server, func(method string) []json.RawMessage) {
+	var mu sync.Mutex
+	calls := make(map[string][]json.RawMessage)
+	var withdrawals []*types.WithdrawalV1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var call struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&call))
+		mu.Lock()
+		defer mu.Unlock()
+		calls[call.Method] = call.Params
+		var result any
+		switch call.Method {
+		case "eth_getBlockByNumber", "eth_getBlockByHash":
+			result = &upstreamBlock{Hash: parent, Time: 1000, GasLimit: 30_000_000}
+		case "engine_forkchoiceUpdatedV1", "engine_forkchoiceUpdatedV2", "engine_forkchoiceUpdatedV3":
+			var attributes types.PayloadAttributesV3
+			require.NoError(t, json.Unmarshal(call.Params[1], &attributes))
+			withdrawals = attributes.Withdrawals
+			id := types.PayloadID{0x01}
+			result = &types.ForkchoiceUpdatedResult{PayloadStatus: types.PayloadStatusV1{Status: types.ExecutionValid}, PayloadID: &id}
+		case "engine_getPayloadV2", "engine_getPayloadV3":
+			blobGasUsed := hexutil.Uint64(1 << 17)
+			res := &types.GetPayloadV3Response{
+				ExecutionPayload: &types.ExecutionPayloadV3{
+					ParentHash:    parent,
+					Number:        1,
+					GasLimit:      30_000_000,
+					Timestamp:     1012,
+					BaseFeePerGas: (*hexutil.Big)(big.NewInt(7)),
+					BlockHash:     common.Hash{0x0b},
+					Transactions:  []hexutil.Bytes{},
+					Withdrawals:   withdrawals,
+				},
+				BlockValue: (*hexutil.Big)(big.NewInt(1)),
+			}
+			if call.Method == "engine_getPayloadV3" {
+				res.ExecutionPayload.BlobGasUsed = &blobGasUsed
+				res.BlobsBundle = &types.BlobsBundleV1{
+					Commitments: []hexutil.Bytes{make([]byte, 48)},
+					Proofs:      []hexutil.Bytes{make([]byte, 48)},
+					Blobs:       []hexutil.Bytes{make([]byte, 131072)},
+				}
+				res.BlobsBundle.Commitments[0][0] = 0xc0
+			}
+			result = res
+		}
+		out, err := json.Marshal(result)
+		require.NoError(t, err)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, call.ID, out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(method string) []json.RawMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[method]
+	}
+}
+
+func TestUpstreamEngineForks(t *testing.T) {
+	ctx := context.Background()
+	parent := common.Hash{0x0a}
+	upstream, calls := newTestForkUpstream(t, parent)
+
+	cfg := new(RelayCmd)
+	cfg.Default()
+	cfg.Bid.Default()
+	cfg.Misbehave.Default()
+	cfg.Validators.Default()
+	cfg.JwtSecretPath = newJwt(t)
+	cfg.UpstreamBuildTime = 10 * time.Millisecond
+	cfg.CapellaForkEpoch = 1
+	cfg.DenebForkEpoch = 2
+	relay, err := NewRelayBackend(logrus.New(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, relay.connectUpstream(ctx, upstream.URL, cfg.JwtSecretPath))
+	pk, sk := newKeypair(t)
+	registration := newRegistrationWithGasLimit(t, sk, uint64(time.Now().Unix()), 30_000_000)
+	require.NoError(t, relay.registry.Update([]*types.SignedValidatorRegistration{registration}, time.Now()))
+
+	withdrawals := []*types.Withdrawal{{Index: 3, ValidatorIndex: 4, Address: types.Address{0x05}, Amount: 6}}
+	root := types.Root{0x0e}
+	for _, tc := range []struct {
+		slot       uint64
+		version    string
+		fcu        string
+		getPayload string
+	}{
+		{32, types.VersionCapella, "engine_forkchoiceUpdatedV2", "engine_getPayloadV2"},
+		{64, types.VersionDeneb, "engine_forkchoiceUpdatedV3", "engine_getPayloadV3"},
+	} {
+		event := &payloadAttributesEventData{ProposalSlot: tc.slot, ParentBlockHash: parent}
+		event.PayloadAttributes.Timestamp = 1012
+		event.PayloadAttributes.Withdrawals = withdrawals
+		event.PayloadAttributes.ParentBeaconBlockRoot = &root
+		relay.events.add(event)
+		path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", tc.slot, parent.Hex(), pk)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		bid := new(types.VersionedSignedBuilderBid)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+		require.Equal(t, tc.version, bid.Version)
+
+		// The attributes carry the withdrawals, and from Deneb the parent beacon block root
+		require.Len(t, calls(tc.fcu), 2, tc.version)
+		require.NotNil(t, calls(tc.getPayload), tc.version)
+		var attributes types.PayloadAttributesV3
+		require.NoError(t, json.Unmarshal(calls(tc.fcu)[1], &attributes))
+		require.Equal(t, types.ToWithdrawalsV1(withdrawals), attributes.Withdrawals)
+		expected, err := types.PayloadToPayloadHeaderCapella(&types.ExecutionPayloadV1{BaseFeePerGas: common.Big0}, &types.PayloadForkFields{Withdrawals: withdrawals})
+		require.NoError(t, err)
+		if tc.version == types.VersionCapella {
+			require.Nil(t, attributes.ParentBeaconBlockRoot)
+			require.Equal(t, expected.WithdrawalsRoot, bid.Capella.Message.Header.WithdrawalsRoot)
+			continue
+		}
+		require.Equal(t, common.Hash(root), *attributes.ParentBeaconBlockRoot)
+		require.Equal(t, expected.WithdrawalsRoot, bid.Deneb.Message.Header.WithdrawalsRoot)
+		require.Equal(t, uint64(1<<17), bid.Deneb.Message.Header.BlobGasUsed)
+		require.Len(t, bid.Deneb.Message.BlobKzgCommitments, 1)
+		require.Equal(t, byte(0xc0), bid.Deneb.Message.BlobKzgCommitments[0][0])
+	}
+
+	// Deneb builds need the parent beacon block root
+	event := &payloadAttributesEventData{ProposalSlot: 65, ParentBlockHash: parent}
+	relay.events.add(event)
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 65, parent.Hex(), pk)
+	rr := httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), errNoParentBeaconRoot.Error())
+}
+
+func TestGetPayload(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	relay.engine.Run(ctx)
+	pk, sk := proposerKeypair(relay, 2)
+	relay.registerValidator(t, sk)
+	parentHash := prepareParent(t, relay)
 
 	// Call getHeader to prepare payload
-	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 0, parentHash.Hex(), pk)
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 1, parentHash.Hex(), pk)
 	rr := relay.testRequest(t, "GET", path, nil)
 	require.Equal(t, http.StatusOK, rr.Code)
 	bid := new(types.GetHeaderResponse)
-	err = json.Unmarshal(rr.Body.Bytes(), bid)
-	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
 
 	// Create request payload
 	msg := &types.BlindedBeaconBlock{
@@ -229,7 +1030,7 @@ func TestGetPayload(t *testing.T) {
 	}
 
 	// Sign payload
-	root, err := types.ComputeSigningRoot(msg, types.ComputeDomain(types.DomainTypeBeaconProposer, version.Bellatrix, &relay.genesisValidatorsRoot))
+	root, err := types.ComputeSigningRoot(msg, types.ComputeDomain(types.DomainTypeBeaconProposer, types.Mainnet.BellatrixForkVersion, &relay.genesisValidatorsRoot))
 	require.NoError(t, err)
 	sig := sk.Sign(root[:]).Marshal()
 	var signature types.Signature
@@ -243,6 +1044,33 @@ func TestGetPayload(t *testing.T) {
 	})
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 
+	// Call getPayload signed by a proposer that did not get the bid
+	otherPk, otherSk := proposerKeypair(relay, 3)
+	relay.registerValidator(t, otherSk)
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", signBlindedBlock(t, relay, otherSk, msg))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errInvalidSignature.Error()+"\n", rr.Body.String())
+
+	// Call getPayload for a header the relay did not give
+	otherHeader := *msg
+	otherHeader.Body = &types.BlindedBeaconBlockBody{
+		Eth1Data:               msg.Body.Eth1Data,
+		SyncAggregate:          msg.Body.SyncAggregate,
+		ExecutionPayloadHeader: &types.ExecutionPayloadHeader{},
+	}
+	*otherHeader.Body.ExecutionPayloadHeader = *msg.Body.ExecutionPayloadHeader
+	otherHeader.Body.ExecutionPayloadHeader.BlockHash = types.Hash{0x0b}
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", signBlindedBlock(t, relay, sk, &otherHeader))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errUnknownBid.Error()+"\n", rr.Body.String())
+
+	// Call getPayload for another slot than the current one, the highest slot seen without a genesis time
+	otherSlot := *msg
+	otherSlot.Slot = 2
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", signBlindedBlock(t, relay, sk, &otherSlot))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errSlotNotCurrent.Error()+"\n", rr.Body.String())
+
 	// Call getPayload with correct signature
 	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", types.SignedBlindedBeaconBlock{
 		Message:   msg,
@@ -255,6 +1083,136 @@ func TestGetPayload(t *testing.T) {
 	err = json.Unmarshal(rr.Body.Bytes(), getPayloadResponse)
 	require.NoError(t, err)
 	require.Equal(t, bid.Data.Message.Header.BlockHash, getPayloadResponse.Data.BlockHash)
+
+	// Unblinding the same block again is fine
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", types.SignedBlindedBeaconBlock{
+		Message:   msg,
+		Signature: signature,
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Another block for the same slot
+	equivocation := *msg
+	equivocation.ParentRoot = types.Root{0x0a}
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", signBlindedBlock(t, relay, sk, &equivocation))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errEquivocation.Error()+"\n", rr.Body.String())
+
+	// Another validator with the proposer index of the first
+	path = fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", 2, parentHash.Hex(), otherPk)
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	otherBid := new(types.GetHeaderResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), otherBid))
+	otherProposer := *msg
+	otherProposer.Slot = 2
+	otherProposer.Body = &types.BlindedBeaconBlockBody{
+		Eth1Data:               msg.Body.Eth1Data,
+		SyncAggregate:          msg.Body.SyncAggregate,
+		ExecutionPayloadHeader: otherBid.Data.Message.Header,
+	}
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", signBlindedBlock(t, relay, otherSk, &otherProposer))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errProposerMismatch.Error()+"\n", rr.Body.String())
+
+	// A proposer index that is not in the validator set
+	otherProposer.ProposerIndex = 100
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", signBlindedBlock(t, relay, otherSk, &otherProposer))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errProposerMismatch.Error()+"\n", rr.Body.String())
+
+	// Data API has the delivered payload once, and both bids given
+	rr = relay.testRequest(t, "GET", "/relay/v1/data/bidtraces/proposer_payload_delivered?slot=1", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var delivered []types.BidTraceV2
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &delivered))
+	require.Len(t, delivered, 1)
+	require.Equal(t, bid.Data.Message.Header.BlockHash, delivered[0].BlockHash)
+	require.Equal(t, pk, delivered[0].ProposerPubkey[:])
+	require.Equal(t, relay.pk, delivered[0].BuilderPubkey)
+
+	rr = relay.testRequest(t, "GET", "/relay/v1/data/bidtraces/proposer_payload_delivered?slot=2", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, "[]\n", rr.Body.String())
+
+	rr = relay.testRequest(t, "GET", "/relay/v1/data/bidtraces/builder_blocks_received", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var received []types.BidTraceV2WithTimestamp
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &received))
+	require.Len(t, received, 2)
+	require.Equal(t, uint64(2), received[0].Slot, "latest first")
+
+	path = fmt.Sprintf("/relay/v1/data/bidtraces/builder_blocks_received?proposer_pubkey=0x%x&block_hash=%s", pk, bid.Data.Message.Header.BlockHash)
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &received))
+	require.Len(t, received, 1)
+	require.Equal(t, uint64(1), received[0].Slot)
+
+	rr = relay.testRequest(t, "GET", "/relay/v1/data/bidtraces/builder_blocks_received?slot=one", nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = relay.testRequest(t, "GET", fmt.Sprintf("/relay/v1/data/validator_registration?pubkey=0x%x", pk), nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	registration := new(types.SignedValidatorRegistration)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), registration))
+	require.Equal(t, pk, registration.Message.Pubkey[:])
+
+	// Block for a slot that is long gone
+	relay.beaconGenesisTime = uint64(time.Now().Add(-time.Hour).Unix())
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", types.SignedBlindedBeaconBlock{
+		Message:   msg,
+		Signature: signature,
+	})
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errSlotNotCurrent.Error()+"\n", rr.Body.String())
+}
+
+func TestGetPayloadExternalProposer(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	relay.engine.Run(ctx)
+	parentHash := prepareParent(t, relay)
+
+	// Validators of a real beacon chain are not in the simulated set, but registered
+	unblind := func(slot uint64, sk bls.SecretKey) *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/0x%x", slot, parentHash.Hex(), sk.PublicKey().Marshal())
+		rr := relay.testRequest(t, "GET", path, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		bid := new(types.GetHeaderResponse)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+		msg := &types.BlindedBeaconBlock{
+			Slot:          slot,
+			ProposerIndex: 100,
+			Body: &types.BlindedBeaconBlockBody{
+				Eth1Data:               &types.Eth1Data{},
+				SyncAggregate:          &types.SyncAggregate{},
+				ExecutionPayloadHeader: bid.Data.Message.Header,
+			},
+		}
+		return relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", signBlindedBlock(t, relay, sk, msg))
+	}
+	_, sk := newKeypair(t)
+	relay.registerValidator(t, sk)
+	rr := unblind(1, sk)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// The proposer index stays with the pubkey that first signed for it
+	_, otherSk := newKeypair(t)
+	relay.registerValidator(t, otherSk)
+	rr = unblind(2, otherSk)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errProposerMismatch.Error()+"\n", rr.Body.String())
+	rr = unblind(3, sk)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+func signBlindedBlock(t *testing.T, relay *testRelayBackend, sk bls.SecretKey, msg *types.BlindedBeaconBlock) *types.SignedBlindedBeaconBlock {
+	root, err := types.ComputeSigningRoot(msg, types.ComputeDomain(types.DomainTypeBeaconProposer, types.Mainnet.BellatrixForkVersion, &relay.genesisValidatorsRoot))
+	require.NoError(t, err)
+	var signature types.Signature
+	signature.FromSlice(sk.Sign(root[:]).Marshal())
+	return &types.SignedBlindedBeaconBlock{Message: msg, Signature: signature}
 }
 
 func TestExecutionPayloadTransformations(t *testing.T) {
@@ -264,8 +1222,8 @@ func TestExecutionPayloadTransformations(t *testing.T) {
 	parent := relay.engine.mockChain().CurrentHeader()
 
 	txsCreator := TransactionsCreator{nil, func(config *params.ChainConfig, bc core.ChainContext,
-		statedb *state.StateDB, header *ethTypes.Header, cfg vm.Config, accounts []TestAccount) []*ethTypes.Transaction {
-		return nil // TODO: create some transactions
+		statedb *state.StateDB, header *ethTypes.Header, cfg vm.Config, accounts []TestAccount) ([]*ethTypes.Transaction, error) {
+		return nil, nil // TODO: create some transactions
 	}}
 
 	// Create a block
@@ -289,3 +1247,203 @@ func TestExecutionPayloadTransformations(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, block1.Hash(), block2.Hash())
 }
+
+func TestBuilderValidators(t *testing.T) {
+	relay := newTestRelay(t)
+	validators := relay.validators.Validators()
+	registrations := make([]*types.SignedValidatorRegistration, 0, len(validators))
+	for _, v := range validators[:4] {
+		registration, err := v.Registration(uint64(time.Now().Unix()), types.DomainBuilder)
+		require.NoError(t, err)
+		registrations = append(registrations, registration)
+	}
+	rr := relay.testRequest(t, "POST", "/eth/v1/builder/validators", registrations)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = relay.testRequest(t, "GET", "/relay/v1/builder/validators", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var entries []types.BuilderGetValidatorsResponseEntry
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &entries))
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		require.Less(t, entry.Slot, 2*relay.slotsPerEpoch)
+		require.Equal(t, relay.validators.Proposer(entry.Slot).Index, entry.ValidatorIndex)
+		require.Less(t, entry.ValidatorIndex, uint64(4), "unregistered proposer listed")
+		require.Equal(t, relay.validators.ByIndex(entry.ValidatorIndex).Pubkey, entry.Entry.Message.Pubkey)
+	}
+}
+
+func TestSubmitBlock(t *testing.T) {
+	ctx := context.Background()
+	relay := newTestRelay(t)
+	mixKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	relay.engine.GenesisPath = newGenesis(t, crypto.PubkeyToAddress(mixKey.PublicKey))
+	relay.engine.Run(ctx)
+	proposer := relay.validators.ByIndex(0)
+	registration, err := proposer.Registration(uint64(time.Now().Unix()), types.DomainBuilder)
+	require.NoError(t, err)
+	rr := relay.testRequest(t, "POST", "/eth/v1/builder/validators", []*types.SignedValidatorRegistration{registration})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	parent := relay.engine.mockChain().CurrentHeader()
+	parentHash := prepareParent(t, relay)
+	attributes := &types.PayloadAttributesV1{
+		Timestamp:             parent.Time + 1,
+		PrevRandao:            common.Hash{0x01},
+		SuggestedFeeRecipient: proposer.FeeRecipient,
+	}
+
+	// The external builder builds a block paying the fee recipient directly
+	payload, err := relay.engine.backend.buildPayload(parentHash, attributes, parent.GasLimit, emptyTxsCreator)
+	require.NoError(t, err)
+	restPayload, err := types.ELPayloadToRESTPayload(payload)
+	require.NoError(t, err)
+	builderPk, builderSk := newKeypair(t)
+	submission := func(trace types.BidTrace) *types.BuilderSubmitBlockRequest {
+		root, err := types.ComputeSigningRoot(&trace, types.DomainBuilder)
+		require.NoError(t, err)
+		var signature types.Signature
+		signature.FromSlice(builderSk.Sign(root[:]).Marshal())
+		return &types.BuilderSubmitBlockRequest{Signature: signature, Message: &trace, ExecutionPayload: restPayload}
+	}
+	trace := types.BidTrace{
+		Slot:                 1,
+		ParentHash:           types.Hash(parentHash),
+		BlockHash:            types.Hash(payload.BlockHash),
+		ProposerPubkey:       proposer.Pubkey,
+		ProposerFeeRecipient: types.Address(proposer.FeeRecipient),
+		GasLimit:             payload.GasLimit,
+		GasUsed:              payload.GasUsed,
+	}
+	trace.BuilderPubkey.FromSlice(builderPk)
+
+	// Invalid builder signature
+	invalid := submission(trace)
+	invalid.Signature[len(invalid.Signature)-1] = 0x00
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", invalid)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errInvalidSignature.Error()+"\n", rr.Body.String())
+
+	// Trace of another block
+	mismatch := trace
+	mismatch.GasUsed++
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", submission(mismatch))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errTraceMismatch.Error()+"\n", rr.Body.String())
+
+	// Another fee recipient than registered
+	otherRecipient := trace
+	otherRecipient.ProposerFeeRecipient = types.Address{0x01}
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", submission(otherRecipient))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errFeeRecipient.Error()+"\n", rr.Body.String())
+
+	// Bid that the block does not pay
+	unpaid := trace
+	unpaid.Value = types.IntToU256(1)
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", submission(unpaid))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errBidUnpaid.Error()+"\n", rr.Body.String())
+
+	// Submission for a slot that is neither the current nor the next one
+	otherSlot := trace
+	otherSlot.Slot = 3
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", submission(otherSlot))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errSubmissionSlot.Error()+"\n", rr.Body.String())
+
+	// Submissions have no withdrawals or blobs, so only Bellatrix slots take them
+	relay.forks.CapellaEpoch = 0
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", submission(trace))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, errSubmissionFork.Error()+"\n", rr.Body.String())
+	relay.forks.CapellaEpoch = math.MaxUint64
+
+	// Valid submission is given to the proposer
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", submission(trace))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	path := fmt.Sprintf("/eth/v1/builder/header/%d/%s/%s", 1, parentHash.Hex(), proposer.Pubkey)
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	bid := new(types.GetHeaderResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	require.Equal(t, trace.BlockHash, bid.Data.Message.Header.BlockHash)
+	require.Equal(t, relay.pk, bid.Data.Message.Pubkey)
+
+	// A better submission, with the tips of a transaction mix, is the best bid from now on
+	cfg := &BuilderTxsConfig{}
+	cfg.Default()
+	require.NoError(t, cfg.Accounts.Set(common.Bytes2Hex(crypto.FromECDSA(mixKey))))
+	betterPayload, err := relay.engine.backend.buildPayload(parentHash, attributes, parent.GasLimit, txMixCreator(cfg))
+	require.NoError(t, err)
+	restPayload, err = types.ELPayloadToRESTPayload(betterPayload)
+	require.NoError(t, err)
+	better := trace
+	better.BlockHash = types.Hash(betterPayload.BlockHash)
+	better.GasUsed = betterPayload.GasUsed
+	better.Value = types.IntToU256(params.GWei * cfg.Count * params.TxGas)
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", submission(better))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// A submission for the next slot does not end the current one
+	next := better
+	next.Slot = 2
+	rr = relay.testRequest(t, "POST", "/relay/v1/builder/blocks", submission(next))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// The block of the bid already given is still unblinded
+	msg := &types.BlindedBeaconBlock{
+		Slot:          1,
+		ProposerIndex: proposer.Index,
+		Body: &types.BlindedBeaconBlockBody{
+			Eth1Data:               &types.Eth1Data{},
+			SyncAggregate:          &types.SyncAggregate{},
+			ExecutionPayloadHeader: bid.Data.Message.Header,
+		},
+	}
+	rr = relay.testRequest(t, "POST", "/eth/v1/builder/blinded_blocks", signBlindedBlock(t, relay, proposer.sk, msg))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	unblinded := new(types.GetPayloadResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), unblinded))
+	require.Equal(t, trace.BlockHash, unblinded.Data.BlockHash)
+
+	rr = relay.testRequest(t, "GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	require.Equal(t, better.BlockHash, bid.Data.Message.Header.BlockHash)
+	require.Equal(t, better.Value, bid.Data.Message.Value)
+
+	// A lower bid, like one the relay built while the submission arrived, does not replace it
+	key := bidKey{Slot: 1, ParentHash: parentHash, Pubkey: proposer.Pubkey}
+	lower, headerRoot, err := relay.signBid(types.VersionBellatrix, payload, nil, types.IntToU256(0))
+	require.NoError(t, err)
+	best, added := relay.offerBid(&relayBid{key: key, signed: lower, headerRoot: headerRoot, payload: payload})
+	require.False(t, added)
+	require.Equal(t, better.BlockHash, best.signed.BlockHash())
+}
+
+func TestRelayNetwork(t *testing.T) {
+	path := t.TempDir() + "/config.yaml"
+	config := "PRESET_BASE: 'mainnet'\nGENESIS_FORK_VERSION: 0x10000038\nBELLATRIX_FORK_VERSION: 0x30000038\nCAPELLA_FORK_VERSION: 0x40000038\nDENEB_FORK_VERSION: 0x50000038\nDENEB_FORK_EPOCH: 0\n"
+	require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+	network, err := loadNetwork(path)
+	require.NoError(t, err)
+	require.Equal(t, types.ForkVersion{0x10, 0x00, 0x00, 0x38}, network.GenesisForkVersion)
+	require.Equal(t, types.ForkVersion{0x50, 0x00, 0x00, 0x38}, network.DenebForkVersion)
+
+	_, err = loadNetwork("goerli")
+	require.Error(t, err)
+
+	// Registrations signed for mainnet are rejected by a relay on another network
+	cfg := new(RelayCmd)
+	cfg.Default()
+	cfg.Validators.Default()
+	cfg.Network = types.Sepolia.Name
+	relay, err := NewRelayBackend(logrus.New(), cfg)
+	require.NoError(t, err)
+	require.Equal(t, types.Sepolia.BuilderDomain(), relay.builderDomain)
+	sk, _ := bls.RandKey()
+	rr := (&testRelayBackend{relay}).testRequest(t, "POST", "/eth/v1/builder/validators", []*types.SignedValidatorRegistration{newRegistration(t, sk, uint64(time.Now().Unix()))})
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mergemock/rpc"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var errNoSession = errors.New("no session file to replay")
+
+type ReplayCmd struct {
+	SessionPath   string   `ask:"--session" help:"Session file recorded by the engine with --record"`
+	EngineAddr    string   `ask:"--engine" help:"Address of Engine JSON-RPC endpoint to replay the session to"`
+	JwtSecretPath string   `ask:"--jwt-secret" help:"JWT secret key for authenticated communication"`
+	Pace          bool     `ask:"--pace" help:"Keep the recorded time between requests, instead of sending each request once the previous one is answered"`
+	Ignore        []string `ask:"--ignore" help:"Fields of responses that may differ from the recording, wherever they are"`
+
+	// embed logger options
+	LogCmd `ask:".log" help:"Change logger configuration"`
+
+	log    logrus.Ext1FieldLogger
+	client *http.Client
+	jwt    []byte
+}
+
+func (c *ReplayCmd) Default() {
+	c.EngineAddr = "http://127.0.0.1:8551"
+	c.JwtSecretPath = "jwt.hex"
+	c.Ignore = []string{"validationError"}
+	c.LogLvl = "info"
+}
+
+func (c *ReplayCmd) Help() string {
+	return "Replay a recorded engine API session to an execution client, and diff its responses against the recording."
+}
+
+func (c *ReplayCmd) Run(ctx context.Context, args ...string) error {
+	logr, err := c.LogCmd.Create()
+	if err != nil {
+		return err
+	}
+	c.log = logr
+	if c.SessionPath == "" {
+		return errNoSession
+	}
+	if c.jwt, err = loadJwtSecret(c.JwtSecretPath); err != nil {
+		return fmt.Errorf("unable to read JWT secret: %v", err)
+	}
+	c.client = &http.Client{}
+	entries, err := loadSession(c.SessionPath)
+	if err != nil {
+		return err
+	}
+	differing, err := c.replay(ctx, entries)
+	if err != nil {
+		return err
+	}
+	if differing != 0 {
+		return fmt.Errorf("%d of %d responses differ from the recording", differing, len(entries))
+	}
+	c.log.WithField("requests", len(entries)).Info("All responses match the recording")
+	return nil
+}
+
+// replay sends the requests of the session in order, and returns how many responses differ from the recording.
+// Payload IDs are assigned by the execution client, so those of the recording are replaced by those given in replay.
+func (c *ReplayCmd) replay(ctx context.Context, entries []*sessionEntry) (int, error) {
+	payloadIDs := make(map[string]string)
+	differing := 0
+	for i, entry := range entries {
+		if c.Pace && i > 0 {
+			select {
+			case <-time.After(entry.RequestTime.Sub(entries[i-1].RequestTime)):
+			case <-ctx.Done():
+				return differing, ctx.Err()
+			}
+		}
+		request := []byte(entry.Request)
+		for recorded, replayed := range payloadIDs {
+			request = bytes.ReplaceAll(request, []byte(recorded), []byte(replayed))
+		}
+		var call struct {
+			Method string `json:"method"`
+		}
+		_ = json.Unmarshal(request, &call)
+		rlog := c.log.WithField("index", i).WithField("method", call.Method)
+
+		status, response, err := rpc.PostRaw(ctx, c.client, c.EngineAddr, c.jwt, request)
+		if err != nil {
+			return differing, fmt.Errorf("request %d (%s) failed: %v", i, call.Method, err)
+		}
+		if recorded, replayed := payloadIDOf(entry.Response), payloadIDOf(response); recorded != "" && replayed != "" {
+			payloadIDs[recorded] = replayed
+		}
+		diffs := diffResponses(entry.Response, asRawJSON(response), c.Ignore)
+		if status != entry.Status {
+			diffs = append([]string{fmt.Sprintf("HTTP status: recorded %d, replayed %d", entry.Status, status)}, diffs...)
+		}
+		if len(diffs) != 0 {
+			differing++
+			rlog.WithField("diffs", strings.Join(diffs, "; ")).Warn("Response differs from the recording")
+			continue
+		}
+		rlog.Debug("Response matches the recording")
+	}
+	return differing, nil
+}
+
+// payloadIDOf returns the quoted payload ID of a forkchoiceUpdated response, if any.
+func payloadIDOf(response []byte) string {
+	var msg struct {
+		Result struct {
+			PayloadID json.RawMessage `json:"payloadId"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(response, &msg); err != nil || len(msg.Result.PayloadID) == 0 || string(msg.Result.PayloadID) == "null" {
+		return ""
+	}
+	return string(msg.Result.PayloadID)
+}
+
+// diffResponses describes how the replayed response differs from the recorded one. Payload IDs and the ignored fields
+// may differ.
+func diffResponses(recorded, replayed json.RawMessage, ignore []string) []string {
+	var a, b interface{}
+	if err := json.Unmarshal(recorded, &a); err != nil {
+		return []string{fmt.Sprintf("invalid recorded response: %v", err)}
+	}
+	if err := json.Unmarshal(replayed, &b); err != nil {
+		return []string{fmt.Sprintf("invalid replayed response: %v", err)}
+	}
+	skip := map[string]bool{"payloadId": true}
+	for _, field := range ignore {
+		skip[field] = true
+	}
+	var diffs []string
+	diffJSON("", a, b, skip, &diffs)
+	return diffs
+}
+
+func diffJSON(path string, a, b interface{}, skip map[string]bool, diffs *[]string) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			keys := make(map[string]bool)
+			for k := range a {
+				keys[k] = true
+			}
+			for k := range b {
+				keys[k] = true
+			}
+			sorted := make([]string, 0, len(keys))
+			for k := range keys {
+				if !skip[k] {
+					sorted = append(sorted, k)
+				}
+			}
+			sort.Strings(sorted)
+			for _, k := range sorted {
+				diffJSON(path+"."+k, a[k], b[k], skip, diffs)
+			}
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok && len(a) == len(b) {
+			for i := range a {
+				diffJSON(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], skip, diffs)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		name := strings.TrimPrefix(path, ".")
+		if name == "" {
+			name = "response"
+		}
+		recorded, _ := json.Marshal(a)
+		replayed, _ := json.Marshal(b)
+		*diffs = append(*diffs, fmt.Sprintf("%s: recorded %s, replayed %s", name, recorded, replayed))
+	}
+}
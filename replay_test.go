@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"mergemock/rpc"
+	"mergemock/types"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEngine runs an engine on ports of its own, and returns a client of it.
+func newTestEngine(t *testing.T, listenAddr, wsAddr, jwtPath, genesisPath, recordPath string) *rpc.Client {
+	ctx := context.Background()
+	engine := &EngineCmd{}
+	engine.Default()
+	engine.LogCmd.Default()
+	engine.ListenAddr = listenAddr
+	engine.WebsocketAddr = wsAddr
+	engine.JwtSecretPath = jwtPath
+	engine.GenesisPath = genesisPath
+	engine.RecordPath = recordPath
+	require.NoError(t, engine.Run(ctx))
+	t.Cleanup(func() { engine.Close() })
+
+	jwt, err := loadJwtSecret(jwtPath)
+	require.NoError(t, err)
+	client, err := rpc.DialContext(ctx, "http://"+listenAddr, jwt)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	require.Eventually(t, func() bool {
+		var head *ethTypes.Header
+		return client.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false) == nil
+	}, 5*time.Second, 50*time.Millisecond, "engine not reachable")
+	return client
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	jwtPath, genesisPath := newJwt(t), newGenesis(t, common.Address{})
+	sessionPath := t.TempDir() + "/session.jsonl"
+
+	// Requests over websocket would be missing from the session
+	engine := &EngineCmd{}
+	engine.Default()
+	engine.RecordPath = sessionPath
+	require.ErrorIs(t, engine.Run(ctx), errRecordWebsocket)
+
+	recorded := newTestEngine(t, "127.0.0.1:38591", "", jwtPath, genesisPath, sessionPath)
+
+	// A block is built and imported through the recording engine
+	var head *ethTypes.Header
+	require.NoError(t, recorded.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false))
+	state := &types.ForkchoiceStateV1{HeadBlockHash: head.Hash(), SafeBlockHash: head.Hash(), FinalizedBlockHash: head.Hash()}
+	attributes := &types.PayloadAttributesV1{Timestamp: head.Time + 1, PrevRandao: common.Hash{0x01}, SuggestedFeeRecipient: common.Address{0x02}}
+	var result types.ForkchoiceUpdatedResult
+	require.NoError(t, recorded.CallContext(ctx, &result, "engine_forkchoiceUpdatedV1", state, attributes))
+	require.NotNil(t, result.PayloadID)
+	var payload types.ExecutionPayloadV1
+	require.NoError(t, recorded.CallContext(ctx, &payload, "engine_getPayloadV1", result.PayloadID))
+	var status types.PayloadStatusV1
+	require.NoError(t, recorded.CallContext(ctx, &status, "engine_newPayloadV1", &payload))
+	require.Equal(t, types.ExecutionValid, status.Status)
+
+	entries, err := loadSession(sessionPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	var call struct {
+		Method string `json:"method"`
+	}
+	require.NoError(t, json.Unmarshal(entries[2].Request, &call))
+	require.Equal(t, "engine_forkchoiceUpdatedV1", call.Method)
+	require.Equal(t, http.StatusOK, entries[2].Status)
+	require.False(t, entries[2].ResponseTime.Before(entries[2].RequestTime))
+
+	// The other engine gives other payload IDs, which the replay follows
+	replayed := newTestEngine(t, "127.0.0.1:38593", "127.0.0.1:38594", jwtPath, genesisPath, "")
+	var other types.ForkchoiceUpdatedResult
+	require.NoError(t, replayed.CallContext(ctx, &other, "engine_forkchoiceUpdatedV1", state, attributes))
+
+	replay := new(ReplayCmd)
+	replay.Default()
+	replay.EngineAddr = "http://127.0.0.1:38593"
+	replay.log = logrus.New()
+	replay.client = &http.Client{}
+	replay.jwt, err = loadJwtSecret(jwtPath)
+	require.NoError(t, err)
+	differing, err := replay.replay(ctx, entries)
+	require.NoError(t, err)
+	require.Zero(t, differing)
+
+	// Responses that differ from the recording are reported
+	entries[0].Response = json.RawMessage(`{"jsonrpc":"2.0","id":1,"result":null}`)
+	differing, err = replay.replay(ctx, entries[:1])
+	require.NoError(t, err)
+	require.Equal(t, 1, differing)
+}
+
+func TestDiffResponses(t *testing.T) {
+	recorded := json.RawMessage(`{"id":1,"result":{"payloadStatus":{"status":"VALID","validationError":null},"payloadId":"0x01"}}`)
+	replayed := json.RawMessage(`{"id":1,"result":{"payloadStatus":{"status":"SYNCING","validationError":"busy"},"payloadId":"0x02"}}`)
+	require.Equal(t, []string{`result.payloadStatus.status: recorded "VALID", replayed "SYNCING"`}, diffResponses(recorded, replayed, []string{"validationError"}))
+	require.Len(t, diffResponses(recorded, replayed, nil), 2)
+	require.Empty(t, diffResponses(recorded, recorded, nil))
+	require.Equal(t, []string{`response: recorded {"id":1}, replayed "unauthorized"`}, diffResponses(json.RawMessage(`{"id":1}`), asRawJSON([]byte("unauthorized\n")), nil))
+}
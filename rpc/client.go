@@ -1,8 +1,11 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -58,3 +61,28 @@ func IssueJwtToken() *jwt.Token {
 func EncodeJwtAuthorization(strToken string) string {
 	return fmt.Sprintf("Bearer %v", strToken)
 }
+
+// PostRaw sends a raw JSON-RPC request body to the address, authenticated with a token of the secret, and returns the
+// HTTP status and body of the response.
+func PostRaw(ctx context.Context, client *http.Client, addr string, secret []byte, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	token, err := IssueJwtToken().SignedString(secret)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", EncodeJwtAuthorization(token))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, respBody, nil
+}
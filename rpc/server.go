@@ -2,14 +2,17 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	glog "log"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/node"
 	gethRpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/sirupsen/logrus"
 )
 
@@ -97,3 +100,29 @@ func NewWSServer(ctx context.Context, log logrus.Ext1FieldLogger, rpcSrv *Server
 		},
 	}
 }
+
+// jwtIssuedAtWindow is how far from now the issuance of a token may be, as with execution clients.
+const jwtIssuedAtWindow = 60 * time.Second
+
+// VerifyJwtAuthorization checks the Authorization header value holds a token signed with the secret, and issued
+// recently.
+func VerifyJwtAuthorization(header string, secret []byte) error {
+	strToken := strings.TrimPrefix(header, "Bearer ")
+	if strToken == header || strToken == "" {
+		return errors.New("missing token")
+	}
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(strToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return err
+	}
+	if claims.IssuedAt == nil {
+		return errors.New("missing issued-at")
+	}
+	if d := time.Since(claims.IssuedAt.Time); d > jwtIssuedAtWindow || d < -jwtIssuedAtWindow {
+		return fmt.Errorf("stale token, issued at %s", claims.IssuedAt.Time)
+	}
+	return nil
+}
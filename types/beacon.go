@@ -0,0 +1,308 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Full blocks are only used as JSON by the beacon API stand-in of the consensus mock. Their roots are those of the
+// blinded blocks with the header of their payload, which is how they are signed and verified.
+
+// BeaconBlockBody https://github.com/ethereum/beacon-APIs/blob/master/types/bellatrix/block.yaml
+type BeaconBlockBody struct {
+	RandaoReveal      Signature             `json:"randao_reveal"`
+	Eth1Data          *Eth1Data             `json:"eth1_data"`
+	Graffiti          Hash                  `json:"graffiti"`
+	ProposerSlashings []*ProposerSlashing   `json:"proposer_slashings"`
+	AttesterSlashings []*AttesterSlashing   `json:"attester_slashings"`
+	Attestations      []*Attestation        `json:"attestations"`
+	Deposits          []*Deposit            `json:"deposits"`
+	VoluntaryExits    []*VoluntaryExit      `json:"voluntary_exits"`
+	SyncAggregate     *SyncAggregate        `json:"sync_aggregate"`
+	ExecutionPayload  *ExecutionPayloadREST `json:"execution_payload"`
+}
+
+// BeaconBlock https://github.com/ethereum/beacon-APIs/blob/master/types/bellatrix/block.yaml
+type BeaconBlock struct {
+	Slot          uint64           `json:"slot,string"`
+	ProposerIndex uint64           `json:"proposer_index,string"`
+	ParentRoot    Root             `json:"parent_root"`
+	StateRoot     Root             `json:"state_root"`
+	Body          *BeaconBlockBody `json:"body"`
+}
+
+// SignedBeaconBlock https://github.com/ethereum/beacon-APIs/blob/master/types/bellatrix/block.yaml
+type SignedBeaconBlock struct {
+	Message   *BeaconBlock `json:"message"`
+	Signature Signature    `json:"signature"`
+}
+
+// BeaconBlockBodyCapella https://github.com/ethereum/beacon-APIs/blob/master/types/capella/block.yaml
+type BeaconBlockBodyCapella struct {
+	RandaoReveal          Signature                     `json:"randao_reveal"`
+	Eth1Data              *Eth1Data                     `json:"eth1_data"`
+	Graffiti              Hash                          `json:"graffiti"`
+	ProposerSlashings     []*ProposerSlashing           `json:"proposer_slashings"`
+	AttesterSlashings     []*AttesterSlashing           `json:"attester_slashings"`
+	Attestations          []*Attestation                `json:"attestations"`
+	Deposits              []*Deposit                    `json:"deposits"`
+	VoluntaryExits        []*VoluntaryExit              `json:"voluntary_exits"`
+	SyncAggregate         *SyncAggregate                `json:"sync_aggregate"`
+	ExecutionPayload      *ExecutionPayloadCapella      `json:"execution_payload"`
+	BLSToExecutionChanges []*SignedBLSToExecutionChange `json:"bls_to_execution_changes"`
+}
+
+// BeaconBlockCapella https://github.com/ethereum/beacon-APIs/blob/master/types/capella/block.yaml
+type BeaconBlockCapella struct {
+	Slot          uint64                  `json:"slot,string"`
+	ProposerIndex uint64                  `json:"proposer_index,string"`
+	ParentRoot    Root                    `json:"parent_root"`
+	StateRoot     Root                    `json:"state_root"`
+	Body          *BeaconBlockBodyCapella `json:"body"`
+}
+
+// SignedBeaconBlockCapella https://github.com/ethereum/beacon-APIs/blob/master/types/capella/block.yaml
+type SignedBeaconBlockCapella struct {
+	Message   *BeaconBlockCapella `json:"message"`
+	Signature Signature           `json:"signature"`
+}
+
+// BeaconBlockBodyDeneb https://github.com/ethereum/beacon-APIs/blob/master/types/deneb/block.yaml
+type BeaconBlockBodyDeneb struct {
+	RandaoReveal          Signature                     `json:"randao_reveal"`
+	Eth1Data              *Eth1Data                     `json:"eth1_data"`
+	Graffiti              Hash                          `json:"graffiti"`
+	ProposerSlashings     []*ProposerSlashing           `json:"proposer_slashings"`
+	AttesterSlashings     []*AttesterSlashing           `json:"attester_slashings"`
+	Attestations          []*Attestation                `json:"attestations"`
+	Deposits              []*Deposit                    `json:"deposits"`
+	VoluntaryExits        []*VoluntaryExit              `json:"voluntary_exits"`
+	SyncAggregate         *SyncAggregate                `json:"sync_aggregate"`
+	ExecutionPayload      *ExecutionPayloadDeneb        `json:"execution_payload"`
+	BLSToExecutionChanges []*SignedBLSToExecutionChange `json:"bls_to_execution_changes"`
+	BlobKzgCommitments    []KZGCommitment               `json:"blob_kzg_commitments"`
+}
+
+// BeaconBlockDeneb https://github.com/ethereum/beacon-APIs/blob/master/types/deneb/block.yaml
+type BeaconBlockDeneb struct {
+	Slot          uint64                `json:"slot,string"`
+	ProposerIndex uint64                `json:"proposer_index,string"`
+	ParentRoot    Root                  `json:"parent_root"`
+	StateRoot     Root                  `json:"state_root"`
+	Body          *BeaconBlockBodyDeneb `json:"body"`
+}
+
+// BlockContentsDeneb https://github.com/ethereum/beacon-APIs/blob/master/types/deneb/block_contents.yaml
+type BlockContentsDeneb struct {
+	Block     *BeaconBlockDeneb `json:"block"`
+	KZGProofs []KZGProof        `json:"kzg_proofs"`
+	Blobs     []Blob            `json:"blobs"`
+}
+
+// SignedBeaconBlockDeneb https://github.com/ethereum/beacon-APIs/blob/master/types/deneb/block.yaml
+type SignedBeaconBlockDeneb struct {
+	Message   *BeaconBlockDeneb `json:"message"`
+	Signature Signature         `json:"signature"`
+}
+
+// SignedBlockContentsDeneb https://github.com/ethereum/beacon-APIs/blob/master/types/deneb/block_contents.yaml
+type SignedBlockContentsDeneb struct {
+	SignedBlock *SignedBeaconBlockDeneb `json:"signed_block"`
+	KZGProofs   []KZGProof              `json:"kzg_proofs"`
+	Blobs       []Blob                  `json:"blobs"`
+}
+
+// VersionedBeaconBlock is an unsigned full block of any fork, as returned by produceBlock in the version envelope.
+type VersionedBeaconBlock struct {
+	Version   string
+	Bellatrix *BeaconBlock
+	Capella   *BeaconBlockCapella
+	Deneb     *BlockContentsDeneb
+}
+
+func (b *VersionedBeaconBlock) MarshalJSON() ([]byte, error) {
+	var data interface{}
+	switch {
+	case b.Bellatrix != nil:
+		data = b.Bellatrix
+	case b.Capella != nil:
+		data = b.Capella
+	case b.Deneb != nil:
+		data = b.Deneb
+	default:
+		return nil, errIncomplete
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&versioned{Version: b.Version, Data: raw})
+}
+
+// VersionedSignedBeaconBlock is a signed full block of any fork, as published to the beacon API. Like
+// VersionedSignedBlindedBeaconBlock, the fork set in Version decides what is decoded.
+type VersionedSignedBeaconBlock struct {
+	Version   string
+	Bellatrix *SignedBeaconBlock
+	Capella   *SignedBeaconBlockCapella
+	Deneb     *SignedBlockContentsDeneb
+}
+
+func (b *VersionedSignedBeaconBlock) MarshalJSON() ([]byte, error) {
+	switch {
+	case b.Bellatrix != nil:
+		return json.Marshal(b.Bellatrix)
+	case b.Capella != nil:
+		return json.Marshal(b.Capella)
+	case b.Deneb != nil:
+		return json.Marshal(b.Deneb)
+	}
+	return nil, errIncomplete
+}
+
+func (b *VersionedSignedBeaconBlock) UnmarshalJSON(input []byte) error {
+	switch b.Version {
+	case VersionBellatrix:
+		b.Bellatrix = new(SignedBeaconBlock)
+		return json.Unmarshal(input, b.Bellatrix)
+	case VersionCapella:
+		b.Capella = new(SignedBeaconBlockCapella)
+		return json.Unmarshal(input, b.Capella)
+	case VersionDeneb:
+		b.Deneb = new(SignedBlockContentsDeneb)
+		return json.Unmarshal(input, b.Deneb)
+	}
+	return unsupportedVersion(b.Version)
+}
+
+var errIncompleteBlock = errors.New("incomplete block")
+
+// Payload returns the execution payload of the block, with the blobs of Deneb block contents.
+func (b *VersionedSignedBeaconBlock) Payload() (*VersionedExecutionPayload, error) {
+	p := &VersionedExecutionPayload{Version: b.Version}
+	switch {
+	case b.Bellatrix != nil && b.Bellatrix.Message != nil && b.Bellatrix.Message.Body != nil:
+		p.Bellatrix = b.Bellatrix.Message.Body.ExecutionPayload
+	case b.Capella != nil && b.Capella.Message != nil && b.Capella.Message.Body != nil:
+		p.Capella = b.Capella.Message.Body.ExecutionPayload
+	case b.Deneb != nil && b.Deneb.SignedBlock != nil && b.Deneb.SignedBlock.Message != nil && b.Deneb.SignedBlock.Message.Body != nil:
+		p.Deneb = &ExecutionPayloadAndBlobsBundle{
+			ExecutionPayload: b.Deneb.SignedBlock.Message.Body.ExecutionPayload,
+			BlobsBundle: &BlobsBundle{
+				Commitments: b.Deneb.SignedBlock.Message.Body.BlobKzgCommitments,
+				Proofs:      b.Deneb.KZGProofs,
+				Blobs:       b.Deneb.Blobs,
+			},
+		}
+	default:
+		return nil, errIncompleteBlock
+	}
+	if _, err := p.data(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Blinded returns the block with the header of its payload in place of the payload. It has the same root and
+// signature. The payload must fit the engine API V1.
+func (b *VersionedSignedBeaconBlock) Blinded() (*VersionedSignedBlindedBeaconBlock, error) {
+	payload, err := b.Payload()
+	if err != nil {
+		return nil, err
+	}
+	el, err := payload.ELPayload()
+	if err != nil {
+		return nil, err
+	}
+	blinded := &VersionedSignedBlindedBeaconBlock{Version: b.Version}
+	switch {
+	case b.Bellatrix != nil:
+		m := b.Bellatrix.Message
+		header, err := PayloadToPayloadHeader(el)
+		if err != nil {
+			return nil, err
+		}
+		blinded.Bellatrix = &SignedBlindedBeaconBlock{
+			Message: &BlindedBeaconBlock{
+				Slot:          m.Slot,
+				ProposerIndex: m.ProposerIndex,
+				ParentRoot:    m.ParentRoot,
+				StateRoot:     m.StateRoot,
+				Body: &BlindedBeaconBlockBody{
+					RandaoReveal:           m.Body.RandaoReveal,
+					Eth1Data:               m.Body.Eth1Data,
+					Graffiti:               m.Body.Graffiti,
+					ProposerSlashings:      m.Body.ProposerSlashings,
+					AttesterSlashings:      m.Body.AttesterSlashings,
+					Attestations:           m.Body.Attestations,
+					Deposits:               m.Body.Deposits,
+					VoluntaryExits:         m.Body.VoluntaryExits,
+					SyncAggregate:          m.Body.SyncAggregate,
+					ExecutionPayloadHeader: header,
+				},
+			},
+			Signature: b.Bellatrix.Signature,
+		}
+	case b.Capella != nil:
+		m := b.Capella.Message
+		header, err := PayloadToPayloadHeaderCapella(el, nil)
+		if err != nil {
+			return nil, err
+		}
+		blinded.Capella = &SignedBlindedBeaconBlockCapella{
+			Message: &BlindedBeaconBlockCapella{
+				Slot:          m.Slot,
+				ProposerIndex: m.ProposerIndex,
+				ParentRoot:    m.ParentRoot,
+				StateRoot:     m.StateRoot,
+				Body: &BlindedBeaconBlockBodyCapella{
+					RandaoReveal:           m.Body.RandaoReveal,
+					Eth1Data:               m.Body.Eth1Data,
+					Graffiti:               m.Body.Graffiti,
+					ProposerSlashings:      m.Body.ProposerSlashings,
+					AttesterSlashings:      m.Body.AttesterSlashings,
+					Attestations:           m.Body.Attestations,
+					Deposits:               m.Body.Deposits,
+					VoluntaryExits:         m.Body.VoluntaryExits,
+					SyncAggregate:          m.Body.SyncAggregate,
+					ExecutionPayloadHeader: header,
+					BLSToExecutionChanges:  m.Body.BLSToExecutionChanges,
+				},
+			},
+			Signature: b.Capella.Signature,
+		}
+	default:
+		m := b.Deneb.SignedBlock.Message
+		header, err := PayloadToPayloadHeaderDeneb(el, nil)
+		if err != nil {
+			return nil, err
+		}
+		blinded.Deneb = &SignedBlindedBeaconBlockDeneb{
+			Message: &BlindedBeaconBlockDeneb{
+				Slot:          m.Slot,
+				ProposerIndex: m.ProposerIndex,
+				ParentRoot:    m.ParentRoot,
+				StateRoot:     m.StateRoot,
+				Body: &BlindedBeaconBlockBodyDeneb{
+					RandaoReveal:           m.Body.RandaoReveal,
+					Eth1Data:               m.Body.Eth1Data,
+					Graffiti:               m.Body.Graffiti,
+					ProposerSlashings:      m.Body.ProposerSlashings,
+					AttesterSlashings:      m.Body.AttesterSlashings,
+					Attestations:           m.Body.Attestations,
+					Deposits:               m.Body.Deposits,
+					VoluntaryExits:         m.Body.VoluntaryExits,
+					SyncAggregate:          m.Body.SyncAggregate,
+					ExecutionPayloadHeader: header,
+					BLSToExecutionChanges:  m.Body.BLSToExecutionChanges,
+					BlobKzgCommitments:     m.Body.BlobKzgCommitments,
+				},
+			},
+			Signature: b.Deneb.SignedBlock.Signature,
+		}
+	}
+	if !blinded.Complete() {
+		return nil, errIncompleteBlock
+	}
+	return blinded, nil
+}
@@ -126,7 +126,7 @@ type ExecutionPayloadREST struct {
 	ExtraData     hexutil.Bytes   `json:"extra_data" ssz-size:"32"`
 	BaseFeePerGas U256Str         `json:"base_fee_per_gas" ssz-max:"32"`
 	BlockHash     Hash            `json:"block_hash" ssz-size:"32"`
-	Transactions  []hexutil.Bytes `json:"transactions"` // ssz-size/ssz-max:"2048"?
+	Transactions  []hexutil.Bytes `json:"transactions"`
 }
 
 // BlindedBeaconBlockBody https://github.com/ethereum/beacon-APIs/blob/master/types/bellatrix/block.yaml#L65
@@ -163,7 +163,7 @@ type RegisterValidatorRequestMessage struct {
 // SignedValidatorRegistration https://github.com/ethereum/beacon-APIs/blob/master/types/registration.yaml#L18
 type SignedValidatorRegistration struct {
 	Message   *RegisterValidatorRequestMessage `json:"message"`
-	Signature Signature                        `json:"signature"`
+	Signature Signature                        `json:"signature" ssz-size:"96"`
 }
 
 // BuilderBid https://github.com/ethereum/builder-specs/pull/2/files#diff-b37cbf48e8754483e30e7caaadc5defc8c3c6e1aaf3273ee188d787b7c75d993
@@ -188,7 +188,7 @@ type GetHeaderResponse struct {
 // SignedBlindedBeaconBlock https://github.com/ethereum/beacon-APIs/blob/master/types/bellatrix/block.yaml#L83
 type SignedBlindedBeaconBlock struct {
 	Message   *BlindedBeaconBlock `json:"message"`
-	Signature Signature           `json:"signature"`
+	Signature Signature           `json:"signature" ssz-size:"96"`
 }
 
 // GetPayloadResponse is the response payload from the getPayload request: https://github.com/ethereum/builder-specs/pull/2/files#diff-8446716b376f3ffe88737f9773ce2ff21adc2bc0f2c9a140dcc2e9d632091ba4
@@ -197,10 +197,68 @@ type GetPayloadResponse struct {
 	Data    *ExecutionPayloadREST `json:"data"`
 }
 
+// BidTrace https://flashbots.notion.site/Relay-API-Spec-5fb0819366954962bc02e81cb33840f5#286c858c4ba24e58ada6348d8d4b71ec
+type BidTrace struct {
+	Slot                 uint64    `json:"slot,string"`
+	ParentHash           Hash      `json:"parent_hash" ssz-size:"32"`
+	BlockHash            Hash      `json:"block_hash" ssz-size:"32"`
+	BuilderPubkey        PublicKey `json:"builder_pubkey" ssz-size:"48"`
+	ProposerPubkey       PublicKey `json:"proposer_pubkey" ssz-size:"48"`
+	ProposerFeeRecipient Address   `json:"proposer_fee_recipient" ssz-size:"20"`
+	GasLimit             uint64    `json:"gas_limit,string"`
+	GasUsed              uint64    `json:"gas_used,string"`
+	Value                U256Str   `json:"value" ssz-size:"32"`
+}
+
+// BidTraceV2 is a bid trace with block details, as given by the relay data API
+type BidTraceV2 struct {
+	BidTrace
+	BlockNumber uint64 `json:"block_number,string"`
+	NumTx       uint64 `json:"num_tx,string"`
+}
+
+// BidTraceV2WithTimestamp is a bid trace of a received block, as given by the relay data API
+type BidTraceV2WithTimestamp struct {
+	BidTraceV2
+	Timestamp int64 `json:"timestamp,string"`
+}
+
+// BuilderSubmitBlockRequest is the request payload of a builder submitting a block to the relay
+type BuilderSubmitBlockRequest struct {
+	Signature        Signature             `json:"signature"`
+	Message          *BidTrace             `json:"message"`
+	ExecutionPayload *ExecutionPayloadREST `json:"execution_payload"`
+}
+
+// BuilderGetValidatorsResponseEntry is an entry of the proposer duties the relay gives to builders
+type BuilderGetValidatorsResponseEntry struct {
+	Slot           uint64                       `json:"slot,string"`
+	ValidatorIndex uint64                       `json:"validator_index,string"`
+	Entry          *SignedValidatorRegistration `json:"entry"`
+}
+
 type transactions struct {
 	Transactions [][]byte `ssz-max:"1048576,1073741824"`
 }
 
+// executionPayload is the SSZ form of ExecutionPayloadREST: sszgen cannot encode lists of hexutil.Bytes
+type executionPayload struct {
+	ParentHash    Hash    `ssz-size:"32"`
+	FeeRecipient  Address `ssz-size:"20"`
+	StateRoot     Root    `ssz-size:"32"`
+	ReceiptsRoot  Root    `ssz-size:"32"`
+	LogsBloom     Bloom   `ssz-size:"256"`
+	Random        Hash    `ssz-size:"32"`
+	BlockNumber   uint64
+	GasLimit      uint64
+	GasUsed       uint64
+	Timestamp     uint64
+	ExtraData     hexutil.Bytes `ssz-max:"32"`
+	BaseFeePerGas U256Str       `ssz-size:"32"`
+	BlockHash     Hash          `ssz-size:"32"`
+	Transactions  [][]byte      `ssz-max:"1048576,1073741824"`
+}
+
 func PayloadToPayloadHeader(p *ExecutionPayloadV1) (*ExecutionPayloadHeader, error) {
 	txs := transactions{Transactions: p.Transactions}
 	txroot, err := txs.HashTreeRoot()
@@ -275,3 +333,65 @@ func RESTPayloadToELPayload(p *ExecutionPayloadREST) (*ExecutionPayloadV1, error
 		Transactions:  txs,
 	}, nil
 }
+
+// MarshalSSZ ssz marshals the ExecutionPayloadREST object
+func (p *ExecutionPayloadREST) MarshalSSZ() ([]byte, error) {
+	e := executionPayload{
+		ParentHash:    p.ParentHash,
+		FeeRecipient:  p.FeeRecipient,
+		StateRoot:     p.StateRoot,
+		ReceiptsRoot:  p.ReceiptsRoot,
+		LogsBloom:     p.LogsBloom,
+		Random:        p.Random,
+		BlockNumber:   p.BlockNumber,
+		GasLimit:      p.GasLimit,
+		GasUsed:       p.GasUsed,
+		Timestamp:     p.Timestamp,
+		ExtraData:     p.ExtraData,
+		BaseFeePerGas: p.BaseFeePerGas,
+		BlockHash:     p.BlockHash,
+		Transactions:  txsToSSZ(p.Transactions),
+	}
+	return e.MarshalSSZ()
+}
+
+// UnmarshalSSZ ssz unmarshals the ExecutionPayloadREST object
+func (p *ExecutionPayloadREST) UnmarshalSSZ(buf []byte) error {
+	var e executionPayload
+	if err := e.UnmarshalSSZ(buf); err != nil {
+		return err
+	}
+	*p = ExecutionPayloadREST{
+		ParentHash:    e.ParentHash,
+		FeeRecipient:  e.FeeRecipient,
+		StateRoot:     e.StateRoot,
+		ReceiptsRoot:  e.ReceiptsRoot,
+		LogsBloom:     e.LogsBloom,
+		Random:        e.Random,
+		BlockNumber:   e.BlockNumber,
+		GasLimit:      e.GasLimit,
+		GasUsed:       e.GasUsed,
+		Timestamp:     e.Timestamp,
+		ExtraData:     e.ExtraData,
+		BaseFeePerGas: e.BaseFeePerGas,
+		BlockHash:     e.BlockHash,
+		Transactions:  txsFromSSZ(e.Transactions),
+	}
+	return nil
+}
+
+func txsToSSZ(txs []hexutil.Bytes) [][]byte {
+	out := make([][]byte, len(txs))
+	for i, tx := range txs {
+		out[i] = []byte(tx)
+	}
+	return out
+}
+
+func txsFromSSZ(txs [][]byte) []hexutil.Bytes {
+	out := make([]hexutil.Bytes, len(txs))
+	for i, tx := range txs {
+		out[i] = hexutil.Bytes(tx)
+	}
+	return out
+}
@@ -0,0 +1,273 @@
+package types
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Withdrawal https://github.com/ethereum/consensus-specs/blob/dev/specs/capella/beacon-chain.md#withdrawal
+type Withdrawal struct {
+	Index          uint64  `json:"index,string"`
+	ValidatorIndex uint64  `json:"validator_index,string"`
+	Address        Address `json:"address" ssz-size:"20"`
+	Amount         uint64  `json:"amount,string"`
+}
+
+// BLSToExecutionChange https://github.com/ethereum/consensus-specs/blob/dev/specs/capella/beacon-chain.md#blstoexecutionchange
+type BLSToExecutionChange struct {
+	ValidatorIndex     uint64    `json:"validator_index,string"`
+	FromBLSPubkey      PublicKey `json:"from_bls_pubkey" ssz-size:"48"`
+	ToExecutionAddress Address   `json:"to_execution_address" ssz-size:"20"`
+}
+
+// SignedBLSToExecutionChange https://github.com/ethereum/consensus-specs/blob/dev/specs/capella/beacon-chain.md#signedblstoexecutionchange
+type SignedBLSToExecutionChange struct {
+	Message   *BLSToExecutionChange `json:"message"`
+	Signature Signature             `json:"signature" ssz-size:"96"`
+}
+
+// ExecutionPayloadHeaderCapella https://github.com/ethereum/consensus-specs/blob/dev/specs/capella/beacon-chain.md#executionpayloadheader
+type ExecutionPayloadHeaderCapella struct {
+	ParentHash       Hash          `json:"parent_hash" ssz-size:"32"`
+	FeeRecipient     Address       `json:"fee_recipient" ssz-size:"20"`
+	StateRoot        Root          `json:"state_root" ssz-size:"32"`
+	ReceiptsRoot     Root          `json:"receipts_root" ssz-size:"32"`
+	LogsBloom        Bloom         `json:"logs_bloom" ssz-size:"256"`
+	Random           Hash          `json:"prev_randao" ssz-size:"32"`
+	BlockNumber      uint64        `json:"block_number,string"`
+	GasLimit         uint64        `json:"gas_limit,string"`
+	GasUsed          uint64        `json:"gas_used,string"`
+	Timestamp        uint64        `json:"timestamp,string"`
+	ExtraData        hexutil.Bytes `json:"extra_data" ssz-max:"32"`
+	BaseFeePerGas    U256Str       `json:"base_fee_per_gas" ssz-size:"32"`
+	BlockHash        Hash          `json:"block_hash" ssz-size:"32"`
+	TransactionsRoot Root          `json:"transactions_root" ssz-size:"32"`
+	WithdrawalsRoot  Root          `json:"withdrawals_root" ssz-size:"32"`
+}
+
+// ExecutionPayloadCapella https://github.com/ethereum/consensus-specs/blob/dev/specs/capella/beacon-chain.md#executionpayload
+type ExecutionPayloadCapella struct {
+	ParentHash    Hash            `json:"parent_hash"`
+	FeeRecipient  Address         `json:"fee_recipient"`
+	StateRoot     Root            `json:"state_root"`
+	ReceiptsRoot  Root            `json:"receipts_root"`
+	LogsBloom     Bloom           `json:"logs_bloom"`
+	Random        Hash            `json:"prev_randao"`
+	BlockNumber   uint64          `json:"block_number,string"`
+	GasLimit      uint64          `json:"gas_limit,string"`
+	GasUsed       uint64          `json:"gas_used,string"`
+	Timestamp     uint64          `json:"timestamp,string"`
+	ExtraData     hexutil.Bytes   `json:"extra_data"`
+	BaseFeePerGas U256Str         `json:"base_fee_per_gas"`
+	BlockHash     Hash            `json:"block_hash"`
+	Transactions  []hexutil.Bytes `json:"transactions"`
+	Withdrawals   []*Withdrawal   `json:"withdrawals"`
+}
+
+// BlindedBeaconBlockBodyCapella https://github.com/ethereum/beacon-APIs/blob/master/types/capella/block.yaml
+type BlindedBeaconBlockBodyCapella struct {
+	RandaoReveal           Signature                      `json:"randao_reveal" ssz-size:"96"`
+	Eth1Data               *Eth1Data                      `json:"eth1_data"`
+	Graffiti               Hash                           `json:"graffiti" ssz-size:"32"`
+	ProposerSlashings      []*ProposerSlashing            `json:"proposer_slashings" ssz-max:"16"`
+	AttesterSlashings      []*AttesterSlashing            `json:"attester_slashings" ssz-max:"2"`
+	Attestations           []*Attestation                 `json:"attestations" ssz-max:"128"`
+	Deposits               []*Deposit                     `json:"deposits" ssz-max:"4"`
+	VoluntaryExits         []*VoluntaryExit               `json:"voluntary_exits" ssz-max:"16"`
+	SyncAggregate          *SyncAggregate                 `json:"sync_aggregate"`
+	ExecutionPayloadHeader *ExecutionPayloadHeaderCapella `json:"execution_payload_header"`
+	BLSToExecutionChanges  []*SignedBLSToExecutionChange  `json:"bls_to_execution_changes" ssz-max:"16"`
+}
+
+// BlindedBeaconBlockCapella https://github.com/ethereum/beacon-APIs/blob/master/types/capella/block.yaml
+type BlindedBeaconBlockCapella struct {
+	Slot          uint64                         `json:"slot,string"`
+	ProposerIndex uint64                         `json:"proposer_index,string"`
+	ParentRoot    Root                           `json:"parent_root" ssz-size:"32"`
+	StateRoot     Root                           `json:"state_root" ssz-size:"32"`
+	Body          *BlindedBeaconBlockBodyCapella `json:"body"`
+}
+
+// SignedBlindedBeaconBlockCapella https://github.com/ethereum/beacon-APIs/blob/master/types/capella/block.yaml
+type SignedBlindedBeaconBlockCapella struct {
+	Message   *BlindedBeaconBlockCapella `json:"message"`
+	Signature Signature                  `json:"signature" ssz-size:"96"`
+}
+
+// BuilderBidCapella https://github.com/ethereum/builder-specs/blob/main/specs/capella/builder.md#builderbid
+type BuilderBidCapella struct {
+	Header *ExecutionPayloadHeaderCapella `json:"header"`
+	Value  U256Str                        `json:"value" ssz-size:"32"`
+	Pubkey PublicKey                      `json:"pubkey" ssz-size:"48"`
+}
+
+// SignedBuilderBidCapella https://github.com/ethereum/builder-specs/blob/main/specs/capella/builder.md#signedbuilderbid
+type SignedBuilderBidCapella struct {
+	Message   *BuilderBidCapella `json:"message"`
+	Signature Signature          `json:"signature" ssz-size:"96"`
+}
+
+type withdrawals struct {
+	Withdrawals []*Withdrawal `ssz-max:"16"`
+}
+
+// executionPayloadCapella is the SSZ form of ExecutionPayloadCapella: sszgen cannot encode lists of hexutil.Bytes
+type executionPayloadCapella struct {
+	ParentHash    Hash    `ssz-size:"32"`
+	FeeRecipient  Address `ssz-size:"20"`
+	StateRoot     Root    `ssz-size:"32"`
+	ReceiptsRoot  Root    `ssz-size:"32"`
+	LogsBloom     Bloom   `ssz-size:"256"`
+	Random        Hash    `ssz-size:"32"`
+	BlockNumber   uint64
+	GasLimit      uint64
+	GasUsed       uint64
+	Timestamp     uint64
+	ExtraData     hexutil.Bytes `ssz-max:"32"`
+	BaseFeePerGas U256Str       `ssz-size:"32"`
+	BlockHash     Hash          `ssz-size:"32"`
+	Transactions  [][]byte      `ssz-max:"1048576,1073741824"`
+	Withdrawals   []*Withdrawal `ssz-max:"16"`
+}
+
+var (
+	errWithdrawals = errors.New("engine API V1 payloads cannot have withdrawals")
+	errBlobs       = errors.New("engine API V1 payloads cannot have blobs")
+)
+
+// PayloadToPayloadHeaderCapella gives the header of an engine API V1 payload with the withdrawals of the fork fields.
+func PayloadToPayloadHeaderCapella(p *ExecutionPayloadV1, f *PayloadForkFields) (*ExecutionPayloadHeaderCapella, error) {
+	h, err := PayloadToPayloadHeader(p)
+	if err != nil {
+		return nil, err
+	}
+	withdrawalsRoot, err := (&withdrawals{Withdrawals: f.withdrawals()}).HashTreeRoot()
+	if err != nil {
+		return nil, err
+	}
+	return &ExecutionPayloadHeaderCapella{
+		ParentHash:       h.ParentHash,
+		FeeRecipient:     h.FeeRecipient,
+		StateRoot:        h.StateRoot,
+		ReceiptsRoot:     h.ReceiptsRoot,
+		LogsBloom:        h.LogsBloom,
+		Random:           h.Random,
+		BlockNumber:      h.BlockNumber,
+		GasLimit:         h.GasLimit,
+		GasUsed:          h.GasUsed,
+		Timestamp:        h.Timestamp,
+		ExtraData:        h.ExtraData,
+		BaseFeePerGas:    h.BaseFeePerGas,
+		BlockHash:        h.BlockHash,
+		TransactionsRoot: h.TransactionsRoot,
+		WithdrawalsRoot:  withdrawalsRoot,
+	}, nil
+}
+
+// ELPayloadToCapellaPayload converts an engine API V1 payload with the withdrawals of the fork fields.
+func ELPayloadToCapellaPayload(p *ExecutionPayloadV1, f *PayloadForkFields) (*ExecutionPayloadCapella, error) {
+	r, err := ELPayloadToRESTPayload(p)
+	if err != nil {
+		return nil, err
+	}
+	ws := f.withdrawals()
+	if ws == nil {
+		ws = []*Withdrawal{}
+	}
+	return &ExecutionPayloadCapella{
+		ParentHash:    r.ParentHash,
+		FeeRecipient:  r.FeeRecipient,
+		StateRoot:     r.StateRoot,
+		ReceiptsRoot:  r.ReceiptsRoot,
+		LogsBloom:     r.LogsBloom,
+		Random:        r.Random,
+		BlockNumber:   r.BlockNumber,
+		GasLimit:      r.GasLimit,
+		GasUsed:       r.GasUsed,
+		Timestamp:     r.Timestamp,
+		ExtraData:     r.ExtraData,
+		BaseFeePerGas: r.BaseFeePerGas,
+		BlockHash:     r.BlockHash,
+		Transactions:  r.Transactions,
+		Withdrawals:   ws,
+	}, nil
+}
+
+// CapellaPayloadToELPayload converts the payload for the engine API V1, which only works without withdrawals.
+func CapellaPayloadToELPayload(p *ExecutionPayloadCapella) (*ExecutionPayloadV1, error) {
+	if len(p.Withdrawals) > 0 {
+		return nil, errWithdrawals
+	}
+	return RESTPayloadToELPayload(&ExecutionPayloadREST{
+		ParentHash:    p.ParentHash,
+		FeeRecipient:  p.FeeRecipient,
+		StateRoot:     p.StateRoot,
+		ReceiptsRoot:  p.ReceiptsRoot,
+		LogsBloom:     p.LogsBloom,
+		Random:        p.Random,
+		BlockNumber:   p.BlockNumber,
+		GasLimit:      p.GasLimit,
+		GasUsed:       p.GasUsed,
+		Timestamp:     p.Timestamp,
+		ExtraData:     p.ExtraData,
+		BaseFeePerGas: p.BaseFeePerGas,
+		BlockHash:     p.BlockHash,
+		Transactions:  p.Transactions,
+	})
+}
+
+// MarshalSSZ ssz marshals the ExecutionPayloadCapella object
+func (p *ExecutionPayloadCapella) MarshalSSZ() ([]byte, error) {
+	return p.toSSZ().MarshalSSZ()
+}
+
+// UnmarshalSSZ ssz unmarshals the ExecutionPayloadCapella object
+func (p *ExecutionPayloadCapella) UnmarshalSSZ(buf []byte) error {
+	var e executionPayloadCapella
+	if err := e.UnmarshalSSZ(buf); err != nil {
+		return err
+	}
+	p.fromSSZ(&e)
+	return nil
+}
+
+func (p *ExecutionPayloadCapella) toSSZ() *executionPayloadCapella {
+	return &executionPayloadCapella{
+		ParentHash:    p.ParentHash,
+		FeeRecipient:  p.FeeRecipient,
+		StateRoot:     p.StateRoot,
+		ReceiptsRoot:  p.ReceiptsRoot,
+		LogsBloom:     p.LogsBloom,
+		Random:        p.Random,
+		BlockNumber:   p.BlockNumber,
+		GasLimit:      p.GasLimit,
+		GasUsed:       p.GasUsed,
+		Timestamp:     p.Timestamp,
+		ExtraData:     p.ExtraData,
+		BaseFeePerGas: p.BaseFeePerGas,
+		BlockHash:     p.BlockHash,
+		Transactions:  txsToSSZ(p.Transactions),
+		Withdrawals:   p.Withdrawals,
+	}
+}
+
+func (p *ExecutionPayloadCapella) fromSSZ(e *executionPayloadCapella) {
+	*p = ExecutionPayloadCapella{
+		ParentHash:    e.ParentHash,
+		FeeRecipient:  e.FeeRecipient,
+		StateRoot:     e.StateRoot,
+		ReceiptsRoot:  e.ReceiptsRoot,
+		LogsBloom:     e.LogsBloom,
+		Random:        e.Random,
+		BlockNumber:   e.BlockNumber,
+		GasLimit:      e.GasLimit,
+		GasUsed:       e.GasUsed,
+		Timestamp:     e.Timestamp,
+		ExtraData:     e.ExtraData,
+		BaseFeePerGas: e.BaseFeePerGas,
+		BlockHash:     e.BlockHash,
+		Transactions:  txsFromSSZ(e.Transactions),
+		Withdrawals:   e.Withdrawals,
+	}
+}
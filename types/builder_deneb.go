@@ -0,0 +1,543 @@
+package types
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ExecutionPayloadHeaderDeneb https://github.com/ethereum/consensus-specs/blob/dev/specs/deneb/beacon-chain.md#executionpayloadheader
+type ExecutionPayloadHeaderDeneb struct {
+	ParentHash       Hash          `json:"parent_hash" ssz-size:"32"`
+	FeeRecipient     Address       `json:"fee_recipient" ssz-size:"20"`
+	StateRoot        Root          `json:"state_root" ssz-size:"32"`
+	ReceiptsRoot     Root          `json:"receipts_root" ssz-size:"32"`
+	LogsBloom        Bloom         `json:"logs_bloom" ssz-size:"256"`
+	Random           Hash          `json:"prev_randao" ssz-size:"32"`
+	BlockNumber      uint64        `json:"block_number,string"`
+	GasLimit         uint64        `json:"gas_limit,string"`
+	GasUsed          uint64        `json:"gas_used,string"`
+	Timestamp        uint64        `json:"timestamp,string"`
+	ExtraData        hexutil.Bytes `json:"extra_data" ssz-max:"32"`
+	BaseFeePerGas    U256Str       `json:"base_fee_per_gas" ssz-size:"32"`
+	BlockHash        Hash          `json:"block_hash" ssz-size:"32"`
+	TransactionsRoot Root          `json:"transactions_root" ssz-size:"32"`
+	WithdrawalsRoot  Root          `json:"withdrawals_root" ssz-size:"32"`
+	BlobGasUsed      uint64        `json:"blob_gas_used,string"`
+	ExcessBlobGas    uint64        `json:"excess_blob_gas,string"`
+}
+
+// ExecutionPayloadDeneb https://github.com/ethereum/consensus-specs/blob/dev/specs/deneb/beacon-chain.md#executionpayload
+type ExecutionPayloadDeneb struct {
+	ParentHash    Hash            `json:"parent_hash"`
+	FeeRecipient  Address         `json:"fee_recipient"`
+	StateRoot     Root            `json:"state_root"`
+	ReceiptsRoot  Root            `json:"receipts_root"`
+	LogsBloom     Bloom           `json:"logs_bloom"`
+	Random        Hash            `json:"prev_randao"`
+	BlockNumber   uint64          `json:"block_number,string"`
+	GasLimit      uint64          `json:"gas_limit,string"`
+	GasUsed       uint64          `json:"gas_used,string"`
+	Timestamp     uint64          `json:"timestamp,string"`
+	ExtraData     hexutil.Bytes   `json:"extra_data"`
+	BaseFeePerGas U256Str         `json:"base_fee_per_gas"`
+	BlockHash     Hash            `json:"block_hash"`
+	Transactions  []hexutil.Bytes `json:"transactions"`
+	Withdrawals   []*Withdrawal   `json:"withdrawals"`
+	BlobGasUsed   uint64          `json:"blob_gas_used,string"`
+	ExcessBlobGas uint64          `json:"excess_blob_gas,string"`
+}
+
+// BlobsBundle https://github.com/ethereum/builder-specs/blob/main/specs/deneb/builder.md#blobsbundle
+type BlobsBundle struct {
+	Commitments []KZGCommitment `json:"commitments"`
+	Proofs      []KZGProof      `json:"proofs"`
+	Blobs       []Blob          `json:"blobs"`
+}
+
+// ExecutionPayloadAndBlobsBundle https://github.com/ethereum/builder-specs/blob/main/specs/deneb/builder.md#executionpayloadandblobsbundle
+type ExecutionPayloadAndBlobsBundle struct {
+	ExecutionPayload *ExecutionPayloadDeneb `json:"execution_payload"`
+	BlobsBundle      *BlobsBundle           `json:"blobs_bundle"`
+}
+
+// BlindedBeaconBlockBodyDeneb https://github.com/ethereum/beacon-APIs/blob/master/types/deneb/block.yaml
+type BlindedBeaconBlockBodyDeneb struct {
+	RandaoReveal           Signature                     `json:"randao_reveal"`
+	Eth1Data               *Eth1Data                     `json:"eth1_data"`
+	Graffiti               Hash                          `json:"graffiti"`
+	ProposerSlashings      []*ProposerSlashing           `json:"proposer_slashings"`
+	AttesterSlashings      []*AttesterSlashing           `json:"attester_slashings"`
+	Attestations           []*Attestation                `json:"attestations"`
+	Deposits               []*Deposit                    `json:"deposits"`
+	VoluntaryExits         []*VoluntaryExit              `json:"voluntary_exits"`
+	SyncAggregate          *SyncAggregate                `json:"sync_aggregate"`
+	ExecutionPayloadHeader *ExecutionPayloadHeaderDeneb  `json:"execution_payload_header"`
+	BLSToExecutionChanges  []*SignedBLSToExecutionChange `json:"bls_to_execution_changes"`
+	BlobKzgCommitments     []KZGCommitment               `json:"blob_kzg_commitments"`
+}
+
+// BlindedBeaconBlockDeneb https://github.com/ethereum/beacon-APIs/blob/master/types/deneb/block.yaml
+type BlindedBeaconBlockDeneb struct {
+	Slot          uint64                       `json:"slot,string"`
+	ProposerIndex uint64                       `json:"proposer_index,string"`
+	ParentRoot    Root                         `json:"parent_root"`
+	StateRoot     Root                         `json:"state_root"`
+	Body          *BlindedBeaconBlockBodyDeneb `json:"body"`
+}
+
+// SignedBlindedBeaconBlockDeneb https://github.com/ethereum/beacon-APIs/blob/master/types/deneb/block.yaml
+type SignedBlindedBeaconBlockDeneb struct {
+	Message   *BlindedBeaconBlockDeneb `json:"message"`
+	Signature Signature                `json:"signature"`
+}
+
+// BuilderBidDeneb https://github.com/ethereum/builder-specs/blob/main/specs/deneb/builder.md#builderbid
+type BuilderBidDeneb struct {
+	Header             *ExecutionPayloadHeaderDeneb `json:"header"`
+	BlobKzgCommitments []KZGCommitment              `json:"blob_kzg_commitments"`
+	Value              U256Str                      `json:"value"`
+	Pubkey             PublicKey                    `json:"pubkey"`
+}
+
+// SignedBuilderBidDeneb https://github.com/ethereum/builder-specs/blob/main/specs/deneb/builder.md#signedbuilderbid
+type SignedBuilderBidDeneb struct {
+	Message   *BuilderBidDeneb `json:"message"`
+	Signature Signature        `json:"signature"`
+}
+
+// executionPayloadDeneb is the SSZ form of ExecutionPayloadDeneb: sszgen cannot encode lists of hexutil.Bytes
+type executionPayloadDeneb struct {
+	ParentHash    Hash    `ssz-size:"32"`
+	FeeRecipient  Address `ssz-size:"20"`
+	StateRoot     Root    `ssz-size:"32"`
+	ReceiptsRoot  Root    `ssz-size:"32"`
+	LogsBloom     Bloom   `ssz-size:"256"`
+	Random        Hash    `ssz-size:"32"`
+	BlockNumber   uint64
+	GasLimit      uint64
+	GasUsed       uint64
+	Timestamp     uint64
+	ExtraData     hexutil.Bytes `ssz-max:"32"`
+	BaseFeePerGas U256Str       `ssz-size:"32"`
+	BlockHash     Hash          `ssz-size:"32"`
+	Transactions  [][]byte      `ssz-max:"1048576,1073741824"`
+	Withdrawals   []*Withdrawal `ssz-max:"16"`
+	BlobGasUsed   uint64
+	ExcessBlobGas uint64
+}
+
+var errMissingField = errors.New("missing field")
+
+// blobsBundle is the SSZ form of BlobsBundle: sszgen cannot encode lists of named byte arrays
+type blobsBundle struct {
+	Commitments [][]byte `ssz-size:"?,48" ssz-max:"4096"`
+	Proofs      [][]byte `ssz-size:"?,48" ssz-max:"4096"`
+	Blobs       [][]byte `ssz-size:"?,131072" ssz-max:"4096"`
+}
+
+type executionPayloadAndBlobsBundle struct {
+	ExecutionPayload *executionPayloadDeneb
+	BlobsBundle      *blobsBundle
+}
+
+type blindedBeaconBlockBodyDeneb struct {
+	RandaoReveal           Signature `ssz-size:"96"`
+	Eth1Data               *Eth1Data
+	Graffiti               Hash                `ssz-size:"32"`
+	ProposerSlashings      []*ProposerSlashing `ssz-max:"16"`
+	AttesterSlashings      []*AttesterSlashing `ssz-max:"2"`
+	Attestations           []*Attestation      `ssz-max:"128"`
+	Deposits               []*Deposit          `ssz-max:"4"`
+	VoluntaryExits         []*VoluntaryExit    `ssz-max:"16"`
+	SyncAggregate          *SyncAggregate
+	ExecutionPayloadHeader *ExecutionPayloadHeaderDeneb
+	BLSToExecutionChanges  []*SignedBLSToExecutionChange `ssz-max:"16"`
+	BlobKzgCommitments     [][]byte                      `ssz-size:"?,48" ssz-max:"4096"`
+}
+
+type blindedBeaconBlockDeneb struct {
+	Slot          uint64
+	ProposerIndex uint64
+	ParentRoot    Root `ssz-size:"32"`
+	StateRoot     Root `ssz-size:"32"`
+	Body          *blindedBeaconBlockBodyDeneb
+}
+
+type signedBlindedBeaconBlockDeneb struct {
+	Message   *blindedBeaconBlockDeneb
+	Signature Signature `ssz-size:"96"`
+}
+
+type builderBidDeneb struct {
+	Header             *ExecutionPayloadHeaderDeneb
+	BlobKzgCommitments [][]byte  `ssz-size:"?,48" ssz-max:"4096"`
+	Value              U256Str   `ssz-size:"32"`
+	Pubkey             PublicKey `ssz-size:"48"`
+}
+
+type signedBuilderBidDeneb struct {
+	Message   *builderBidDeneb
+	Signature Signature `ssz-size:"96"`
+}
+
+// PayloadForkFields are the parts of a Capella or Deneb payload that an engine API V1 payload does not have.
+// Without them, a payload has no withdrawals, no blob gas and no blobs.
+type PayloadForkFields struct {
+	Withdrawals   []*Withdrawal
+	BlobGasUsed   uint64
+	ExcessBlobGas uint64
+	BlobsBundle   *BlobsBundle
+}
+
+func (f *PayloadForkFields) withdrawals() []*Withdrawal {
+	if f == nil {
+		return nil
+	}
+	return f.Withdrawals
+}
+
+func (f *PayloadForkFields) blobGas() (used, excess uint64) {
+	if f == nil {
+		return 0, 0
+	}
+	return f.BlobGasUsed, f.ExcessBlobGas
+}
+
+func (f *PayloadForkFields) blobsBundle() *BlobsBundle {
+	if f == nil || f.BlobsBundle == nil {
+		return &BlobsBundle{Commitments: []KZGCommitment{}, Proofs: []KZGProof{}, Blobs: []Blob{}}
+	}
+	return f.BlobsBundle
+}
+
+// BlobKzgCommitments are the commitments of the blobs of the payload, for its bid and blinded block.
+func (f *PayloadForkFields) BlobKzgCommitments() []KZGCommitment {
+	return f.blobsBundle().Commitments
+}
+
+// PayloadToPayloadHeaderDeneb gives the header of an engine API V1 payload with the fields of Deneb.
+func PayloadToPayloadHeaderDeneb(p *ExecutionPayloadV1, f *PayloadForkFields) (*ExecutionPayloadHeaderDeneb, error) {
+	h, err := PayloadToPayloadHeaderCapella(p, f)
+	if err != nil {
+		return nil, err
+	}
+	blobGasUsed, excessBlobGas := f.blobGas()
+	return &ExecutionPayloadHeaderDeneb{
+		ParentHash:       h.ParentHash,
+		FeeRecipient:     h.FeeRecipient,
+		StateRoot:        h.StateRoot,
+		ReceiptsRoot:     h.ReceiptsRoot,
+		LogsBloom:        h.LogsBloom,
+		Random:           h.Random,
+		BlockNumber:      h.BlockNumber,
+		GasLimit:         h.GasLimit,
+		GasUsed:          h.GasUsed,
+		Timestamp:        h.Timestamp,
+		ExtraData:        h.ExtraData,
+		BaseFeePerGas:    h.BaseFeePerGas,
+		BlockHash:        h.BlockHash,
+		TransactionsRoot: h.TransactionsRoot,
+		WithdrawalsRoot:  h.WithdrawalsRoot,
+		BlobGasUsed:      blobGasUsed,
+		ExcessBlobGas:    excessBlobGas,
+	}, nil
+}
+
+// ELPayloadToDenebPayload converts an engine API V1 payload with the fields of Deneb, with its blobs bundle.
+func ELPayloadToDenebPayload(p *ExecutionPayloadV1, f *PayloadForkFields) (*ExecutionPayloadAndBlobsBundle, error) {
+	c, err := ELPayloadToCapellaPayload(p, f)
+	if err != nil {
+		return nil, err
+	}
+	blobGasUsed, excessBlobGas := f.blobGas()
+	return &ExecutionPayloadAndBlobsBundle{
+		ExecutionPayload: &ExecutionPayloadDeneb{
+			ParentHash:    c.ParentHash,
+			FeeRecipient:  c.FeeRecipient,
+			StateRoot:     c.StateRoot,
+			ReceiptsRoot:  c.ReceiptsRoot,
+			LogsBloom:     c.LogsBloom,
+			Random:        c.Random,
+			BlockNumber:   c.BlockNumber,
+			GasLimit:      c.GasLimit,
+			GasUsed:       c.GasUsed,
+			Timestamp:     c.Timestamp,
+			ExtraData:     c.ExtraData,
+			BaseFeePerGas: c.BaseFeePerGas,
+			BlockHash:     c.BlockHash,
+			Transactions:  c.Transactions,
+			Withdrawals:   c.Withdrawals,
+			BlobGasUsed:   blobGasUsed,
+			ExcessBlobGas: excessBlobGas,
+		},
+		BlobsBundle: f.blobsBundle(),
+	}, nil
+}
+
+// DenebPayloadToELPayload converts the payload for the engine API V1, which only works without withdrawals and blobs.
+func DenebPayloadToELPayload(p *ExecutionPayloadDeneb) (*ExecutionPayloadV1, error) {
+	if p.BlobGasUsed != 0 {
+		return nil, errBlobs
+	}
+	return CapellaPayloadToELPayload(&ExecutionPayloadCapella{
+		ParentHash:    p.ParentHash,
+		FeeRecipient:  p.FeeRecipient,
+		StateRoot:     p.StateRoot,
+		ReceiptsRoot:  p.ReceiptsRoot,
+		LogsBloom:     p.LogsBloom,
+		Random:        p.Random,
+		BlockNumber:   p.BlockNumber,
+		GasLimit:      p.GasLimit,
+		GasUsed:       p.GasUsed,
+		Timestamp:     p.Timestamp,
+		ExtraData:     p.ExtraData,
+		BaseFeePerGas: p.BaseFeePerGas,
+		BlockHash:     p.BlockHash,
+		Transactions:  p.Transactions,
+		Withdrawals:   p.Withdrawals,
+	})
+}
+
+// MarshalSSZ ssz marshals the ExecutionPayloadAndBlobsBundle object
+func (p *ExecutionPayloadAndBlobsBundle) MarshalSSZ() ([]byte, error) {
+	if p.ExecutionPayload == nil || p.BlobsBundle == nil {
+		return nil, errMissingField
+	}
+	return (&executionPayloadAndBlobsBundle{
+		ExecutionPayload: p.ExecutionPayload.toSSZ(),
+		BlobsBundle:      p.BlobsBundle.toSSZ(),
+	}).MarshalSSZ()
+}
+
+// UnmarshalSSZ ssz unmarshals the ExecutionPayloadAndBlobsBundle object
+func (p *ExecutionPayloadAndBlobsBundle) UnmarshalSSZ(buf []byte) error {
+	var e executionPayloadAndBlobsBundle
+	if err := e.UnmarshalSSZ(buf); err != nil {
+		return err
+	}
+	p.ExecutionPayload = new(ExecutionPayloadDeneb)
+	p.ExecutionPayload.fromSSZ(e.ExecutionPayload)
+	p.BlobsBundle = new(BlobsBundle)
+	p.BlobsBundle.fromSSZ(e.BlobsBundle)
+	return nil
+}
+
+// HashTreeRoot ssz hashes the BuilderBidDeneb object
+func (b *BuilderBidDeneb) HashTreeRoot() ([32]byte, error) {
+	return b.toSSZ().HashTreeRoot()
+}
+
+// MarshalSSZ ssz marshals the SignedBuilderBidDeneb object
+func (b *SignedBuilderBidDeneb) MarshalSSZ() ([]byte, error) {
+	if b.Message == nil {
+		return nil, errMissingField
+	}
+	return (&signedBuilderBidDeneb{Message: b.Message.toSSZ(), Signature: b.Signature}).MarshalSSZ()
+}
+
+// UnmarshalSSZ ssz unmarshals the SignedBuilderBidDeneb object
+func (b *SignedBuilderBidDeneb) UnmarshalSSZ(buf []byte) error {
+	var e signedBuilderBidDeneb
+	if err := e.UnmarshalSSZ(buf); err != nil {
+		return err
+	}
+	*b = SignedBuilderBidDeneb{
+		Message: &BuilderBidDeneb{
+			Header:             e.Message.Header,
+			BlobKzgCommitments: commitmentsFromSSZ(e.Message.BlobKzgCommitments),
+			Value:              e.Message.Value,
+			Pubkey:             e.Message.Pubkey,
+		},
+		Signature: e.Signature,
+	}
+	return nil
+}
+
+// HashTreeRoot ssz hashes the BlindedBeaconBlockDeneb object
+func (b *BlindedBeaconBlockDeneb) HashTreeRoot() ([32]byte, error) {
+	e, err := b.toSSZ()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return e.HashTreeRoot()
+}
+
+// HashTreeRoot ssz hashes the BlindedBeaconBlockBodyDeneb object
+func (b *BlindedBeaconBlockBodyDeneb) HashTreeRoot() ([32]byte, error) {
+	return b.toSSZ().HashTreeRoot()
+}
+
+// MarshalSSZ ssz marshals the SignedBlindedBeaconBlockDeneb object
+func (b *SignedBlindedBeaconBlockDeneb) MarshalSSZ() ([]byte, error) {
+	if b.Message == nil {
+		return nil, errMissingField
+	}
+	msg, err := b.Message.toSSZ()
+	if err != nil {
+		return nil, err
+	}
+	return (&signedBlindedBeaconBlockDeneb{Message: msg, Signature: b.Signature}).MarshalSSZ()
+}
+
+// UnmarshalSSZ ssz unmarshals the SignedBlindedBeaconBlockDeneb object
+func (b *SignedBlindedBeaconBlockDeneb) UnmarshalSSZ(buf []byte) error {
+	var e signedBlindedBeaconBlockDeneb
+	if err := e.UnmarshalSSZ(buf); err != nil {
+		return err
+	}
+	body := e.Message.Body
+	*b = SignedBlindedBeaconBlockDeneb{
+		Message: &BlindedBeaconBlockDeneb{
+			Slot:          e.Message.Slot,
+			ProposerIndex: e.Message.ProposerIndex,
+			ParentRoot:    e.Message.ParentRoot,
+			StateRoot:     e.Message.StateRoot,
+			Body: &BlindedBeaconBlockBodyDeneb{
+				RandaoReveal:           body.RandaoReveal,
+				Eth1Data:               body.Eth1Data,
+				Graffiti:               body.Graffiti,
+				ProposerSlashings:      body.ProposerSlashings,
+				AttesterSlashings:      body.AttesterSlashings,
+				Attestations:           body.Attestations,
+				Deposits:               body.Deposits,
+				VoluntaryExits:         body.VoluntaryExits,
+				SyncAggregate:          body.SyncAggregate,
+				ExecutionPayloadHeader: body.ExecutionPayloadHeader,
+				BLSToExecutionChanges:  body.BLSToExecutionChanges,
+				BlobKzgCommitments:     commitmentsFromSSZ(body.BlobKzgCommitments),
+			},
+		},
+		Signature: e.Signature,
+	}
+	return nil
+}
+
+func (b *BuilderBidDeneb) toSSZ() *builderBidDeneb {
+	return &builderBidDeneb{
+		Header:             b.Header,
+		BlobKzgCommitments: commitmentsToSSZ(b.BlobKzgCommitments),
+		Value:              b.Value,
+		Pubkey:             b.Pubkey,
+	}
+}
+
+func (b *BlindedBeaconBlockDeneb) toSSZ() (*blindedBeaconBlockDeneb, error) {
+	body := b.Body
+	if body == nil {
+		return nil, errMissingField
+	}
+	return &blindedBeaconBlockDeneb{
+		Slot:          b.Slot,
+		ProposerIndex: b.ProposerIndex,
+		ParentRoot:    b.ParentRoot,
+		StateRoot:     b.StateRoot,
+		Body:          body.toSSZ(),
+	}, nil
+}
+
+func (b *BlindedBeaconBlockBodyDeneb) toSSZ() *blindedBeaconBlockBodyDeneb {
+	return &blindedBeaconBlockBodyDeneb{
+		RandaoReveal:           b.RandaoReveal,
+		Eth1Data:               b.Eth1Data,
+		Graffiti:               b.Graffiti,
+		ProposerSlashings:      b.ProposerSlashings,
+		AttesterSlashings:      b.AttesterSlashings,
+		Attestations:           b.Attestations,
+		Deposits:               b.Deposits,
+		VoluntaryExits:         b.VoluntaryExits,
+		SyncAggregate:          b.SyncAggregate,
+		ExecutionPayloadHeader: b.ExecutionPayloadHeader,
+		BLSToExecutionChanges:  b.BLSToExecutionChanges,
+		BlobKzgCommitments:     commitmentsToSSZ(b.BlobKzgCommitments),
+	}
+}
+
+func (b *BlobsBundle) toSSZ() *blobsBundle {
+	e := &blobsBundle{
+		Commitments: commitmentsToSSZ(b.Commitments),
+		Proofs:      make([][]byte, len(b.Proofs)),
+		Blobs:       make([][]byte, len(b.Blobs)),
+	}
+	for i := range b.Proofs {
+		e.Proofs[i] = b.Proofs[i][:]
+	}
+	for i := range b.Blobs {
+		e.Blobs[i] = b.Blobs[i][:]
+	}
+	return e
+}
+
+func (b *BlobsBundle) fromSSZ(e *blobsBundle) {
+	*b = BlobsBundle{
+		Commitments: commitmentsFromSSZ(e.Commitments),
+		Proofs:      make([]KZGProof, len(e.Proofs)),
+		Blobs:       make([]Blob, len(e.Blobs)),
+	}
+	for i := range e.Proofs {
+		copy(b.Proofs[i][:], e.Proofs[i])
+	}
+	for i := range e.Blobs {
+		copy(b.Blobs[i][:], e.Blobs[i])
+	}
+}
+
+func commitmentsToSSZ(cs []KZGCommitment) [][]byte {
+	out := make([][]byte, len(cs))
+	for i := range cs {
+		out[i] = cs[i][:]
+	}
+	return out
+}
+
+func commitmentsFromSSZ(cs [][]byte) []KZGCommitment {
+	out := make([]KZGCommitment, len(cs))
+	for i := range cs {
+		copy(out[i][:], cs[i])
+	}
+	return out
+}
+
+func (p *ExecutionPayloadDeneb) toSSZ() *executionPayloadDeneb {
+	return &executionPayloadDeneb{
+		ParentHash:    p.ParentHash,
+		FeeRecipient:  p.FeeRecipient,
+		StateRoot:     p.StateRoot,
+		ReceiptsRoot:  p.ReceiptsRoot,
+		LogsBloom:     p.LogsBloom,
+		Random:        p.Random,
+		BlockNumber:   p.BlockNumber,
+		GasLimit:      p.GasLimit,
+		GasUsed:       p.GasUsed,
+		Timestamp:     p.Timestamp,
+		ExtraData:     p.ExtraData,
+		BaseFeePerGas: p.BaseFeePerGas,
+		BlockHash:     p.BlockHash,
+		Transactions:  txsToSSZ(p.Transactions),
+		Withdrawals:   p.Withdrawals,
+		BlobGasUsed:   p.BlobGasUsed,
+		ExcessBlobGas: p.ExcessBlobGas,
+	}
+}
+
+func (p *ExecutionPayloadDeneb) fromSSZ(e *executionPayloadDeneb) {
+	*p = ExecutionPayloadDeneb{
+		ParentHash:    e.ParentHash,
+		FeeRecipient:  e.FeeRecipient,
+		StateRoot:     e.StateRoot,
+		ReceiptsRoot:  e.ReceiptsRoot,
+		LogsBloom:     e.LogsBloom,
+		Random:        e.Random,
+		BlockNumber:   e.BlockNumber,
+		GasLimit:      e.GasLimit,
+		GasUsed:       e.GasUsed,
+		Timestamp:     e.Timestamp,
+		ExtraData:     e.ExtraData,
+		BaseFeePerGas: e.BaseFeePerGas,
+		BlockHash:     e.BlockHash,
+		Transactions:  txsFromSSZ(e.Transactions),
+		Withdrawals:   e.Withdrawals,
+		BlobGasUsed:   e.BlobGasUsed,
+		ExcessBlobGas: e.ExcessBlobGas,
+	}
+}
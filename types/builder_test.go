@@ -233,6 +233,14 @@ func TestExecutionPayloadREST(t *testing.T) {
 	clMsg, err := ELPayloadToRESTPayload(elMsg)
 	require.NoError(t, err)
 	require.Equal(t, msg, clMsg)
+
+	// SSZ roundtrip
+	b, err = msg.MarshalSSZ()
+	require.NoError(t, err)
+	msg3 := new(ExecutionPayloadREST)
+	err = msg3.UnmarshalSSZ(b)
+	require.NoError(t, err)
+	require.Equal(t, msg, msg3)
 }
 
 func TestExecutionPayloadV1(t *testing.T) {
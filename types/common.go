@@ -158,6 +158,28 @@ func (h Hash) String() string {
 	return hexutil.Bytes(h[:]).String()
 }
 
+type ForkVersion [4]byte
+
+func (v ForkVersion) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(v[:]).MarshalText()
+}
+
+func (v *ForkVersion) UnmarshalText(input []byte) error {
+	var b hexutil.Bytes
+	if err := b.UnmarshalText(input); err != nil {
+		return err
+	}
+	if len(b) != 4 {
+		return ErrLength
+	}
+	copy(v[:], b)
+	return nil
+}
+
+func (v ForkVersion) String() string {
+	return hexutil.Bytes(v[:]).String()
+}
+
 type CommitteeBits [64]byte
 
 func (c CommitteeBits) MarshalText() ([]byte, error) {
@@ -227,6 +249,120 @@ func (b *Bloom) FromSlice(x []byte) {
 	copy(b[:], x)
 }
 
+type KZGCommitment [48]byte
+
+func (c KZGCommitment) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(c[:]).MarshalText()
+}
+
+func (c *KZGCommitment) UnmarshalJSON(input []byte) error {
+	b := hexutil.Bytes(c[:])
+	if err := b.UnmarshalJSON(input); err != nil {
+		return err
+	}
+	if len(b) != 48 {
+		return ErrLength
+	}
+	c.FromSlice(b)
+	return nil
+}
+
+func (c *KZGCommitment) UnmarshalText(input []byte) error {
+	b := hexutil.Bytes(c[:])
+	if err := b.UnmarshalText(input); err != nil {
+		return err
+	}
+	if len(b) != 48 {
+		return ErrLength
+	}
+	c.FromSlice(b)
+	return nil
+}
+
+func (c KZGCommitment) String() string {
+	return hexutil.Bytes(c[:]).String()
+}
+
+func (c *KZGCommitment) FromSlice(x []byte) {
+	copy(c[:], x)
+}
+
+type KZGProof [48]byte
+
+func (p KZGProof) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(p[:]).MarshalText()
+}
+
+func (p *KZGProof) UnmarshalJSON(input []byte) error {
+	b := hexutil.Bytes(p[:])
+	if err := b.UnmarshalJSON(input); err != nil {
+		return err
+	}
+	if len(b) != 48 {
+		return ErrLength
+	}
+	p.FromSlice(b)
+	return nil
+}
+
+func (p *KZGProof) UnmarshalText(input []byte) error {
+	b := hexutil.Bytes(p[:])
+	if err := b.UnmarshalText(input); err != nil {
+		return err
+	}
+	if len(b) != 48 {
+		return ErrLength
+	}
+	p.FromSlice(b)
+	return nil
+}
+
+func (p KZGProof) String() string {
+	return hexutil.Bytes(p[:]).String()
+}
+
+func (p *KZGProof) FromSlice(x []byte) {
+	copy(p[:], x)
+}
+
+type Blob [131072]byte
+
+func (b Blob) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(b[:]).MarshalText()
+}
+
+func (b *Blob) UnmarshalJSON(input []byte) error {
+	buf := hexutil.Bytes(b[:])
+	if err := buf.UnmarshalJSON(input); err != nil {
+		return err
+	}
+	if len(buf) != 131072 {
+		return ErrLength
+	}
+	b.FromSlice(buf)
+	return nil
+}
+
+func (b *Blob) UnmarshalText(input []byte) error {
+	buf := hexutil.Bytes(b[:])
+	if err := buf.UnmarshalText(input); err != nil {
+		return err
+	}
+	if len(buf) != 131072 {
+		return ErrLength
+	}
+	b.FromSlice(buf)
+	return nil
+}
+
+func (b Blob) String() string {
+	return hexutil.Bytes(b[:]).String()
+}
+
+func (b *Blob) FromSlice(x []byte) {
+	copy(b[:], x)
+}
+
 type U256Str Hash // encodes/decodes to string, not hex
 
 func (n U256Str) MarshalText() ([]byte, error) {
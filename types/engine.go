@@ -111,6 +111,142 @@ type ForkchoiceUpdatedResult struct {
 	PayloadID     *PayloadID      `json:"payloadId"`
 }
 
+// GetPayloadV2Response is the response of engine_getPayloadV2 for a payload without withdrawals, with the value
+// of the block to its fee recipient.
+type GetPayloadV2Response struct {
+	ExecutionPayload *ExecutionPayloadV1 `json:"executionPayload"`
+	BlockValue       *hexutil.Big        `json:"blockValue"`
+}
+
+// WithdrawalV1 is a withdrawal in the engine API, with hex quantities unlike in the beacon API.
+type WithdrawalV1 struct {
+	Index          hexutil.Uint64 `json:"index"`
+	ValidatorIndex hexutil.Uint64 `json:"validatorIndex"`
+	Address        common.Address `json:"address"`
+	Amount         hexutil.Uint64 `json:"amount"`
+}
+
+// ToWithdrawalsV1 converts beacon API withdrawals for the engine API.
+func ToWithdrawalsV1(ws []*Withdrawal) []*WithdrawalV1 {
+	out := make([]*WithdrawalV1, len(ws))
+	for i, w := range ws {
+		out[i] = &WithdrawalV1{
+			Index:          hexutil.Uint64(w.Index),
+			ValidatorIndex: hexutil.Uint64(w.ValidatorIndex),
+			Address:        common.Address(w.Address),
+			Amount:         hexutil.Uint64(w.Amount),
+		}
+	}
+	return out
+}
+
+// PayloadAttributesV3 are the payload attributes of engine_forkchoiceUpdatedV2, with withdrawals from Capella,
+// and of engine_forkchoiceUpdatedV3, with the parent beacon block root from Deneb.
+type PayloadAttributesV3 struct {
+	Timestamp             hexutil.Uint64  `json:"timestamp"`
+	PrevRandao            common.Hash     `json:"prevRandao"`
+	SuggestedFeeRecipient common.Address  `json:"suggestedFeeRecipient"`
+	Withdrawals           []*WithdrawalV1 `json:"withdrawals"`
+	ParentBeaconBlockRoot *common.Hash    `json:"parentBeaconBlockRoot,omitempty"`
+}
+
+// ExecutionPayloadV3 is a payload of engine_getPayloadV2 with withdrawals, and of engine_getPayloadV3 with blob gas.
+type ExecutionPayloadV3 struct {
+	ParentHash    common.Hash     `json:"parentHash"`
+	FeeRecipient  common.Address  `json:"feeRecipient"`
+	StateRoot     common.Hash     `json:"stateRoot"`
+	ReceiptsRoot  common.Hash     `json:"receiptsRoot"`
+	LogsBloom     types.Bloom     `json:"logsBloom"`
+	Random        common.Hash     `json:"prevRandao"`
+	Number        hexutil.Uint64  `json:"blockNumber"`
+	GasLimit      hexutil.Uint64  `json:"gasLimit"`
+	GasUsed       hexutil.Uint64  `json:"gasUsed"`
+	Timestamp     hexutil.Uint64  `json:"timestamp"`
+	ExtraData     hexutil.Bytes   `json:"extraData"`
+	BaseFeePerGas *hexutil.Big    `json:"baseFeePerGas"`
+	BlockHash     common.Hash     `json:"blockHash"`
+	Transactions  []hexutil.Bytes `json:"transactions"`
+	Withdrawals   []*WithdrawalV1 `json:"withdrawals"`
+	BlobGasUsed   *hexutil.Uint64 `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas *hexutil.Uint64 `json:"excessBlobGas,omitempty"`
+}
+
+// BlobsBundleV1 is the blobs bundle of engine_getPayloadV3.
+type BlobsBundleV1 struct {
+	Commitments []hexutil.Bytes `json:"commitments"`
+	Proofs      []hexutil.Bytes `json:"proofs"`
+	Blobs       []hexutil.Bytes `json:"blobs"`
+}
+
+// GetPayloadV3Response is the response of engine_getPayloadV2 for a payload with withdrawals, and of
+// engine_getPayloadV3 with the blobs bundle too.
+type GetPayloadV3Response struct {
+	ExecutionPayload *ExecutionPayloadV3 `json:"executionPayload"`
+	BlockValue       *hexutil.Big        `json:"blockValue"`
+	BlobsBundle      *BlobsBundleV1      `json:"blobsBundle,omitempty"`
+}
+
+// Split returns the engine API V1 part of the payload, and the fields of its fork with the blobs bundle.
+func (r *GetPayloadV3Response) Split() (*ExecutionPayloadV1, *PayloadForkFields, error) {
+	p := r.ExecutionPayload
+	if p == nil || p.BaseFeePerGas == nil {
+		return nil, nil, errMissingField
+	}
+	payload := &ExecutionPayloadV1{
+		ParentHash:    p.ParentHash,
+		FeeRecipient:  p.FeeRecipient,
+		StateRoot:     p.StateRoot,
+		ReceiptsRoot:  p.ReceiptsRoot,
+		LogsBloom:     p.LogsBloom,
+		Random:        p.Random,
+		Number:        uint64(p.Number),
+		GasLimit:      uint64(p.GasLimit),
+		GasUsed:       uint64(p.GasUsed),
+		Timestamp:     uint64(p.Timestamp),
+		ExtraData:     p.ExtraData,
+		BaseFeePerGas: p.BaseFeePerGas.ToInt(),
+		BlockHash:     p.BlockHash,
+		Transactions:  make([][]byte, len(p.Transactions)),
+	}
+	for i, tx := range p.Transactions {
+		payload.Transactions[i] = tx
+	}
+	f := &PayloadForkFields{Withdrawals: make([]*Withdrawal, len(p.Withdrawals))}
+	for i, w := range p.Withdrawals {
+		f.Withdrawals[i] = &Withdrawal{
+			Index:          uint64(w.Index),
+			ValidatorIndex: uint64(w.ValidatorIndex),
+			Address:        Address(w.Address),
+			Amount:         uint64(w.Amount),
+		}
+	}
+	if p.BlobGasUsed != nil {
+		f.BlobGasUsed = uint64(*p.BlobGasUsed)
+	}
+	if p.ExcessBlobGas != nil {
+		f.ExcessBlobGas = uint64(*p.ExcessBlobGas)
+	}
+	if b := r.BlobsBundle; b != nil {
+		if len(b.Proofs) != len(b.Commitments) || len(b.Blobs) != len(b.Commitments) {
+			return nil, nil, fmt.Errorf("blobs bundle has %d commitments, %d proofs and %d blobs", len(b.Commitments), len(b.Proofs), len(b.Blobs))
+		}
+		f.BlobsBundle = &BlobsBundle{
+			Commitments: make([]KZGCommitment, len(b.Commitments)),
+			Proofs:      make([]KZGProof, len(b.Proofs)),
+			Blobs:       make([]Blob, len(b.Blobs)),
+		}
+		for i := range b.Commitments {
+			if len(b.Commitments[i]) != len(KZGCommitment{}) || len(b.Proofs[i]) != len(KZGProof{}) || len(b.Blobs[i]) != len(Blob{}) {
+				return nil, nil, fmt.Errorf("blob %d of the bundle has a wrong size", i)
+			}
+			copy(f.BlobsBundle.Commitments[i][:], b.Commitments[i])
+			copy(f.BlobsBundle.Proofs[i][:], b.Proofs[i])
+			copy(f.BlobsBundle.Blobs[i][:], b.Blobs[i])
+		}
+	}
+	return payload, f, nil
+}
+
 func decodeTransactions(enc [][]byte) ([]*types.Transaction, error) {
 	var txs = make([]*types.Transaction, len(enc))
 	for i, encTx := range enc {
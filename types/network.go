@@ -0,0 +1,71 @@
+package types
+
+import "fmt"
+
+// Network holds the fork versions that signing domains are computed with.
+// Fork epochs are set separately, the mocks start their own chain at genesis.
+type Network struct {
+	Name                 string
+	GenesisForkVersion   ForkVersion `yaml:"GENESIS_FORK_VERSION"`
+	BellatrixForkVersion ForkVersion `yaml:"BELLATRIX_FORK_VERSION"`
+	CapellaForkVersion   ForkVersion `yaml:"CAPELLA_FORK_VERSION"`
+	DenebForkVersion     ForkVersion `yaml:"DENEB_FORK_VERSION"`
+}
+
+var (
+	Mainnet = Network{
+		Name:                 "mainnet",
+		GenesisForkVersion:   ForkVersion{0x00, 0x00, 0x00, 0x00},
+		BellatrixForkVersion: ForkVersion{0x02, 0x00, 0x00, 0x00},
+		CapellaForkVersion:   ForkVersion{0x03, 0x00, 0x00, 0x00},
+		DenebForkVersion:     ForkVersion{0x04, 0x00, 0x00, 0x00},
+	}
+	Sepolia = Network{
+		Name:                 "sepolia",
+		GenesisForkVersion:   ForkVersion{0x90, 0x00, 0x00, 0x69},
+		BellatrixForkVersion: ForkVersion{0x90, 0x00, 0x00, 0x71},
+		CapellaForkVersion:   ForkVersion{0x90, 0x00, 0x00, 0x72},
+		DenebForkVersion:     ForkVersion{0x90, 0x00, 0x00, 0x73},
+	}
+	Holesky = Network{
+		Name:                 "holesky",
+		GenesisForkVersion:   ForkVersion{0x01, 0x01, 0x70, 0x00},
+		BellatrixForkVersion: ForkVersion{0x03, 0x01, 0x70, 0x00},
+		CapellaForkVersion:   ForkVersion{0x04, 0x01, 0x70, 0x00},
+		DenebForkVersion:     ForkVersion{0x05, 0x01, 0x70, 0x00},
+	}
+
+	Networks = map[string]*Network{
+		Mainnet.Name: &Mainnet,
+		Sepolia.Name: &Sepolia,
+		Holesky.Name: &Holesky,
+	}
+)
+
+// ForkVersion returns the fork version of the given fork name.
+func (n *Network) ForkVersion(version string) (ForkVersion, error) {
+	switch version {
+	case VersionBellatrix:
+		return n.BellatrixForkVersion, nil
+	case VersionCapella:
+		return n.CapellaForkVersion, nil
+	case VersionDeneb:
+		return n.DenebForkVersion, nil
+	default:
+		return ForkVersion{}, fmt.Errorf("unknown fork version %q", version)
+	}
+}
+
+// BuilderDomain is the domain of builder API messages: the genesis fork version and a zero genesis validators root.
+func (n *Network) BuilderDomain() Domain {
+	return ComputeDomain(DomainTypeAppBuilder, n.GenesisForkVersion, nil)
+}
+
+// ProposerDomain is the domain of blocks proposed in the given fork.
+func (n *Network) ProposerDomain(version string, genesisValidatorsRoot *Root) (Domain, error) {
+	forkVersion, err := n.ForkVersion(version)
+	if err != nil {
+		return Domain{}, err
+	}
+	return ComputeDomain(DomainTypeBeaconProposer, forkVersion, genesisValidatorsRoot), nil
+}
@@ -28,15 +28,15 @@ type SigningData struct {
 }
 
 type forkData struct {
-	CurrentVersion        uint32
-	GenesisValidatorsRoot Root `ssz-size:"32"`
+	CurrentVersion        ForkVersion `ssz-size:"4"`
+	GenesisValidatorsRoot Root        `ssz-size:"32"`
 }
 
 type HashTreeRoot interface {
 	HashTreeRoot() ([32]byte, error)
 }
 
-func ComputeDomain(dt DomainType, forkVersion uint32, genesisValidatorsRoot *Root) [32]byte {
+func ComputeDomain(dt DomainType, forkVersion ForkVersion, genesisValidatorsRoot *Root) [32]byte {
 	if genesisValidatorsRoot == nil {
 		var tmp Root
 		genesisValidatorsRoot = &tmp
@@ -54,7 +54,7 @@ func ComputeDomain(dt DomainType, forkVersion uint32, genesisValidatorsRoot *Roo
 }
 
 func ComputeApplicationDomain(dt DomainType) [32]byte {
-	return ComputeDomain(dt, 0, nil)
+	return ComputeDomain(dt, ForkVersion{}, nil)
 }
 
 func ComputeSigningRoot(obj HashTreeRoot, d Domain) ([32]byte, error) {
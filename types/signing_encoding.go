@@ -1,5 +1,5 @@
 // Code generated by fastssz. DO NOT EDIT.
-// Hash: 4b4f62c057de9acca5c636a4fd607d2ade0ea5fe70aea930bb560a07aa033995
+// Hash: 1d3547be7c582c909da849eef6ff42d857662a474b22174e154458ce445603fa
 package types
 
 import (
@@ -76,7 +76,7 @@ func (f *forkData) MarshalSSZTo(buf []byte) (dst []byte, err error) {
 	dst = buf
 
 	// Field (0) 'CurrentVersion'
-	dst = ssz.MarshalUint32(dst, f.CurrentVersion)
+	dst = append(dst, f.CurrentVersion[:]...)
 
 	// Field (1) 'GenesisValidatorsRoot'
 	dst = append(dst, f.GenesisValidatorsRoot[:]...)
@@ -93,7 +93,7 @@ func (f *forkData) UnmarshalSSZ(buf []byte) error {
 	}
 
 	// Field (0) 'CurrentVersion'
-	f.CurrentVersion = ssz.UnmarshallUint32(buf[0:4])
+	copy(f.CurrentVersion[:], buf[0:4])
 
 	// Field (1) 'GenesisValidatorsRoot'
 	copy(f.GenesisValidatorsRoot[:], buf[4:36])
@@ -117,7 +117,7 @@ func (f *forkData) HashTreeRootWith(hh *ssz.Hasher) (err error) {
 	indx := hh.Index()
 
 	// Field (0) 'CurrentVersion'
-	hh.PutUint32(f.CurrentVersion)
+	hh.PutBytes(f.CurrentVersion[:])
 
 	// Field (1) 'GenesisValidatorsRoot'
 	hh.PutBytes(f.GenesisValidatorsRoot[:])
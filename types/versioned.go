@@ -0,0 +1,539 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Fork names, as in the version of builder API responses and the Eth-Consensus-Version header
+const (
+	VersionBellatrix = "bellatrix"
+	VersionCapella   = "capella"
+	VersionDeneb     = "deneb"
+)
+
+// ForkSchedule gives the fork of each slot. Forks that are not scheduled have epoch math.MaxUint64.
+type ForkSchedule struct {
+	SlotsPerEpoch uint64
+	CapellaEpoch  uint64
+	DenebEpoch    uint64
+}
+
+func (f *ForkSchedule) Version(slot uint64) string {
+	epoch := slot / f.SlotsPerEpoch
+	switch {
+	case epoch >= f.DenebEpoch:
+		return VersionDeneb
+	case epoch >= f.CapellaEpoch:
+		return VersionCapella
+	default:
+		return VersionBellatrix
+	}
+}
+
+var errIncomplete = errors.New("incomplete versioned object")
+
+// versioned is the JSON envelope of builder API responses
+type versioned struct {
+	Version string          `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func unsupportedVersion(version string) error {
+	return fmt.Errorf("unsupported version %q", version)
+}
+
+// VersionedSignedBuilderBid is a bid of any fork. The fork set in Version decides what is decoded,
+// while encoding uses the bid that is set, whatever the Version.
+type VersionedSignedBuilderBid struct {
+	Version   string
+	Bellatrix *SignedBuilderBid
+	Capella   *SignedBuilderBidCapella
+	Deneb     *SignedBuilderBidDeneb
+}
+
+func (b *VersionedSignedBuilderBid) data() (interface {
+	MarshalSSZ() ([]byte, error)
+}, error) {
+	switch {
+	case b.Bellatrix != nil && b.Bellatrix.Message != nil && b.Bellatrix.Message.Header != nil:
+		return b.Bellatrix, nil
+	case b.Capella != nil && b.Capella.Message != nil && b.Capella.Message.Header != nil:
+		return b.Capella, nil
+	case b.Deneb != nil && b.Deneb.Message != nil && b.Deneb.Message.Header != nil:
+		return b.Deneb, nil
+	}
+	return nil, errIncomplete
+}
+
+// Complete tells if the bid has a message and header.
+func (b *VersionedSignedBuilderBid) Complete() bool {
+	_, err := b.data()
+	return err == nil
+}
+
+// MarshalJSON encodes the bid in a getHeader response.
+func (b *VersionedSignedBuilderBid) MarshalJSON() ([]byte, error) {
+	data, err := b.data()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Version string `json:"version"`
+		Data    any    `json:"data"`
+	}{b.Version, data})
+}
+
+// UnmarshalJSON decodes the bid of a getHeader response.
+func (b *VersionedSignedBuilderBid) UnmarshalJSON(input []byte) error {
+	var v versioned
+	if err := json.Unmarshal(input, &v); err != nil {
+		return err
+	}
+	*b = VersionedSignedBuilderBid{Version: v.Version}
+	switch v.Version {
+	case VersionBellatrix:
+		return json.Unmarshal(v.Data, &b.Bellatrix)
+	case VersionCapella:
+		return json.Unmarshal(v.Data, &b.Capella)
+	case VersionDeneb:
+		return json.Unmarshal(v.Data, &b.Deneb)
+	}
+	return unsupportedVersion(v.Version)
+}
+
+func (b *VersionedSignedBuilderBid) MarshalSSZ() ([]byte, error) {
+	data, err := b.data()
+	if err != nil {
+		return nil, err
+	}
+	return data.MarshalSSZ()
+}
+
+// UnmarshalSSZ decodes a bid of the fork in Version.
+func (b *VersionedSignedBuilderBid) UnmarshalSSZ(buf []byte) error {
+	*b = VersionedSignedBuilderBid{Version: b.Version}
+	switch b.Version {
+	case VersionBellatrix:
+		b.Bellatrix = new(SignedBuilderBid)
+		return b.Bellatrix.UnmarshalSSZ(buf)
+	case VersionCapella:
+		b.Capella = new(SignedBuilderBidCapella)
+		return b.Capella.UnmarshalSSZ(buf)
+	case VersionDeneb:
+		b.Deneb = new(SignedBuilderBidDeneb)
+		return b.Deneb.UnmarshalSSZ(buf)
+	}
+	return unsupportedVersion(b.Version)
+}
+
+// Message is the signed part of the bid. The accessors below need a complete bid.
+func (b *VersionedSignedBuilderBid) Message() HashTreeRoot {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message
+	case b.Capella != nil:
+		return b.Capella.Message
+	default:
+		return b.Deneb.Message
+	}
+}
+
+func (b *VersionedSignedBuilderBid) Signature() Signature {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Signature
+	case b.Capella != nil:
+		return b.Capella.Signature
+	default:
+		return b.Deneb.Signature
+	}
+}
+
+func (b *VersionedSignedBuilderBid) Pubkey() PublicKey {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Pubkey
+	case b.Capella != nil:
+		return b.Capella.Message.Pubkey
+	default:
+		return b.Deneb.Message.Pubkey
+	}
+}
+
+func (b *VersionedSignedBuilderBid) Value() U256Str {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Value
+	case b.Capella != nil:
+		return b.Capella.Message.Value
+	default:
+		return b.Deneb.Message.Value
+	}
+}
+
+func (b *VersionedSignedBuilderBid) ParentHash() Hash {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Header.ParentHash
+	case b.Capella != nil:
+		return b.Capella.Message.Header.ParentHash
+	default:
+		return b.Deneb.Message.Header.ParentHash
+	}
+}
+
+func (b *VersionedSignedBuilderBid) BlockHash() Hash {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Header.BlockHash
+	case b.Capella != nil:
+		return b.Capella.Message.Header.BlockHash
+	default:
+		return b.Deneb.Message.Header.BlockHash
+	}
+}
+
+// HeaderRoot is the hash tree root of the execution payload header, as found in the blinded block for the bid.
+func (b *VersionedSignedBuilderBid) HeaderRoot() ([32]byte, error) {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Header.HashTreeRoot()
+	case b.Capella != nil:
+		return b.Capella.Message.Header.HashTreeRoot()
+	default:
+		return b.Deneb.Message.Header.HashTreeRoot()
+	}
+}
+
+func (b *VersionedSignedBuilderBid) SetSignature(signature Signature) {
+	switch {
+	case b.Bellatrix != nil:
+		b.Bellatrix.Signature = signature
+	case b.Capella != nil:
+		b.Capella.Signature = signature
+	case b.Deneb != nil:
+		b.Deneb.Signature = signature
+	}
+}
+
+// VersionedExecutionPayload is the payload of a getPayload response, of any fork. Like VersionedSignedBuilderBid,
+// the fork set in Version decides what is decoded, and encoding uses the payload that is set.
+type VersionedExecutionPayload struct {
+	Version   string
+	Bellatrix *ExecutionPayloadREST
+	Capella   *ExecutionPayloadCapella
+	Deneb     *ExecutionPayloadAndBlobsBundle
+}
+
+func (p *VersionedExecutionPayload) data() (interface {
+	MarshalSSZ() ([]byte, error)
+}, error) {
+	switch {
+	case p.Bellatrix != nil:
+		return p.Bellatrix, nil
+	case p.Capella != nil:
+		return p.Capella, nil
+	case p.Deneb != nil && p.Deneb.ExecutionPayload != nil && p.Deneb.BlobsBundle != nil:
+		return p.Deneb, nil
+	}
+	return nil, errIncomplete
+}
+
+// MarshalJSON encodes the payload in a getPayload response.
+func (p *VersionedExecutionPayload) MarshalJSON() ([]byte, error) {
+	data, err := p.data()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Version string `json:"version"`
+		Data    any    `json:"data"`
+	}{p.Version, data})
+}
+
+// UnmarshalJSON decodes the payload of a getPayload response.
+func (p *VersionedExecutionPayload) UnmarshalJSON(input []byte) error {
+	var v versioned
+	if err := json.Unmarshal(input, &v); err != nil {
+		return err
+	}
+	*p = VersionedExecutionPayload{Version: v.Version}
+	switch v.Version {
+	case VersionBellatrix:
+		return json.Unmarshal(v.Data, &p.Bellatrix)
+	case VersionCapella:
+		return json.Unmarshal(v.Data, &p.Capella)
+	case VersionDeneb:
+		return json.Unmarshal(v.Data, &p.Deneb)
+	}
+	return unsupportedVersion(v.Version)
+}
+
+func (p *VersionedExecutionPayload) MarshalSSZ() ([]byte, error) {
+	data, err := p.data()
+	if err != nil {
+		return nil, err
+	}
+	return data.MarshalSSZ()
+}
+
+// UnmarshalSSZ decodes a payload of the fork in Version.
+func (p *VersionedExecutionPayload) UnmarshalSSZ(buf []byte) error {
+	*p = VersionedExecutionPayload{Version: p.Version}
+	switch p.Version {
+	case VersionBellatrix:
+		p.Bellatrix = new(ExecutionPayloadREST)
+		return p.Bellatrix.UnmarshalSSZ(buf)
+	case VersionCapella:
+		p.Capella = new(ExecutionPayloadCapella)
+		return p.Capella.UnmarshalSSZ(buf)
+	case VersionDeneb:
+		p.Deneb = new(ExecutionPayloadAndBlobsBundle)
+		return p.Deneb.UnmarshalSSZ(buf)
+	}
+	return unsupportedVersion(p.Version)
+}
+
+func (p *VersionedExecutionPayload) BlockHash() Hash {
+	switch {
+	case p.Bellatrix != nil:
+		return p.Bellatrix.BlockHash
+	case p.Capella != nil:
+		return p.Capella.BlockHash
+	case p.Deneb != nil && p.Deneb.ExecutionPayload != nil:
+		return p.Deneb.ExecutionPayload.BlockHash
+	}
+	return Hash{}
+}
+
+// ELPayload converts the payload for the engine API V1, which only works without withdrawals and blobs.
+func (p *VersionedExecutionPayload) ELPayload() (*ExecutionPayloadV1, error) {
+	if _, err := p.data(); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.Bellatrix != nil:
+		return RESTPayloadToELPayload(p.Bellatrix)
+	case p.Capella != nil:
+		return CapellaPayloadToELPayload(p.Capella)
+	default:
+		if len(p.Deneb.BlobsBundle.Blobs) > 0 {
+			return nil, errBlobs
+		}
+		return DenebPayloadToELPayload(p.Deneb.ExecutionPayload)
+	}
+}
+
+// ELToVersionedPayload converts an engine API V1 payload to the given fork, with the fields of the fork if it has any.
+func ELToVersionedPayload(version string, p *ExecutionPayloadV1, f *PayloadForkFields) (*VersionedExecutionPayload, error) {
+	var err error
+	v := &VersionedExecutionPayload{Version: version}
+	switch version {
+	case VersionBellatrix:
+		v.Bellatrix, err = ELPayloadToRESTPayload(p)
+	case VersionCapella:
+		v.Capella, err = ELPayloadToCapellaPayload(p, f)
+	case VersionDeneb:
+		v.Deneb, err = ELPayloadToDenebPayload(p, f)
+	default:
+		err = unsupportedVersion(version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// VersionedSignedBlindedBeaconBlock is a signed blinded block of any fork, as posted to getPayload.
+// The request has no version field: the fork set in Version decides what is decoded, from JSON as well as SSZ,
+// and encoding uses the block that is set.
+type VersionedSignedBlindedBeaconBlock struct {
+	Version   string
+	Bellatrix *SignedBlindedBeaconBlock
+	Capella   *SignedBlindedBeaconBlockCapella
+	Deneb     *SignedBlindedBeaconBlockDeneb
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) data() (interface {
+	MarshalSSZ() ([]byte, error)
+}, error) {
+	switch {
+	case b.Bellatrix != nil && b.Bellatrix.Message != nil && b.Bellatrix.Message.Body != nil && b.Bellatrix.Message.Body.ExecutionPayloadHeader != nil:
+		return b.Bellatrix, nil
+	case b.Capella != nil && b.Capella.Message != nil && b.Capella.Message.Body != nil && b.Capella.Message.Body.ExecutionPayloadHeader != nil:
+		return b.Capella, nil
+	case b.Deneb != nil && b.Deneb.Message != nil && b.Deneb.Message.Body != nil && b.Deneb.Message.Body.ExecutionPayloadHeader != nil:
+		return b.Deneb, nil
+	}
+	return nil, errIncomplete
+}
+
+// Complete tells if the block has a message, body and execution payload header.
+func (b *VersionedSignedBlindedBeaconBlock) Complete() bool {
+	_, err := b.data()
+	return err == nil
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) MarshalJSON() ([]byte, error) {
+	data, err := b.data()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON decodes a block of the fork in Version.
+func (b *VersionedSignedBlindedBeaconBlock) UnmarshalJSON(input []byte) error {
+	*b = VersionedSignedBlindedBeaconBlock{Version: b.Version}
+	switch b.Version {
+	case VersionBellatrix:
+		return json.Unmarshal(input, &b.Bellatrix)
+	case VersionCapella:
+		return json.Unmarshal(input, &b.Capella)
+	case VersionDeneb:
+		return json.Unmarshal(input, &b.Deneb)
+	}
+	return unsupportedVersion(b.Version)
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) MarshalSSZ() ([]byte, error) {
+	data, err := b.data()
+	if err != nil {
+		return nil, err
+	}
+	return data.MarshalSSZ()
+}
+
+// UnmarshalSSZ decodes a block of the fork in Version.
+func (b *VersionedSignedBlindedBeaconBlock) UnmarshalSSZ(buf []byte) error {
+	*b = VersionedSignedBlindedBeaconBlock{Version: b.Version}
+	switch b.Version {
+	case VersionBellatrix:
+		b.Bellatrix = new(SignedBlindedBeaconBlock)
+		return b.Bellatrix.UnmarshalSSZ(buf)
+	case VersionCapella:
+		b.Capella = new(SignedBlindedBeaconBlockCapella)
+		return b.Capella.UnmarshalSSZ(buf)
+	case VersionDeneb:
+		b.Deneb = new(SignedBlindedBeaconBlockDeneb)
+		return b.Deneb.UnmarshalSSZ(buf)
+	}
+	return unsupportedVersion(b.Version)
+}
+
+// Message is the signed part of the block. The accessors below need a complete block.
+func (b *VersionedSignedBlindedBeaconBlock) Message() HashTreeRoot {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message
+	case b.Capella != nil:
+		return b.Capella.Message
+	default:
+		return b.Deneb.Message
+	}
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) Signature() Signature {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Signature
+	case b.Capella != nil:
+		return b.Capella.Signature
+	default:
+		return b.Deneb.Signature
+	}
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) Slot() uint64 {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Slot
+	case b.Capella != nil:
+		return b.Capella.Message.Slot
+	default:
+		return b.Deneb.Message.Slot
+	}
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) ProposerIndex() uint64 {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.ProposerIndex
+	case b.Capella != nil:
+		return b.Capella.Message.ProposerIndex
+	default:
+		return b.Deneb.Message.ProposerIndex
+	}
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) ParentHash() Hash {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Body.ExecutionPayloadHeader.ParentHash
+	case b.Capella != nil:
+		return b.Capella.Message.Body.ExecutionPayloadHeader.ParentHash
+	default:
+		return b.Deneb.Message.Body.ExecutionPayloadHeader.ParentHash
+	}
+}
+
+// HeaderRoot is the hash tree root of the execution payload header.
+func (b *VersionedSignedBlindedBeaconBlock) HeaderRoot() ([32]byte, error) {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Body.ExecutionPayloadHeader.HashTreeRoot()
+	case b.Capella != nil:
+		return b.Capella.Message.Body.ExecutionPayloadHeader.HashTreeRoot()
+	default:
+		return b.Deneb.Message.Body.ExecutionPayloadHeader.HashTreeRoot()
+	}
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) BlockHash() Hash {
+	switch {
+	case b.Bellatrix != nil:
+		return b.Bellatrix.Message.Body.ExecutionPayloadHeader.BlockHash
+	case b.Capella != nil:
+		return b.Capella.Message.Body.ExecutionPayloadHeader.BlockHash
+	default:
+		return b.Deneb.Message.Body.ExecutionPayloadHeader.BlockHash
+	}
+}
+
+// BeaconHeader is the signed header of the block, with the hash tree root of its body.
+func (b *VersionedSignedBlindedBeaconBlock) BeaconHeader() (*SignedBeaconBlockHeader, error) {
+	var (
+		header = new(BeaconBlockHeader)
+		body   HashTreeRoot
+	)
+	switch {
+	case b.Bellatrix != nil:
+		m := b.Bellatrix.Message
+		header.Slot, header.ProposerIndex, header.ParentRoot, header.StateRoot, body = m.Slot, m.ProposerIndex, m.ParentRoot, m.StateRoot, m.Body
+	case b.Capella != nil:
+		m := b.Capella.Message
+		header.Slot, header.ProposerIndex, header.ParentRoot, header.StateRoot, body = m.Slot, m.ProposerIndex, m.ParentRoot, m.StateRoot, m.Body
+	default:
+		m := b.Deneb.Message
+		header.Slot, header.ProposerIndex, header.ParentRoot, header.StateRoot, body = m.Slot, m.ProposerIndex, m.ParentRoot, m.StateRoot, m.Body
+	}
+	bodyRoot, err := body.HashTreeRoot()
+	if err != nil {
+		return nil, err
+	}
+	header.BodyRoot = bodyRoot
+	return &SignedBeaconBlockHeader{Header: header, Signature: b.Signature()}, nil
+}
+
+func (b *VersionedSignedBlindedBeaconBlock) SetSignature(signature Signature) {
+	switch {
+	case b.Bellatrix != nil:
+		b.Bellatrix.Signature = signature
+	case b.Capella != nil:
+		b.Capella.Signature = signature
+	case b.Deneb != nil:
+		b.Deneb.Signature = signature
+	}
+}
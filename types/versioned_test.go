@@ -0,0 +1,142 @@
+package types
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForkSchedule(t *testing.T) {
+	forks := ForkSchedule{SlotsPerEpoch: 32, CapellaEpoch: 1, DenebEpoch: 3}
+	require.Equal(t, VersionBellatrix, forks.Version(31))
+	require.Equal(t, VersionCapella, forks.Version(32))
+	require.Equal(t, VersionCapella, forks.Version(95))
+	require.Equal(t, VersionDeneb, forks.Version(96))
+
+	forks = ForkSchedule{SlotsPerEpoch: 32, CapellaEpoch: math.MaxUint64, DenebEpoch: math.MaxUint64}
+	require.Equal(t, VersionBellatrix, forks.Version(math.MaxUint64))
+}
+
+func testELPayload() *ExecutionPayloadV1 {
+	return &ExecutionPayloadV1{
+		ParentHash:    common.Hash{0x01},
+		FeeRecipient:  common.Address{0x02},
+		StateRoot:     common.Hash{0x03},
+		ReceiptsRoot:  common.Hash{0x04},
+		Random:        common.Hash{0x06},
+		Number:        5001,
+		GasLimit:      5002,
+		GasUsed:       5003,
+		Timestamp:     5004,
+		ExtraData:     hexutil.Bytes{0x07},
+		BaseFeePerGas: common.Big256,
+		BlockHash:     common.Hash{0x09},
+		Transactions:  [][]byte{{0x0a}, {0x0b, 0x0c}},
+	}
+}
+
+func TestVersionedExecutionPayload(t *testing.T) {
+	for _, version := range []string{VersionBellatrix, VersionCapella, VersionDeneb} {
+		p, err := ELToVersionedPayload(version, testELPayload(), nil)
+		require.NoError(t, err)
+
+		b, err := json.Marshal(p)
+		require.NoError(t, err)
+		fromJSON := new(VersionedExecutionPayload)
+		require.NoError(t, json.Unmarshal(b, fromJSON))
+		require.Equal(t, p, fromJSON, version)
+
+		b, err = p.MarshalSSZ()
+		require.NoError(t, err)
+		fromSSZ := &VersionedExecutionPayload{Version: version}
+		require.NoError(t, fromSSZ.UnmarshalSSZ(b))
+		require.Equal(t, p, fromSSZ, version)
+
+		el, err := fromSSZ.ELPayload()
+		require.NoError(t, err)
+		require.Equal(t, testELPayload(), el, version)
+	}
+
+	// Withdrawals do not fit the engine API V1
+	p, err := ELToVersionedPayload(VersionCapella, testELPayload(), nil)
+	require.NoError(t, err)
+	p.Capella.Withdrawals = []*Withdrawal{{Index: 1, Amount: 2}}
+	_, err = p.ELPayload()
+	require.ErrorIs(t, err, errWithdrawals)
+
+	require.Error(t, json.Unmarshal([]byte(`{"version":"altair","data":{}}`), new(VersionedExecutionPayload)))
+}
+
+func TestVersionedSignedBlindedBeaconBlockDeneb(t *testing.T) {
+	header, err := PayloadToPayloadHeaderDeneb(testELPayload(), nil)
+	require.NoError(t, err)
+	block := &VersionedSignedBlindedBeaconBlock{
+		Version: VersionDeneb,
+		Deneb: &SignedBlindedBeaconBlockDeneb{
+			Message: &BlindedBeaconBlockDeneb{
+				Slot:          1,
+				ProposerIndex: 2,
+				ParentRoot:    Root{0x03},
+				StateRoot:     Root{0x04},
+				Body: &BlindedBeaconBlockBodyDeneb{
+					Eth1Data:               &Eth1Data{},
+					SyncAggregate:          &SyncAggregate{},
+					ProposerSlashings:      []*ProposerSlashing{},
+					AttesterSlashings:      []*AttesterSlashing{},
+					Attestations:           []*Attestation{},
+					Deposits:               []*Deposit{},
+					VoluntaryExits:         []*VoluntaryExit{},
+					ExecutionPayloadHeader: header,
+					BLSToExecutionChanges: []*SignedBLSToExecutionChange{{
+						Message: &BLSToExecutionChange{ValidatorIndex: 5, ToExecutionAddress: Address{0x06}},
+					}},
+					BlobKzgCommitments: []KZGCommitment{{0x07}, {0x08}},
+				},
+			},
+			Signature: Signature{0x09},
+		},
+	}
+	require.True(t, block.Complete())
+
+	b, err := json.Marshal(block)
+	require.NoError(t, err)
+	fromJSON := &VersionedSignedBlindedBeaconBlock{Version: VersionDeneb}
+	require.NoError(t, json.Unmarshal(b, fromJSON))
+	require.Equal(t, block, fromJSON)
+
+	b, err = block.MarshalSSZ()
+	require.NoError(t, err)
+	fromSSZ := &VersionedSignedBlindedBeaconBlock{Version: VersionDeneb}
+	require.NoError(t, fromSSZ.UnmarshalSSZ(b))
+	require.Equal(t, block, fromSSZ)
+	require.Equal(t, uint64(1), fromSSZ.Slot())
+	require.Equal(t, Hash{0x01}, fromSSZ.ParentHash())
+
+	// The root covers the commitments
+	root, err := block.Message().HashTreeRoot()
+	require.NoError(t, err)
+	block.Deneb.Message.Body.BlobKzgCommitments = block.Deneb.Message.Body.BlobKzgCommitments[:1]
+	otherRoot, err := block.Message().HashTreeRoot()
+	require.NoError(t, err)
+	require.NotEqual(t, root, otherRoot)
+}
+
+func TestNetworkDomains(t *testing.T) {
+	require.Equal(t, DomainBuilder, Mainnet.BuilderDomain())
+	require.NotEqual(t, DomainBuilder, Holesky.BuilderDomain())
+
+	root := Root{0x01}
+	bellatrix, err := Mainnet.ProposerDomain(VersionBellatrix, &root)
+	require.NoError(t, err)
+	require.Equal(t, Domain(ComputeDomain(DomainTypeBeaconProposer, ForkVersion{0x02}, &root)), bellatrix)
+	capella, err := Mainnet.ProposerDomain(VersionCapella, &root)
+	require.NoError(t, err)
+	require.NotEqual(t, bellatrix, capella)
+
+	_, err = Mainnet.ProposerDomain("altair", &root)
+	require.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"mergemock/api"
+	"mergemock/rpc"
+	"mergemock/types"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+var (
+	errNoSimulation       = errors.New("block submissions need the embedded engine to be simulated")
+	errUpstreamSyncing    = errors.New("upstream engine is syncing")
+	errUpstreamPayment    = errors.New("bid payments need the embedded engine")
+	errUpstreamFork       = errors.New("upstream engine builds Bellatrix, Capella and Deneb payloads only")
+	errUpstreamGasLimit   = errors.New("upstream payload does not have the gas limit of the registration, set the gas limit target of the upstream engine to it")
+	errNoUpstreamBeacon   = errors.New("upstream engine builds need a beacon API for the payload attributes")
+	errNoAttributes       = errors.New("no payload attributes event for the slot and parent")
+	errNoParentBeaconRoot = errors.New("payload attributes event has no parent beacon block root")
+)
+
+// upstreamBlock is the part of an upstream block the relay uses. The hash is the one the engine gives: the header
+// type of the embedded engine does not know the fields of later forks, and would hash their headers wrongly.
+type upstreamBlock struct {
+	Hash     common.Hash    `json:"hash"`
+	Number   hexutil.Uint64 `json:"number"`
+	Time     hexutil.Uint64 `json:"timestamp"`
+	GasLimit hexutil.Uint64 `json:"gasLimit"`
+}
+
+// connectUpstream makes the relay build its blocks with an external execution client, over the authenticated engine API.
+func (r *RelayBackend) connectUpstream(ctx context.Context, addr string, jwtSecretPath string) error {
+	if r.bids.Payment.account != nil {
+		return errUpstreamPayment
+	}
+	jwt, err := loadJwtSecret(jwtSecretPath)
+	if err != nil {
+		return fmt.Errorf("unable to read JWT secret: %v", err)
+	}
+	client, err := rpc.DialContext(ctx, addr, jwt)
+	if err != nil {
+		return err
+	}
+	r.upstream = client
+	r.upstreamAddr = addr
+	r.log.WithField("addr", addr).Info("Building blocks with upstream engine")
+	r.log.Warn("The upstream engine chooses the gas limits of its blocks, there are no bids when they are not the registered ones")
+	return nil
+}
+
+// buildUpstreamPayload has the upstream engine build a payload for the proposer: the relay acts as its consensus
+// client, with a forkchoice update carrying the attributes of the beacon node's payload attributes event and the
+// proposer's fee recipient, followed by getPayload once the engine had the build time. The engine API methods are
+// those of the fork of the slot, so that Capella and Deneb payloads have their withdrawals, blob gas and blobs.
+// The payload is valued by the block value the engine gives, before the bid strategy applies, and must have the
+// gas limit the registered one leads to.
+func (r *RelayBackend) buildUpstreamPayload(ctx context.Context, slot uint64, parentHash common.Hash, registration *types.RegisterValidatorRequestMessage) (payload *types.ExecutionPayloadV1, fork *types.PayloadForkFields, revenue *big.Int, value *big.Int, err error) {
+	event := r.events.get(slot)
+	if event == nil || event.ParentBlockHash != parentHash {
+		return nil, nil, nil, nil, errNoAttributes
+	}
+	var parent *upstreamBlock
+	if err := r.upstream.CallContext(ctx, &parent, "eth_getBlockByHash", parentHash, false); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("cannot get upstream parent: %v", err)
+	}
+	if parent == nil {
+		return nil, nil, nil, nil, fmt.Errorf("unknown parent %s", parentHash)
+	}
+	safe, finalized := r.upstreamBlockHash(ctx, "safe"), r.upstreamBlockHash(ctx, "finalized")
+	version := r.forks.Version(slot)
+	var result types.ForkchoiceUpdatedResult
+	switch version {
+	case types.VersionBellatrix:
+		attributes := &types.PayloadAttributesV1{
+			Timestamp:             event.PayloadAttributes.Timestamp,
+			PrevRandao:            event.PayloadAttributes.PrevRandao,
+			SuggestedFeeRecipient: common.Address(registration.FeeRecipient),
+		}
+		result, err = api.ForkchoiceUpdatedV1(ctx, r.upstream, r.log, parentHash, safe, finalized, attributes)
+	case types.VersionCapella, types.VersionDeneb:
+		attributes := &types.PayloadAttributesV3{
+			Timestamp:             hexutil.Uint64(event.PayloadAttributes.Timestamp),
+			PrevRandao:            event.PayloadAttributes.PrevRandao,
+			SuggestedFeeRecipient: common.Address(registration.FeeRecipient),
+			Withdrawals:           types.ToWithdrawalsV1(event.PayloadAttributes.Withdrawals),
+		}
+		method := "engine_forkchoiceUpdatedV2"
+		if version == types.VersionDeneb {
+			if event.PayloadAttributes.ParentBeaconBlockRoot == nil {
+				return nil, nil, nil, nil, errNoParentBeaconRoot
+			}
+			root := common.Hash(*event.PayloadAttributes.ParentBeaconBlockRoot)
+			attributes.ParentBeaconBlockRoot = &root
+			method = "engine_forkchoiceUpdatedV3"
+		}
+		result, err = api.ForkchoiceUpdatedV3(ctx, r.upstream, r.log, method, parentHash, safe, finalized, attributes)
+	default:
+		return nil, nil, nil, nil, fmt.Errorf("%w: %s", errUpstreamFork, version)
+	}
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if result.PayloadStatus.Status != types.ExecutionValid {
+		return nil, nil, nil, nil, fmt.Errorf("upstream engine cannot build on %s: %s", parentHash, result.PayloadStatus.Status)
+	}
+	if result.PayloadID == nil {
+		return nil, nil, nil, nil, errors.New("upstream engine did not start building a payload")
+	}
+	select {
+	case <-ctx.Done():
+		return nil, nil, nil, nil, ctx.Err()
+	case <-time.After(r.upstreamBuildTime):
+	}
+	if version == types.VersionBellatrix {
+		// getPayloadV2 serves payloads without withdrawals too, and gives their value
+		payload, revenue, err = api.GetPayloadV2(ctx, r.upstream, r.log, *result.PayloadID)
+	} else {
+		method := "engine_getPayloadV2"
+		if version == types.VersionDeneb {
+			method = "engine_getPayloadV3"
+		}
+		var res *types.GetPayloadV3Response
+		if res, err = api.GetPayloadV3(ctx, r.upstream, r.log, method, *result.PayloadID); err == nil {
+			payload, fork, err = res.Split()
+			revenue = res.BlockValue.ToInt()
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if gasLimit := core.CalcGasLimit(uint64(parent.GasLimit), registration.GasLimit); payload.GasLimit != gasLimit {
+		return nil, nil, nil, nil, fmt.Errorf("%w: %d instead of %d", errUpstreamGasLimit, payload.GasLimit, gasLimit)
+	}
+	return payload, fork, revenue, r.bids.Value(revenue), nil
+}
+
+// upstreamBlockHash returns the hash of the upstream block with the tag, or zero if the engine has none yet or does
+// not know the tag, like the embedded engine.
+func (r *RelayBackend) upstreamBlockHash(ctx context.Context, tag string) common.Hash {
+	var block *upstreamBlock
+	if err := r.upstream.CallContext(ctx, &block, "eth_getBlockByNumber", tag, false); err != nil {
+		r.log.WithError(err).WithField("tag", tag).Debug("Cannot get upstream block")
+		return common.Hash{}
+	}
+	if block == nil {
+		return common.Hash{}
+	}
+	return block.Hash
+}
+
+// upstreamHead returns the head of the upstream engine, once it is synced.
+func (r *RelayBackend) upstreamHead(ctx context.Context) (*upstreamBlock, error) {
+	var syncing json.RawMessage
+	if err := r.upstream.CallContext(ctx, &syncing, "eth_syncing"); err != nil {
+		return nil, fmt.Errorf("upstream engine unreachable: %v", err)
+	}
+	if string(syncing) != "false" {
+		return nil, errUpstreamSyncing
+	}
+	var head *upstreamBlock
+	if err := r.upstream.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false); err != nil {
+		return nil, fmt.Errorf("cannot get upstream head: %v", err)
+	}
+	if head == nil {
+		return nil, errNoHead
+	}
+	return head, nil
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"mergemock/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Well-known test mnemonic, also used by eth2-testnet-genesis and most devnet tooling.
+const DefaultValidatorMnemonic = "giant issue aisle success illegal bike spike question tent bar rely arctic volcano long crawl hungry vocal artwork sniff fantasy very lucky have athlete"
+
+// blsCurveOrder is the order r of the BLS12-381 scalar field.
+var blsCurveOrder, _ = new(big.Int).SetString("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001", 16)
+
+type ValidatorsConfig struct {
+	Count                uint64 `ask:"--count" help:"Number of validator keys to derive from the mnemonic"`
+	Mnemonic             string `ask:"--mnemonic" help:"BIP-39 mnemonic to derive validator keys from (EIP-2334 path m/12381/3600/i/0/0)"`
+	KeystoresDir         string `ask:"--keystores" help:"Directory of EIP-2335 keystore files to load instead of deriving from the mnemonic"`
+	KeystorePasswordPath string `ask:"--keystores-password" help:"File containing the password of the keystore files"`
+	ProposerConfigPath   string `ask:"--proposer-config" help:"JSON file with per-validator fee recipient and gas limit preferences"`
+	GasLimit             uint64 `ask:"--gas-limit" help:"Gas limit preference of validators not listed in the proposer config"`
+}
+
+func (c *ValidatorsConfig) Default() {
+	c.Count = 64
+	c.Mnemonic = DefaultValidatorMnemonic
+	c.GasLimit = 30_000_000
+}
+
+// ProposerPreferences is the fee recipient and gas limit a validator wants its payloads built with.
+// The gas limit can also be in a builder section, as in the proposer settings of Prysm and Teku.
+type ProposerPreferences struct {
+	FeeRecipient *common.Address `json:"fee_recipient"`
+	GasLimit     uint64          `json:"gas_limit,string"`
+	Builder      *struct {
+		GasLimit uint64 `json:"gas_limit,string"`
+	} `json:"builder"`
+}
+
+// ProposerConfig maps validator pubkeys to their preferences, with an optional fallback.
+type ProposerConfig struct {
+	Proposers map[types.PublicKey]*ProposerPreferences `json:"proposer_config"`
+	Default   *ProposerPreferences                     `json:"default_config"`
+}
+
+type Validator struct {
+	Index        uint64
+	Pubkey       types.PublicKey
+	FeeRecipient common.Address
+	GasLimit     uint64
+
+	sk bls.SecretKey
+}
+
+// Sign signs the object in the given domain with the validator's key.
+func (v *Validator) Sign(obj types.HashTreeRoot, domain types.Domain) (types.Signature, error) {
+	var sig types.Signature
+	root, err := types.ComputeSigningRoot(obj, domain)
+	if err != nil {
+		return sig, err
+	}
+	sig.FromSlice(v.sk.Sign(root[:]).Marshal())
+	return sig, nil
+}
+
+// Registration returns the builder registration of the validator's preferences, signed for the builder domain.
+func (v *Validator) Registration(timestamp uint64, domain types.Domain) (*types.SignedValidatorRegistration, error) {
+	msg := &types.RegisterValidatorRequestMessage{
+		FeeRecipient: types.Address(v.FeeRecipient),
+		GasLimit:     v.GasLimit,
+		Timestamp:    timestamp,
+		Pubkey:       v.Pubkey,
+	}
+	sig, err := v.Sign(msg, domain)
+	if err != nil {
+		return nil, err
+	}
+	return &types.SignedValidatorRegistration{Message: msg, Signature: sig}, nil
+}
+
+type ValidatorSet struct {
+	validators    []*Validator
+	byPubkey      map[types.PublicKey]*Validator
+	slotsPerEpoch uint64
+	scheduleSeed  types.Root
+}
+
+// NewValidatorSet loads the validator keys, from keystores or derived from the mnemonic,
+// and applies the proposer preferences. The seed makes the proposer schedule unique per network.
+func NewValidatorSet(cfg *ValidatorsConfig, slotsPerEpoch uint64, seed types.Root) (*ValidatorSet, error) {
+	if slotsPerEpoch == 0 {
+		return nil, errors.New("slots per epoch must be non-zero")
+	}
+	var (
+		keys []bls.SecretKey
+		err  error
+	)
+	if cfg.KeystoresDir != "" {
+		keys, err = loadKeystores(cfg.KeystoresDir, cfg.KeystorePasswordPath)
+	} else {
+		keys, err = deriveValidatorKeys(cfg.Mnemonic, cfg.Count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no validator keys configured")
+	}
+
+	var proposerConfig ProposerConfig
+	if cfg.ProposerConfigPath != "" {
+		raw, err := ioutil.ReadFile(cfg.ProposerConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read proposer config: %v", err)
+		}
+		if err := json.Unmarshal(raw, &proposerConfig); err != nil {
+			return nil, fmt.Errorf("invalid proposer config: %v", err)
+		}
+	}
+
+	set := &ValidatorSet{
+		validators:    make([]*Validator, 0, len(keys)),
+		byPubkey:      make(map[types.PublicKey]*Validator, len(keys)),
+		slotsPerEpoch: slotsPerEpoch,
+		scheduleSeed:  seed,
+	}
+	for i, sk := range keys {
+		v := &Validator{Index: uint64(i), sk: sk}
+		v.Pubkey.FromSlice(sk.PublicKey().Marshal())
+		// Without explicit preferences every validator gets its own fee recipient,
+		// so payloads of different proposers can be told apart.
+		v.FeeRecipient = common.BytesToAddress(crypto.Keccak256(v.Pubkey[:]))
+		v.GasLimit = cfg.GasLimit
+		for _, prefs := range []*ProposerPreferences{proposerConfig.Default, proposerConfig.Proposers[v.Pubkey]} {
+			if prefs == nil {
+				continue
+			}
+			if prefs.FeeRecipient != nil {
+				v.FeeRecipient = *prefs.FeeRecipient
+			}
+			if prefs.GasLimit != 0 {
+				v.GasLimit = prefs.GasLimit
+			} else if prefs.Builder != nil && prefs.Builder.GasLimit != 0 {
+				v.GasLimit = prefs.Builder.GasLimit
+			}
+		}
+		set.validators = append(set.validators, v)
+		set.byPubkey[v.Pubkey] = v
+	}
+	return set, nil
+}
+
+func (vs *ValidatorSet) Len() int {
+	return len(vs.validators)
+}
+
+func (vs *ValidatorSet) Validators() []*Validator {
+	return vs.validators
+}
+
+func (vs *ValidatorSet) ByIndex(index uint64) *Validator {
+	if index >= uint64(len(vs.validators)) {
+		return nil
+	}
+	return vs.validators[index]
+}
+
+func (vs *ValidatorSet) ByPubkey(pubkey types.PublicKey) *Validator {
+	return vs.byPubkey[pubkey]
+}
+
+// ProposerDuties returns the validator indices proposing each slot of the epoch.
+// The schedule only depends on the epoch and the seed, so it is stable across runs.
+func (vs *ValidatorSet) ProposerDuties(epoch uint64) []uint64 {
+	duties := make([]uint64, vs.slotsPerEpoch)
+	var buf [32 + 8 + 8]byte
+	copy(buf[:32], vs.scheduleSeed[:])
+	binary.LittleEndian.PutUint64(buf[32:40], epoch)
+	for i := range duties {
+		binary.LittleEndian.PutUint64(buf[40:], uint64(i))
+		h := sha256.Sum256(buf[:])
+		duties[i] = binary.LittleEndian.Uint64(h[:8]) % uint64(len(vs.validators))
+	}
+	return duties
+}
+
+// Proposer returns the validator scheduled to propose the slot.
+func (vs *ValidatorSet) Proposer(slot uint64) *Validator {
+	duties := vs.ProposerDuties(slot / vs.slotsPerEpoch)
+	return vs.validators[duties[slot%vs.slotsPerEpoch]]
+}
+
+func deriveValidatorKeys(mnemonic string, count uint64) ([]bls.SecretKey, error) {
+	if mnemonic == "" {
+		return nil, errors.New("no mnemonic to derive validator keys from")
+	}
+	// BIP-39 seed, without passphrase.
+	seed := pbkdf2.Key([]byte(strings.Join(strings.Fields(mnemonic), " ")), []byte("mnemonic"), 2048, 64, sha512.New)
+	master, err := deriveMasterSK(seed)
+	if err != nil {
+		return nil, err
+	}
+	// all keys share the m/12381/3600 prefix
+	coinType := deriveChildSK(deriveChildSK(master, 12381), 3600)
+	keys := make([]bls.SecretKey, 0, count)
+	for i := uint64(0); i < count; i++ {
+		sk := coinType
+		for _, index := range []uint32{uint32(i), 0, 0} {
+			sk = deriveChildSK(sk, index)
+		}
+		key, err := bls.SecretKeyFromBytes(sk.FillBytes(make([]byte, 32)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid derived key %d: %v", i, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// deriveMasterSK implements derive_master_SK of EIP-2333.
+func deriveMasterSK(seed []byte) (*big.Int, error) {
+	if len(seed) < 32 {
+		return nil, errors.New("seed must be at least 32 bytes")
+	}
+	return hkdfModR(seed), nil
+}
+
+// deriveChildSK implements derive_child_SK of EIP-2333.
+func deriveChildSK(parent *big.Int, index uint32) *big.Int {
+	var salt [4]byte
+	binary.BigEndian.PutUint32(salt[:], index)
+	ikm := parent.FillBytes(make([]byte, 32))
+	notIkm := make([]byte, len(ikm))
+	for i, b := range ikm {
+		notIkm[i] = ^b
+	}
+	lamportPK := make([]byte, 0, 2*255*32)
+	for _, secret := range [][]byte{ikm, notIkm} {
+		okm := make([]byte, 255*32)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt[:], nil), okm); err != nil {
+			panic(err) // only fails when reading beyond the hkdf limit
+		}
+		for i := 0; i < len(okm); i += 32 {
+			chunk := sha256.Sum256(okm[i : i+32])
+			lamportPK = append(lamportPK, chunk[:]...)
+		}
+	}
+	compressed := sha256.Sum256(lamportPK)
+	return hkdfModR(compressed[:])
+}
+
+// hkdfModR implements HKDF_mod_r of EIP-2333.
+func hkdfModR(ikm []byte) *big.Int {
+	salt := []byte("BLS-SIG-KEYGEN-SALT-")
+	sk := new(big.Int)
+	secret := append(append([]byte{}, ikm...), 0)
+	for sk.Sign() == 0 {
+		h := sha256.Sum256(salt)
+		salt = h[:]
+		okm := make([]byte, 48)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte{0, 48}), okm); err != nil {
+			panic(err)
+		}
+		sk.Mod(new(big.Int).SetBytes(okm), blsCurveOrder)
+	}
+	return sk
+}
+
+type keystoreModule struct {
+	Function string          `json:"function"`
+	Params   json.RawMessage `json:"params"`
+	Message  string          `json:"message"`
+}
+
+// Keystore https://eips.ethereum.org/EIPS/eip-2335
+type Keystore struct {
+	Crypto struct {
+		Kdf      keystoreModule `json:"kdf"`
+		Checksum keystoreModule `json:"checksum"`
+		Cipher   keystoreModule `json:"cipher"`
+	} `json:"crypto"`
+	Pubkey  string `json:"pubkey"`
+	Path    string `json:"path"`
+	Version int    `json:"version"`
+}
+
+func loadKeystores(dir string, passwordPath string) ([]bls.SecretKey, error) {
+	password := []byte{}
+	if passwordPath != "" {
+		raw, err := ioutil.ReadFile(passwordPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keystore password: %v", err)
+		}
+		password = []byte(strings.TrimRight(string(raw), "\r\n"))
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	keys := make([]bls.SecretKey, 0, len(files))
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		var ks Keystore
+		err = json.NewDecoder(f).Decode(&ks)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid keystore %s: %v", path, err)
+		}
+		secret, err := ks.Decrypt(password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt keystore %s: %v", path, err)
+		}
+		sk, err := bls.SecretKeyFromBytes(secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in keystore %s: %v", path, err)
+		}
+		// The pubkey is optional, but one of another key means the keystore is not what it claims to be
+		if pubkey := strings.ToLower(strings.TrimPrefix(ks.Pubkey, "0x")); pubkey != "" && pubkey != hex.EncodeToString(sk.PublicKey().Marshal()) {
+			return nil, fmt.Errorf("pubkey of keystore %s does not match its key", path)
+		}
+		keys = append(keys, sk)
+	}
+	return keys, nil
+}
+
+// Decrypt returns the secret stored in the keystore. The password is expected
+// to be NFKD-normalized already, only control codes are stripped.
+func (ks *Keystore) Decrypt(password []byte) ([]byte, error) {
+	if ks.Version != 4 {
+		return nil, fmt.Errorf("unsupported keystore version %d", ks.Version)
+	}
+	password = []byte(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, string(password)))
+
+	var decryptionKey []byte
+	switch kdf := ks.Crypto.Kdf; kdf.Function {
+	case "scrypt":
+		var params struct {
+			DkLen int    `json:"dklen"`
+			N     int    `json:"n"`
+			R     int    `json:"r"`
+			P     int    `json:"p"`
+			Salt  string `json:"salt"`
+		}
+		if err := json.Unmarshal(kdf.Params, &params); err != nil {
+			return nil, err
+		}
+		salt, err := hex.DecodeString(params.Salt)
+		if err != nil {
+			return nil, err
+		}
+		if decryptionKey, err = scrypt.Key(password, salt, params.N, params.R, params.P, params.DkLen); err != nil {
+			return nil, err
+		}
+	case "pbkdf2":
+		var params struct {
+			DkLen int    `json:"dklen"`
+			C     int    `json:"c"`
+			Prf   string `json:"prf"`
+			Salt  string `json:"salt"`
+		}
+		if err := json.Unmarshal(kdf.Params, &params); err != nil {
+			return nil, err
+		}
+		if params.Prf != "hmac-sha256" {
+			return nil, fmt.Errorf("unsupported pbkdf2 prf %q", params.Prf)
+		}
+		salt, err := hex.DecodeString(params.Salt)
+		if err != nil {
+			return nil, err
+		}
+		decryptionKey = pbkdf2.Key(password, salt, params.C, params.DkLen, sha256.New)
+	default:
+		return nil, fmt.Errorf("unsupported kdf %q", kdf.Function)
+	}
+	if len(decryptionKey) < 32 {
+		return nil, errors.New("derived key too short")
+	}
+
+	cipherMessage, err := hex.DecodeString(ks.Crypto.Cipher.Message)
+	if err != nil {
+		return nil, err
+	}
+	if ks.Crypto.Checksum.Function != "sha256" {
+		return nil, fmt.Errorf("unsupported checksum %q", ks.Crypto.Checksum.Function)
+	}
+	checksum := sha256.Sum256(append(append([]byte{}, decryptionKey[16:32]...), cipherMessage...))
+	if hex.EncodeToString(checksum[:]) != ks.Crypto.Checksum.Message {
+		return nil, errors.New("checksum mismatch, wrong password?")
+	}
+
+	if ks.Crypto.Cipher.Function != "aes-128-ctr" {
+		return nil, fmt.Errorf("unsupported cipher %q", ks.Crypto.Cipher.Function)
+	}
+	var cipherParams struct {
+		IV string `json:"iv"`
+	}
+	if err := json.Unmarshal(ks.Crypto.Cipher.Params, &cipherParams); err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(cipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(decryptionKey[:16])
+	if err != nil {
+		return nil, err
+	}
+	secret := make([]byte, len(cipherMessage))
+	cipher.NewCTR(block, iv).XORKeyStream(secret, cipherMessage)
+	return secret, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from https://eips.ethereum.org/EIPS/eip-2333
+func TestDeriveChildSK(t *testing.T) {
+	cases := []struct {
+		seed     string
+		master   string
+		index    uint32
+		childKey string
+	}{
+		{
+			seed:     "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+			master:   "6083874454709270928345386274498605044986640685124978867557563392430687146096",
+			index:    0,
+			childKey: "20397789859736650942317412262472558107875392172444076792671091975210932703118",
+		},
+		{
+			seed:     "3141592653589793238462643383279502884197169399375105820974944592",
+			master:   "29757020647961307431480504535336562678282505419141012933316116377660817309383",
+			index:    3141592653,
+			childKey: "25457201688850691947727629385191704516744796114925897962676248250929345014287",
+		},
+	}
+	for _, c := range cases {
+		seed, err := hex.DecodeString(c.seed)
+		require.NoError(t, err)
+		master, err := deriveMasterSK(seed)
+		require.NoError(t, err)
+		require.Equal(t, c.master, master.String())
+		require.Equal(t, c.childKey, deriveChildSK(master, c.index).String())
+	}
+}
+
+// Test vector from https://eips.ethereum.org/EIPS/eip-2335
+const testKeystore = `{
+	"crypto": {
+		"kdf": {
+			"function": "pbkdf2",
+			"params": {
+				"dklen": 32,
+				"c": 262144,
+				"prf": "hmac-sha256",
+				"salt": "d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"
+			},
+			"message": ""
+		},
+		"checksum": {
+			"function": "sha256",
+			"params": {},
+			"message": "8a9f5d9912ed7e75ea794bc5a89bca5f193721d30868ade6f73043c6ea6febf1"
+		},
+		"cipher": {
+			"function": "aes-128-ctr",
+			"params": {
+				"iv": "264daa3f303d7259501c93d997d84fe6"
+			},
+			"message": "cee03fde2af33149775b7223e7845e4fb2c8ae1792e5f99fe9ecf474cc8c16ad"
+		}
+	},
+	"description": "This is a test keystore that uses PBKDF2 to secure the secret.",
+	"pubkey": "9612d7a727c9d0a22e185a1c768478dfe919cada9266988cb32359c11f2b7b27f4ae4040902382ae2910c15e2b420d07",
+	"path": "m/12381/60/0/0",
+	"uuid": "64625def-3331-4eea-ab6f-782f3ed16a83",
+	"version": 4
+}`
+
+const testKeystorePassword = "testpassword\U0001F511"
+
+func TestKeystoreDecrypt(t *testing.T) {
+	var ks Keystore
+	require.NoError(t, json.Unmarshal([]byte(testKeystore), &ks))
+
+	secret, err := ks.Decrypt([]byte(testKeystorePassword))
+	require.NoError(t, err)
+	require.Equal(t, "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f", hex.EncodeToString(secret))
+
+	_, err = ks.Decrypt([]byte("wrong"))
+	require.Error(t, err)
+}
+
+func TestLoadKeystores(t *testing.T) {
+	dir := t.TempDir()
+	passwordPath := filepath.Join(t.TempDir(), "password.txt")
+	require.NoError(t, os.WriteFile(passwordPath, []byte(testKeystorePassword+"\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "keystore.json"), []byte(testKeystore), 0600))
+	keys, err := loadKeystores(dir, passwordPath)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f", hex.EncodeToString(keys[0].Marshal()))
+
+	// A keystore claiming the pubkey of another key
+	otherPubkey := strings.Replace(testKeystore, `"pubkey": "9612`, `"pubkey": "8612`, 1)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "keystore.json"), []byte(otherPubkey), 0600))
+	_, err = loadKeystores(dir, passwordPath)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not match")
+}
+
+func TestProposerConfig(t *testing.T) {
+	cfg := &ValidatorsConfig{}
+	cfg.Default()
+	cfg.Count = 3
+	set, err := NewValidatorSet(cfg, 8, [32]byte{})
+	require.NoError(t, err)
+	config := fmt.Sprintf(`{
+		"proposer_config": {
+			"%s": {"fee_recipient": "0x0000000000000000000000000000000000000001", "gas_limit": "35000000"},
+			"%s": {"fee_recipient": "0x0000000000000000000000000000000000000002", "builder": {"enabled": true, "gas_limit": "36000000"}}
+		},
+		"default_config": {"fee_recipient": "0x0000000000000000000000000000000000000003"}
+	}`, set.ByIndex(0).Pubkey, set.ByIndex(1).Pubkey)
+	cfg.ProposerConfigPath = filepath.Join(t.TempDir(), "proposer-config.json")
+	require.NoError(t, os.WriteFile(cfg.ProposerConfigPath, []byte(config), 0600))
+	set, err = NewValidatorSet(cfg, 8, [32]byte{})
+	require.NoError(t, err)
+
+	require.Equal(t, common.Address{19: 0x01}, set.ByIndex(0).FeeRecipient)
+	require.Equal(t, uint64(35_000_000), set.ByIndex(0).GasLimit)
+	// Prysm and Teku keep the gas limit in the builder section
+	require.Equal(t, common.Address{19: 0x02}, set.ByIndex(1).FeeRecipient)
+	require.Equal(t, uint64(36_000_000), set.ByIndex(1).GasLimit)
+	require.Equal(t, common.Address{19: 0x03}, set.ByIndex(2).FeeRecipient)
+	require.Equal(t, cfg.GasLimit, set.ByIndex(2).GasLimit)
+}
+
+func TestProposerSchedule(t *testing.T) {
+	cfg := &ValidatorsConfig{}
+	cfg.Default()
+	cfg.Count = 4
+	set, err := NewValidatorSet(cfg, 8, [32]byte{0x01})
+	require.NoError(t, err)
+	require.Equal(t, 4, set.Len())
+
+	duties := set.ProposerDuties(3)
+	require.Len(t, duties, 8)
+	require.Equal(t, duties, set.ProposerDuties(3), "schedule must be deterministic")
+	for i, index := range duties {
+		require.Equal(t, set.ByIndex(index), set.Proposer(3*8+uint64(i)))
+	}
+
+	// Validators without explicit preferences have distinct fee recipients
+	require.NotEqual(t, set.ByIndex(0).FeeRecipient, set.ByIndex(1).FeeRecipient)
+	require.Equal(t, set.ByIndex(2), set.ByPubkey(set.ByIndex(2).Pubkey))
+}